@@ -0,0 +1,163 @@
+package batproxy
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultAccessCookieTTL is how long the cookie exchanged for a query token
+// or a basic auth password lets the browser in.
+const DefaultAccessCookieTTL = 24 * time.Hour
+
+// tokenHashPrefix prefixes the hashes of the tokens.
+const tokenHashPrefix = "sha256:"
+
+// Access restricts who reaches the destination of a proxy through the
+// reverse proxy, anyone may if none of its credentials is set. Only the
+// hashes of the credentials are stored.
+type Access struct {
+	// BasicAuth Users allowed with http basic auth.
+	// Optional.
+	BasicAuth []*BasicAuthUser `json:"basic_auth,omitempty"`
+
+	// BearerTokens Tokens allowed in the Authorization: Bearer header.
+	// Optional.
+	BearerTokens []*AccessToken `json:"bearer_tokens,omitempty"`
+
+	// QueryTokens Tokens allowed in the batproxy_token query parameter, once,
+	// exchanged for a cookie.
+	// Optional.
+	QueryTokens []*AccessToken `json:"query_tokens,omitempty"`
+
+	// CookieTTL Seconds the cookie exchanged for a query token or a basic
+	// auth password is valid.
+	// Default: 86400.
+	// Optional.
+	CookieTTL int64 `json:"cookie_ttl,omitempty"`
+}
+
+// BasicAuthUser is a user allowed with http basic auth.
+type BasicAuthUser struct {
+	// User Name of the user.
+	// Required.
+	User string `json:"user"`
+
+	// Password Password of the user, replaced by its hash once stored.
+	// Input only.
+	Password string `json:"password,omitempty"`
+
+	// PasswordHash Bcrypt hash of password.
+	// Optional.
+	PasswordHash string `json:"password_hash,omitempty"`
+}
+
+// AccessToken is a static token allowed in.
+type AccessToken struct {
+	// Token Random secret, replaced by its hash once stored.
+	// Input only.
+	Token string `json:"token,omitempty"`
+
+	// TokenHash Hash of token.
+	// Format: sha256:<hex>
+	// Optional.
+	TokenHash string `json:"token_hash,omitempty"`
+}
+
+func (a *Access) Validate() error {
+	if a.CookieTTL < 0 {
+		return fmt.Errorf("invalid access cookie_ttl %d, expect non-negative seconds", a.CookieTTL)
+	}
+
+	for i, u := range a.BasicAuth {
+		if u.User == "" || strings.Contains(u.User, ":") {
+			return fmt.Errorf("invalid access basic auth user %q", u.User)
+		}
+		if u.Password == "" && u.PasswordHash == "" {
+			return fmt.Errorf("access basic auth user %s requires password or password_hash", u.User)
+		}
+		if u.PasswordHash != "" {
+			if _, err := bcrypt.Cost([]byte(u.PasswordHash)); err != nil {
+				return fmt.Errorf("invalid access basic auth %d password_hash: %v", i, err)
+			}
+		}
+	}
+
+	for _, tokens := range [][]*AccessToken{a.BearerTokens, a.QueryTokens} {
+		for i, t := range tokens {
+			if t.Token == "" && t.TokenHash == "" {
+				return fmt.Errorf("access token %d requires token or token_hash", i)
+			}
+			if t.TokenHash != "" && !validTokenHash(t.TokenHash) {
+				return fmt.Errorf("invalid access token %d token_hash, expect %s<hex>", i, tokenHashPrefix)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Enabled reports whether any credential restricts the access.
+func (a *Access) Enabled() bool {
+	return a != nil && len(a.BasicAuth)+len(a.BearerTokens)+len(a.QueryTokens) > 0
+}
+
+// CookieExpiration returns how long the cookies are valid.
+func (a *Access) CookieExpiration() time.Duration {
+	if a.CookieTTL > 0 {
+		return time.Duration(a.CookieTTL) * time.Second
+	}
+	return DefaultAccessCookieTTL
+}
+
+// Hash replaces the passwords and tokens by their hashes.
+func (a *Access) Hash() error {
+	for _, u := range a.BasicAuth {
+		if u.Password == "" {
+			continue
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return fmt.Errorf("hash access basic auth user %s: %v", u.User, err)
+		}
+		u.PasswordHash, u.Password = string(hash), ""
+	}
+
+	for _, tokens := range [][]*AccessToken{a.BearerTokens, a.QueryTokens} {
+		for _, t := range tokens {
+			if t.Token == "" {
+				continue
+			}
+			t.TokenHash, t.Token = HashToken(t.Token), ""
+		}
+	}
+
+	return nil
+}
+
+// Verify reports whether password is the one of the user.
+func (u *BasicAuthUser) Verify(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+}
+
+// Verify reports whether token is the one hashed.
+func (t *AccessToken) Verify(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashToken(token)), []byte(t.TokenHash)) == 1
+}
+
+// HashToken returns the hash of token, fast to compare as the tokens are
+// random.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return tokenHashPrefix + hex.EncodeToString(sum[:])
+}
+
+func validTokenHash(hash string) bool {
+	b, err := hex.DecodeString(strings.TrimPrefix(hash, tokenHashPrefix))
+	return strings.HasPrefix(hash, tokenHashPrefix) && err == nil && len(b) == sha256.Size
+}
@@ -0,0 +1,48 @@
+package batproxy
+
+import (
+	"context"
+	"time"
+)
+
+// Circuit breaker states.
+const (
+	// BreakerOpen dials to the host fail fast until NextRetryTime.
+	BreakerOpen = "open"
+
+	// BreakerHalfOpen the next dial to the host tries it again, and closes
+	// the circuit if it succeeds.
+	BreakerHalfOpen = "half_open"
+)
+
+type Breaker struct {
+	// Host SSH server which could not be reached.
+	// Format: <host>:<port>
+	Host string `json:"host"`
+
+	// State One of [open, half_open].
+	State string `json:"state"`
+
+	// Failures Number of consecutive failed dials.
+	Failures int `json:"failures"`
+
+	// LastError Error of the last failed dial.
+	LastError string `json:"last_error"`
+
+	// OpenTime Time of the last failed dial.
+	OpenTime time.Time `json:"open_time"`
+
+	// NextRetryTime Time the host is tried again.
+	NextRetryTime time.Time `json:"next_retry_time"`
+}
+
+type ListBreakersPage struct {
+	Breakers []*Breaker `json:"breakers"`
+}
+
+// BreakerService reports the ssh servers whose circuit is open. Hosts whose
+// circuit is closed are not listed.
+type BreakerService interface {
+	ListBreakers(ctx context.Context) (*ListBreakersPage, error)
+	ResetBreaker(ctx context.Context, host string) error
+}
@@ -0,0 +1,54 @@
+package batproxy
+
+import (
+	"context"
+	"time"
+)
+
+type CacheEntry struct {
+	// ProxyID Id of the cached proxy.
+	ProxyID string `json:"proxy_id"`
+
+	// Hits Number of lookups answered by this entry.
+	Hits uint64 `json:"hits"`
+
+	// Age Seconds since the entry was cached.
+	Age int64 `json:"age"`
+
+	// TTL Seconds until the entry expires.
+	TTL int64 `json:"ttl"`
+
+	// CreateTime Time the entry was cached.
+	CreateTime time.Time `json:"create_time"`
+
+	// ExpireTime Time the entry expires.
+	ExpireTime time.Time `json:"expire_time"`
+}
+
+type CacheStats struct {
+	// Entries Number of cached proxies.
+	Entries int `json:"entries"`
+
+	// Hits Number of proxy lookups answered by the cache.
+	Hits uint64 `json:"hits"`
+
+	// Misses Number of proxy lookups passed to the store.
+	Misses uint64 `json:"misses"`
+
+	// HitRatio Hits over all lookups, 0 when there were none.
+	HitRatio float64 `json:"hit_ratio"`
+
+	// MissRatio Misses over all lookups, 0 when there were none.
+	MissRatio float64 `json:"miss_ratio"`
+}
+
+type ListCacheEntriesPage struct {
+	Entries []*CacheEntry `json:"entries"`
+}
+
+type CacheService interface {
+	ListCacheEntries(ctx context.Context) (*ListCacheEntriesPage, error)
+	GetCacheStats(ctx context.Context) (*CacheStats, error)
+	EvictCacheEntry(ctx context.Context, proxyID string) error
+	FlushCache(ctx context.Context) error
+}
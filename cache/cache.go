@@ -6,4 +6,8 @@ import (
 
 const (
 	DefaultExpiration = 15 * time.Second
+
+	// DefaultAccessExpiration bounds how long the credentials of a proxy
+	// changed on another replica are still accepted.
+	DefaultAccessExpiration = 5 * time.Second
 )
@@ -2,41 +2,70 @@ package cache
 
 import (
 	"context"
+	"sort"
+	"sync/atomic"
 	"time"
 
 	cache "github.com/Code-Hex/go-generics-cache"
 	"github.com/batx-dev/batproxy"
 )
 
+// entry is a cached proxy and its bookkeeping.
+type entry struct {
+	proxy      *batproxy.Proxy
+	createTime time.Time
+	expireTime time.Time
+	hits       atomic.Uint64
+}
+
 type ProxyService struct {
 	next batproxy.ProxyService
 
-	cache      *cache.Cache[string, *batproxy.Proxy]
-	expiration time.Duration
+	cache            *cache.Cache[string, *entry]
+	expiration       time.Duration
+	accessExpiration time.Duration
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
 }
 
 type ProxyServiceOptions struct {
 	ProxyExpiration time.Duration
+
+	// AccessExpiration is the expiration of the proxies with an access,
+	// if shorter than ProxyExpiration. UpdateProxyAccess only invalidates
+	// the cache of this replica, the other ones accept the replaced
+	// credentials until their entry expires.
+	AccessExpiration time.Duration
 }
 
 func NewProxyService(next batproxy.ProxyService, opts ProxyServiceOptions) *ProxyService {
 	s := &ProxyService{
-		next:       next,
-		cache:      cache.New[string, *batproxy.Proxy](),
-		expiration: DefaultExpiration,
+		next:             next,
+		cache:            cache.New[string, *entry](),
+		expiration:       DefaultExpiration,
+		accessExpiration: DefaultAccessExpiration,
 	}
 
 	if opts.ProxyExpiration > 0 {
 		s.expiration = opts.ProxyExpiration
 	}
+	if opts.AccessExpiration > 0 {
+		s.accessExpiration = opts.AccessExpiration
+	}
 
 	return s
 }
 
+var (
+	_ batproxy.ProxyService = (*ProxyService)(nil)
+	_ batproxy.CacheService = (*ProxyService)(nil)
+)
+
 func (s *ProxyService) CreateProxy(ctx context.Context, proxy *batproxy.Proxy, opts batproxy.CreateProxyOptions) (err error) {
 	defer func() {
 		if err == nil {
-			s.cache.Set(proxy.ID, proxy, cache.WithExpiration(s.expiration))
+			s.set(proxy)
 		}
 	}()
 	return s.next.CreateProxy(ctx, proxy, opts)
@@ -44,16 +73,20 @@ func (s *ProxyService) CreateProxy(ctx context.Context, proxy *batproxy.Proxy, o
 
 func (s *ProxyService) ListProxies(ctx context.Context, opts batproxy.ListProxiesOptions) (page *batproxy.ListProxiesPage, err error) {
 	if opts.ProxyID != "" {
-		res, ok := s.cache.Get(opts.ProxyID)
-		if ok && res != nil {
+		e, ok := s.cache.Get(opts.ProxyID)
+		if ok && e != nil {
+			e.hits.Add(1)
+			s.hits.Add(1)
+
 			page = &batproxy.ListProxiesPage{
 				Proxies: []*batproxy.Proxy{},
 			}
 
-			page.Proxies = append(page.Proxies, res)
+			page.Proxies = append(page.Proxies, e.proxy)
 
 			return page, nil
 		}
+		s.misses.Add(1)
 	}
 
 	page, err = s.next.ListProxies(ctx, opts)
@@ -62,7 +95,7 @@ func (s *ProxyService) ListProxies(ctx context.Context, opts batproxy.ListProxie
 	}
 
 	for _, p := range page.Proxies {
-		s.cache.Set(p.ID, p, cache.WithExpiration(s.expiration))
+		s.set(p)
 	}
 
 	return page, nil
@@ -76,3 +109,89 @@ func (s *ProxyService) DeleteProxy(ctx context.Context, proxyID string) (err err
 	}()
 	return s.next.DeleteProxy(ctx, proxyID)
 }
+
+func (s *ProxyService) UpdateProxyAccess(ctx context.Context, proxyID string, access *batproxy.Access) (err error) {
+	defer func() {
+		if err == nil {
+			s.cache.Delete(proxyID)
+		}
+	}()
+	return s.next.UpdateProxyAccess(ctx, proxyID, access)
+}
+
+func (s *ProxyService) ListCacheEntries(ctx context.Context) (*batproxy.ListCacheEntriesPage, error) {
+	now := time.Now()
+
+	page := &batproxy.ListCacheEntriesPage{
+		Entries: []*batproxy.CacheEntry{},
+	}
+	for _, id := range s.cache.Keys() {
+		e, ok := s.cache.Get(id)
+		if !ok || e == nil {
+			continue
+		}
+		page.Entries = append(page.Entries, &batproxy.CacheEntry{
+			ProxyID:    id,
+			Hits:       e.hits.Load(),
+			Age:        int64(now.Sub(e.createTime).Seconds()),
+			TTL:        int64(e.expireTime.Sub(now).Seconds()),
+			CreateTime: e.createTime,
+			ExpireTime: e.expireTime,
+		})
+	}
+
+	sort.Slice(page.Entries, func(i, j int) bool {
+		return page.Entries[i].ProxyID < page.Entries[j].ProxyID
+	})
+
+	return page, nil
+}
+
+func (s *ProxyService) GetCacheStats(ctx context.Context) (*batproxy.CacheStats, error) {
+	page, err := s.ListCacheEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &batproxy.CacheStats{
+		Entries: len(page.Entries),
+		Hits:    s.hits.Load(),
+		Misses:  s.misses.Load(),
+	}
+
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(total)
+		stats.MissRatio = float64(stats.Misses) / float64(total)
+	}
+
+	return stats, nil
+}
+
+func (s *ProxyService) EvictCacheEntry(ctx context.Context, proxyID string) error {
+	if _, ok := s.cache.Get(proxyID); !ok {
+		return batproxy.Errorf(batproxy.ENOTFOUND, "'%s' is not cached", proxyID)
+	}
+	s.cache.Delete(proxyID)
+	return nil
+}
+
+func (s *ProxyService) FlushCache(ctx context.Context) error {
+	for _, id := range s.cache.Keys() {
+		s.cache.Delete(id)
+	}
+	return nil
+}
+
+func (s *ProxyService) set(proxy *batproxy.Proxy) {
+	expiration := s.expiration
+	if proxy.Access.Enabled() && s.accessExpiration < expiration {
+		expiration = s.accessExpiration
+	}
+
+	now := time.Now()
+	s.cache.Set(proxy.ID, &entry{
+		proxy:      proxy,
+		createTime: now,
+		expireTime: now.Add(expiration),
+	}, cache.WithExpiration(expiration))
+}
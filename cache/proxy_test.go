@@ -0,0 +1,240 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/batx-dev/batproxy"
+)
+
+// store is a ProxyService counting the lookups reaching it.
+type store struct {
+	mu      sync.Mutex
+	proxies map[string]*batproxy.Proxy
+	lookups int
+}
+
+func newStore(ids ...string) *store {
+	s := &store{proxies: make(map[string]*batproxy.Proxy)}
+	for _, id := range ids {
+		s.proxies[id] = &batproxy.Proxy{ID: id}
+	}
+	return s
+}
+
+func (s *store) CreateProxy(ctx context.Context, p *batproxy.Proxy, opts batproxy.CreateProxyOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.proxies[p.ID] = p
+	return nil
+}
+
+func (s *store) ListProxies(ctx context.Context, opts batproxy.ListProxiesOptions) (*batproxy.ListProxiesPage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lookups++
+	page := &batproxy.ListProxiesPage{}
+	for id, p := range s.proxies {
+		if opts.ProxyID == "" || opts.ProxyID == id {
+			page.Proxies = append(page.Proxies, p)
+		}
+	}
+	return page, nil
+}
+
+func (s *store) DeleteProxy(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.proxies, id)
+	return nil
+}
+
+func (s *store) UpdateProxyAccess(ctx context.Context, id string, a *batproxy.Access) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// the cached proxies are not changed in place
+	if p, ok := s.proxies[id]; ok {
+		cp := *p
+		cp.Access = a
+		s.proxies[id] = &cp
+	}
+	return nil
+}
+
+func (s *store) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lookups
+}
+
+// get looks up id, failing t if it is missing.
+func get(t *testing.T, s *ProxyService, id string) {
+	t.Helper()
+
+	page, err := s.ListProxies(context.Background(), batproxy.ListProxiesOptions{ProxyID: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Proxies) != 1 || page.Proxies[0].ID != id {
+		t.Fatalf("proxies = %v, want %s", page.Proxies, id)
+	}
+}
+
+func TestProxyServiceHits(t *testing.T) {
+	ctx := context.Background()
+	next := newStore("p1", "p2")
+	s := NewProxyService(next, ProxyServiceOptions{})
+
+	get(t, s, "p1") // miss
+	get(t, s, "p1") // hit
+	get(t, s, "p1") // hit
+	get(t, s, "p2") // miss
+
+	if n := next.count(); n != 2 {
+		t.Errorf("store lookups = %d, want 2", n)
+	}
+
+	stats, err := s.GetCacheStats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := batproxy.CacheStats{Entries: 2, Hits: 2, Misses: 2, HitRatio: 0.5, MissRatio: 0.5}
+	if *stats != want {
+		t.Errorf("stats = %+v, want %+v", *stats, want)
+	}
+
+	page, err := s.ListCacheEntries(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Entries) != 2 || page.Entries[0].ProxyID != "p1" || page.Entries[0].Hits != 2 || page.Entries[1].Hits != 0 {
+		t.Errorf("entries = %+v, want p1 hit twice and p2 never", page.Entries)
+	}
+	if e := page.Entries[0]; e.TTL <= 0 || !e.ExpireTime.After(e.CreateTime) {
+		t.Errorf("entry p1 expires at %s, created at %s", e.ExpireTime, e.CreateTime)
+	}
+}
+
+func TestProxyServiceStatsEmpty(t *testing.T) {
+	s := NewProxyService(newStore(), ProxyServiceOptions{})
+
+	stats, err := s.GetCacheStats(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *stats != (batproxy.CacheStats{}) {
+		t.Errorf("stats = %+v, want zero", *stats)
+	}
+}
+
+func TestProxyServiceInvalidate(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		invalidate func(s *ProxyService) error
+	}{
+		{
+			name: "update access",
+			invalidate: func(s *ProxyService) error {
+				return s.UpdateProxyAccess(ctx, "p1", &batproxy.Access{})
+			},
+		},
+		{
+			name: "evict",
+			invalidate: func(s *ProxyService) error {
+				return s.EvictCacheEntry(ctx, "p1")
+			},
+		},
+		{
+			name:       "flush",
+			invalidate: func(s *ProxyService) error { return s.FlushCache(ctx) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := newStore("p1")
+			s := NewProxyService(next, ProxyServiceOptions{})
+
+			get(t, s, "p1")
+			if err := tt.invalidate(s); err != nil {
+				t.Fatal(err)
+			}
+			get(t, s, "p1")
+
+			if n := next.count(); n != 2 {
+				t.Errorf("store lookups = %d, want 2 once invalidated", n)
+			}
+		})
+	}
+}
+
+func TestProxyServiceDelete(t *testing.T) {
+	ctx := context.Background()
+	s := NewProxyService(newStore("p1"), ProxyServiceOptions{})
+
+	get(t, s, "p1")
+	if err := s.DeleteProxy(ctx, "p1"); err != nil {
+		t.Fatal(err)
+	}
+	page, err := s.ListProxies(ctx, batproxy.ListProxiesOptions{ProxyID: "p1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Proxies) != 0 {
+		t.Errorf("proxies = %v, want the deleted proxy gone", page.Proxies)
+	}
+	if err := s.EvictCacheEntry(ctx, "p1"); batproxy.ErrorCode(err) != batproxy.ENOTFOUND {
+		t.Errorf("evict uncached = %v, want %s", err, batproxy.ENOTFOUND)
+	}
+}
+
+func TestProxyServiceAccessExpiration(t *testing.T) {
+	ctx := context.Background()
+	next := newStore("open", "p1")
+	if err := next.UpdateProxyAccess(ctx, "p1", &batproxy.Access{BearerTokens: []*batproxy.AccessToken{{Token: "old"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// two replicas sharing the store
+	opts := ProxyServiceOptions{ProxyExpiration: time.Hour, AccessExpiration: 100 * time.Millisecond}
+	a, b := NewProxyService(next, opts), NewProxyService(next, opts)
+	get(t, a, "p1")
+	get(t, b, "p1")
+	get(t, b, "open")
+
+	page, err := b.ListCacheEntries(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Entries) != 2 || page.Entries[0].TTL < 3500 || page.Entries[1].TTL > 0 {
+		t.Errorf("entries = %+v, want the one with an access expiring first", page.Entries)
+	}
+
+	if err := a.UpdateProxyAccess(ctx, "p1", &batproxy.Access{BearerTokens: []*batproxy.AccessToken{{Token: "new"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// token returns the bearer token of p1 cached by s
+	token := func(s *ProxyService) string {
+		page, err := s.ListProxies(ctx, batproxy.ListProxiesOptions{ProxyID: "p1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return page.Proxies[0].Access.BearerTokens[0].Token
+	}
+	if got := token(a); got != "new" {
+		t.Errorf("token of the updating replica = %s, want new", got)
+	}
+	if got := token(b); got != "old" {
+		t.Errorf("token of the other replica = %s, want old until it expires", got)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if got := token(b); got != "new" {
+		t.Errorf("token of the other replica once expired = %s, want new", got)
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"github.com/urfave/cli/v2"
+)
+
+func BreakerCmd() *cli.Command {
+	cmd := &cli.Command{
+		Name:  "breaker",
+		Usage: "Inspect and reset circuit breakers of ssh servers",
+		Subcommands: []*cli.Command{
+			BreakerListCmd(),
+			BreakerResetCmd(),
+		},
+	}
+
+	return cmd
+}
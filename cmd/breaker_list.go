@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/batx-dev/batproxy/http"
+	"github.com/urfave/cli/v2"
+)
+
+func BreakerListCmd() *cli.Command {
+	cmd := &cli.Command{
+		Name:  "list",
+		Usage: "list ssh servers whose circuit is open",
+		Flags: []cli.Flag{
+			unixSocketFlag(),
+		},
+
+		Action: BreakerListAction,
+	}
+	return cmd
+}
+
+func BreakerListAction(cCtx *cli.Context) error {
+	client, err := http.NewClient(cCtx.String("base-url"))
+	if err != nil {
+		return err
+	}
+
+	svc := http.BreakerService{
+		Client: client,
+	}
+
+	page, err := svc.ListBreakers(cCtx.Context)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(tw, "HOST\tSTATE\tFAILURES\tNEXT RETRY\tLAST ERROR\n")
+	for _, b := range page.Breakers {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", b.Host, b.State, b.Failures, b.NextRetryTime.Format(time.RFC3339), b.LastError)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/batx-dev/batproxy/http"
+	"github.com/urfave/cli/v2"
+)
+
+func BreakerResetCmd() *cli.Command {
+	cmd := &cli.Command{
+		Name:  "reset",
+		Usage: "close the circuit of an ssh server, the next dial tries it right away",
+		Flags: []cli.Flag{
+			unixSocketFlag(),
+			&cli.StringFlag{
+				Name:     "host",
+				Usage:    "SSH server, <host>:<port>",
+				Required: true,
+			},
+		},
+
+		Action: BreakerResetAction,
+	}
+
+	return cmd
+}
+
+func BreakerResetAction(cCtx *cli.Context) error {
+	client, err := http.NewClient(cCtx.String("base-url"))
+	if err != nil {
+		return err
+	}
+
+	svc := http.BreakerService{
+		Client: client,
+	}
+	host := cCtx.String("host")
+	if err := svc.ResetBreaker(cCtx.Context, host); err != nil {
+		return err
+	}
+
+	fmt.Printf("Reset: %s\n", host)
+
+	return nil
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"github.com/urfave/cli/v2"
+)
+
+func CacheCmd() *cli.Command {
+	cmd := &cli.Command{
+		Name:  "cache",
+		Usage: "Inspect and flush proxy cache",
+		Subcommands: []*cli.Command{
+			CacheListCmd(),
+			CacheStatsCmd(),
+			CacheEvictCmd(),
+			CacheFlushCmd(),
+		},
+	}
+
+	return cmd
+}
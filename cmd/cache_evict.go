@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/batx-dev/batproxy/http"
+	"github.com/urfave/cli/v2"
+)
+
+func CacheEvictCmd() *cli.Command {
+	cmd := &cli.Command{
+		Name:  "evict",
+		Usage: "evict a proxy from cache",
+		Flags: []cli.Flag{
+			unixSocketFlag(),
+			&cli.StringFlag{
+				Name:     "name",
+				Usage:    "Proxy id",
+				Aliases:  []string{"n"},
+				Required: true,
+			},
+		},
+
+		Action: CacheEvictAction,
+	}
+
+	return cmd
+}
+
+func CacheEvictAction(cCtx *cli.Context) error {
+	client, err := http.NewClient(cCtx.String("base-url"))
+	if err != nil {
+		return err
+	}
+
+	svc := http.CacheService{
+		Client: client,
+	}
+	proxyID := cCtx.String("name")
+	if err := svc.EvictCacheEntry(cCtx.Context, proxyID); err != nil {
+		return err
+	}
+
+	fmt.Printf("Evicted: %s\n", proxyID)
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/batx-dev/batproxy/http"
+	"github.com/urfave/cli/v2"
+)
+
+func CacheFlushCmd() *cli.Command {
+	cmd := &cli.Command{
+		Name:  "flush",
+		Usage: "evict every proxy from cache",
+		Flags: []cli.Flag{
+			unixSocketFlag(),
+		},
+
+		Action: CacheFlushAction,
+	}
+
+	return cmd
+}
+
+func CacheFlushAction(cCtx *cli.Context) error {
+	client, err := http.NewClient(cCtx.String("base-url"))
+	if err != nil {
+		return err
+	}
+
+	svc := http.CacheService{
+		Client: client,
+	}
+	if err := svc.FlushCache(cCtx.Context); err != nil {
+		return err
+	}
+
+	fmt.Println("Flushed")
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/batx-dev/batproxy/http"
+	"github.com/urfave/cli/v2"
+)
+
+func CacheListCmd() *cli.Command {
+	cmd := &cli.Command{
+		Name:  "list",
+		Usage: "list cached proxies",
+		Flags: []cli.Flag{
+			unixSocketFlag(),
+		},
+
+		Action: CacheListAction,
+	}
+	return cmd
+}
+
+func CacheListAction(cCtx *cli.Context) error {
+	client, err := http.NewClient(cCtx.String("base-url"))
+	if err != nil {
+		return err
+	}
+
+	svc := http.CacheService{
+		Client: client,
+	}
+
+	page, err := svc.ListCacheEntries(cCtx.Context)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(tw, "NAME\tAGE\tTTL\tHITS\n")
+	for _, e := range page.Entries {
+		fmt.Fprintf(tw, "%s\t%ds\t%ds\t%d\n", e.ProxyID, e.Age, e.TTL, e.Hits)
+	}
+
+	return tw.Flush()
+}
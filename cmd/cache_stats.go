@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/batx-dev/batproxy/http"
+	"github.com/urfave/cli/v2"
+)
+
+func CacheStatsCmd() *cli.Command {
+	cmd := &cli.Command{
+		Name:  "stats",
+		Usage: "show proxy cache hit and miss ratios",
+		Flags: []cli.Flag{
+			unixSocketFlag(),
+		},
+
+		Action: CacheStatsAction,
+	}
+	return cmd
+}
+
+func CacheStatsAction(cCtx *cli.Context) error {
+	client, err := http.NewClient(cCtx.String("base-url"))
+	if err != nil {
+		return err
+	}
+
+	svc := http.CacheService{
+		Client: client,
+	}
+
+	stats, err := svc.GetCacheStats(cCtx.Context)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(tw, "ENTRIES\tHITS\tMISSES\tHIT RATIO\tMISS RATIO\n")
+	fmt.Fprintf(tw, "%d\t%d\t%d\t%.2f\t%.2f\n", stats.Entries, stats.Hits, stats.Misses, stats.HitRatio, stats.MissRatio)
+
+	return tw.Flush()
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"github.com/urfave/cli/v2"
+)
+
+func ConnCmd() *cli.Command {
+	cmd := &cli.Command{
+		Name:  "conn",
+		Usage: "Inspect and kill live ssh connections",
+		Subcommands: []*cli.Command{
+			ConnListCmd(),
+			ConnKillCmd(),
+		},
+	}
+
+	return cmd
+}
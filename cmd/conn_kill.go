@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/batx-dev/batproxy/http"
+	"github.com/urfave/cli/v2"
+)
+
+func ConnKillCmd() *cli.Command {
+	cmd := &cli.Command{
+		Name:  "kill",
+		Usage: "close a live ssh connection with its streams",
+		Flags: []cli.Flag{
+			unixSocketFlag(),
+			&cli.StringFlag{
+				Name:     "id",
+				Usage:    "Connection id",
+				Required: true,
+			},
+		},
+
+		Action: ConnKillAction,
+	}
+
+	return cmd
+}
+
+func ConnKillAction(cCtx *cli.Context) error {
+	client, err := http.NewClient(cCtx.String("base-url"))
+	if err != nil {
+		return err
+	}
+
+	svc := http.ConnectionService{
+		Client: client,
+	}
+	id := cCtx.String("id")
+	if err := svc.CloseConnection(cCtx.Context, id); err != nil {
+		return err
+	}
+
+	fmt.Printf("Killed: %s\n", id)
+
+	return nil
+}
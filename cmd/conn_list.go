@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/batx-dev/batproxy/http"
+	"github.com/urfave/cli/v2"
+)
+
+func ConnListCmd() *cli.Command {
+	cmd := &cli.Command{
+		Name:  "list",
+		Usage: "list live ssh connections",
+		Flags: []cli.Flag{
+			unixSocketFlag(),
+		},
+
+		Action: ConnListAction,
+	}
+	return cmd
+}
+
+func ConnListAction(cCtx *cli.Context) error {
+	client, err := http.NewClient(cCtx.String("base-url"))
+	if err != nil {
+		return err
+	}
+
+	svc := http.ConnectionService{
+		Client: client,
+	}
+
+	page, err := svc.ListConnections(cCtx.Context)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(tw, "ID\tUSER\tHOST\tSLOT\tAGE\tCHANNELS\tREAD\tWRITTEN\tVIA\n")
+	for _, c := range page.Connections {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%ds\t%d\t%d\t%d\t%s\n",
+			c.ID, c.User, c.Host, c.Slot, c.Age, c.Channels, c.BytesRead, c.BytesWritten, c.Via)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/batx-dev/batproxy"
+	"github.com/batx-dev/batproxy/http"
+	"github.com/urfave/cli/v2"
+)
+
+func LaunchCmd() *cli.Command {
+	cmd := &cli.Command{
+		Name:  "launch",
+		Usage: "launch an application as a batch job and create the proxy to it",
+		Flags: []cli.Flag{
+			unixSocketFlag(),
+			&cli.StringFlag{
+				Name:     "app",
+				Usage:    "Application template, one of [jupyter, rstudio, code-server]",
+				Required: true,
+				Category: "LAUNCH",
+			},
+			&cli.StringFlag{
+				Name:     "timeout",
+				Usage:    "Time to wait for the application to start, the job is cancelled and the proxy deleted after that",
+				Category: "LAUNCH",
+			},
+			&cli.StringFlag{
+				Name:     "partition",
+				Usage:    "Job partition",
+				Category: "SCHEDULER",
+			},
+			&cli.StringFlag{
+				Name:     "account",
+				Usage:    "Job account",
+				Category: "SCHEDULER",
+			},
+			&cli.StringFlag{
+				Name:     "time",
+				Usage:    "Job time limit, e.g. 8:00:00",
+				Category: "SCHEDULER",
+			},
+			&cli.IntFlag{
+				Name:     "cpus",
+				Usage:    "Job cpus",
+				Category: "SCHEDULER",
+			},
+			&cli.StringFlag{
+				Name:     "memory",
+				Usage:    "Job memory, e.g. 16G",
+				Category: "SCHEDULER",
+			},
+			&cli.IntFlag{
+				Name:     "gpus",
+				Usage:    "Job gpus",
+				Category: "SCHEDULER",
+			},
+			&cli.StringFlag{
+				Name:     "suffix",
+				Usage:    "Proxy id suffix",
+				Category: "PROXY",
+			},
+			&cli.StringFlag{
+				Name:     "name",
+				Usage:    "Proxy id, will overlay <suffix>",
+				Aliases:  []string{"n"},
+				Category: "PROXY",
+			},
+			&cli.StringFlag{
+				Name:     "user",
+				Usage:    "Over SSH login name",
+				Aliases:  []string{"u"},
+				Required: true,
+				Category: "SSH",
+			},
+			&cli.StringFlag{
+				Name:     "host",
+				Usage:    "Over SSH login host, contains port",
+				Aliases:  []string{"H"},
+				Required: true,
+				Category: "SSH",
+			},
+			&cli.StringFlag{
+				Name:     "private-key",
+				Usage:    "Over SSH login private key",
+				Aliases:  []string{"i"},
+				Category: "SSH",
+			},
+			&cli.StringFlag{
+				Name:     "passphrase",
+				Usage:    "Over SSH login private key passphrase",
+				Aliases:  []string{"s"},
+				Category: "SSH",
+			},
+			&cli.StringFlag{
+				Name:     "password",
+				Usage:    "Over SSH login password",
+				Aliases:  []string{"p"},
+				Category: "SSH",
+			},
+			&cli.StringFlag{
+				Name:     "totp-secret",
+				Usage:    "Over SSH login base32 seed of the one-time codes asked by keyboard-interactive prompts",
+				Category: "SSH",
+			},
+			&cli.BoolFlag{
+				Name:     "agent",
+				Usage:    "Over SSH login with the keys of the server's ssh-agent",
+				Category: "SSH",
+			},
+		},
+		Action: LaunchAction,
+	}
+
+	return cmd
+}
+
+func LaunchAction(cCtx *cli.Context) error {
+	launch := &batproxy.Launch{
+		App: cCtx.String("app"),
+		Proxy: &batproxy.Proxy{
+			ID:         cCtx.String("name"),
+			User:       cCtx.String("user"),
+			Host:       cCtx.String("host"),
+			PrivateKey: cCtx.String("private-key"),
+			Passphrase: cCtx.String("passphrase"),
+			Password:   cCtx.String("password"),
+			TOTPSecret: cCtx.String("totp-secret"),
+			Agent:      cCtx.Bool("agent"),
+		},
+	}
+	scheduler := &batproxy.SchedulerOptions{
+		Partition: cCtx.String("partition"),
+		Account:   cCtx.String("account"),
+		Time:      cCtx.String("time"),
+		CPUs:      cCtx.Int("cpus"),
+		Memory:    cCtx.String("memory"),
+		GPUs:      cCtx.Int("gpus"),
+	}
+	if *scheduler != (batproxy.SchedulerOptions{}) {
+		launch.Scheduler = scheduler
+	}
+	if cCtx.IsSet("timeout") {
+		d, err := time.ParseDuration(cCtx.String("timeout"))
+		if err != nil {
+			return err
+		}
+		launch.Timeout = int64(d / time.Second)
+	}
+	if err := launch.Validate(); err != nil {
+		return err
+	}
+
+	opts := batproxy.CreateProxyOptions{Suffix: cCtx.String("suffix")}
+
+	client, err := http.NewClient(cCtx.String("base-url"))
+	if err != nil {
+		return err
+	}
+
+	svc := http.LaunchService{
+		Client: client,
+	}
+
+	if err := svc.Launch(cCtx.Context, launch, opts); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(tw, "NAME\tAPP\tJOB\tURL\n")
+	fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", launch.Proxy.ID, launch.App, launch.JobID, launch.URL)
+
+	return tw.Flush()
+}
@@ -20,6 +20,10 @@ func main() {
 	app.Commands = []*cli.Command{
 		RunCmd(),
 		ProxyCmd(),
+		CacheCmd(),
+		BreakerCmd(),
+		ConnCmd(),
+		LaunchCmd(),
 	}
 	app.Version = batproxy.Version
 
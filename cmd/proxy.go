@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/batx-dev/batproxy"
 	"github.com/urfave/cli/v2"
@@ -16,6 +17,7 @@ func ProxyCmd() *cli.Command {
 			ProxyCreateCmd(),
 			ProxiesListCmd(),
 			ProxyDeleteCmd(),
+			ProxyAccessCmd(),
 		},
 	}
 
@@ -54,3 +56,16 @@ func unixSocketFlag() *cli.StringFlag {
 		},
 	}
 }
+
+// seconds parses the duration of the flag name, kept in whole seconds by the
+// ssh options, so that e.g. 500ms does not silently turn into 0.
+func seconds(cCtx *cli.Context, name string) (int64, error) {
+	d, err := time.ParseDuration(cCtx.String(name))
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 || d%time.Second != 0 {
+		return 0, batproxy.Errorf(batproxy.EINVALID, "--%s %s: expect whole seconds", name, d)
+	}
+	return int64(d / time.Second), nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/batx-dev/batproxy"
+	"github.com/batx-dev/batproxy/http"
+	"github.com/urfave/cli/v2"
+)
+
+func ProxyAccessCmd() *cli.Command {
+	cmd := &cli.Command{
+		Name:  "access",
+		Usage: "replace the credentials required to reach a proxy, none opens it",
+		Flags: append([]cli.Flag{
+			unixSocketFlag(),
+			&cli.StringFlag{
+				Name:     "name",
+				Usage:    "Proxy id",
+				Aliases:  []string{"n"},
+				Required: true,
+			},
+		}, accessFlags()...),
+		Action: ProxyAccessAction,
+	}
+
+	return cmd
+}
+
+func ProxyAccessAction(cCtx *cli.Context) error {
+	access, err := accessFromFlags(cCtx)
+	if err != nil {
+		return err
+	}
+
+	client, err := http.NewClient(cCtx.String("base-url"))
+	if err != nil {
+		return err
+	}
+
+	svc := http.ProxyService{
+		Client: client,
+	}
+	proxyID := cCtx.String("name")
+	if err := svc.UpdateProxyAccess(cCtx.Context, proxyID, access); err != nil {
+		return err
+	}
+
+	fmt.Printf("Updated: %s\n", proxyID)
+
+	return nil
+}
+
+func accessFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:     "basic-auth",
+			Usage:    "User allowed with http basic auth, user:password",
+			Category: "ACCESS",
+		},
+		&cli.StringSliceFlag{
+			Name:     "bearer-token",
+			Usage:    "Token allowed in the Authorization: Bearer header",
+			Category: "ACCESS",
+		},
+		&cli.StringSliceFlag{
+			Name:     "query-token",
+			Usage:    "Token allowed in the " + http.AccessTokenParam + " query parameter, exchanged for a cookie",
+			Category: "ACCESS",
+		},
+		&cli.StringFlag{
+			Name:     "cookie-ttl",
+			Usage:    "Time the cookie exchanged for a query token or a basic auth password is valid",
+			Category: "ACCESS",
+		},
+	}
+}
+
+// accessFromFlags returns the access of the access flags, nil without
+// credentials.
+func accessFromFlags(cCtx *cli.Context) (*batproxy.Access, error) {
+	access := &batproxy.Access{}
+	for _, s := range cCtx.StringSlice("basic-auth") {
+		user, password, ok := strings.Cut(s, ":")
+		if !ok {
+			return nil, batproxy.Errorf(batproxy.EINVALID, "invalid basic auth, expect user:password")
+		}
+		access.BasicAuth = append(access.BasicAuth, &batproxy.BasicAuthUser{User: user, Password: password})
+	}
+	for _, token := range cCtx.StringSlice("bearer-token") {
+		access.BearerTokens = append(access.BearerTokens, &batproxy.AccessToken{Token: token})
+	}
+	for _, token := range cCtx.StringSlice("query-token") {
+		access.QueryTokens = append(access.QueryTokens, &batproxy.AccessToken{Token: token})
+	}
+	if cCtx.IsSet("cookie-ttl") {
+		d, err := time.ParseDuration(cCtx.String("cookie-ttl"))
+		if err != nil {
+			return nil, err
+		}
+		access.CookieTTL = int64(d / time.Second)
+	}
+
+	if !access.Enabled() {
+		return nil, nil
+	}
+	if err := access.Validate(); err != nil {
+		return nil, batproxy.Errorf(batproxy.EINVALID, "%v", err)
+	}
+	return access, nil
+}
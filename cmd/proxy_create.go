@@ -3,7 +3,10 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/batx-dev/batproxy"
 	"github.com/batx-dev/batproxy/http"
@@ -14,7 +17,7 @@ func ProxyCreateCmd() *cli.Command {
 	cmd := &cli.Command{
 		Name:  "create",
 		Usage: "create proxy rule",
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			unixSocketFlag(),
 			&cli.StringFlag{
 				Name:     "suffix",
@@ -59,19 +62,168 @@ func ProxyCreateCmd() *cli.Command {
 				Aliases:  []string{"p"},
 				Category: "SSH",
 			},
+			&cli.StringFlag{
+				Name:     "totp-secret",
+				Usage:    "Over SSH login base32 seed of the one-time codes asked by keyboard-interactive prompts",
+				Category: "SSH",
+			},
+			&cli.StringFlag{
+				Name:     "certificate",
+				Usage:    "Over SSH login OpenSSH certificate of the private key",
+				Category: "SSH",
+			},
+			&cli.BoolFlag{
+				Name:     "sign-certificate",
+				Usage:    "Over SSH login with a certificate signed by the server's certificate authority",
+				Category: "SSH",
+			},
+			&cli.BoolFlag{
+				Name:     "agent",
+				Usage:    "Over SSH login with the keys of the server's ssh-agent",
+				Category: "SSH",
+			},
+			&cli.StringFlag{
+				Name:     "agent-key-filter",
+				Usage:    "Over SSH login with the ssh-agent keys of this comment or SHA256 fingerprint",
+				Category: "SSH",
+			},
+			&cli.StringFlag{
+				Name:     "host-key-fingerprint",
+				Usage:    "Over SSH login host key SHA256 fingerprint to pin",
+				Category: "SSH",
+			},
+			&cli.StringSliceFlag{
+				Name:     "jump",
+				Usage:    "Over SSH jump host user@host[:port], dialed in order with the login auth",
+				Aliases:  []string{"J"},
+				Category: "SSH",
+			},
+			&cli.StringFlag{
+				Name:     "upstream",
+				Usage:    "Over SSH SOCKS5 or HTTP CONNECT proxy, <socks5|socks5h|http>://[user:password@]host:port",
+				Category: "SSH",
+			},
+			&cli.StringFlag{
+				Name:     "connect-timeout",
+				Usage:    "Over SSH maximum time to connect, retries included",
+				Category: "SSH",
+			},
+			&cli.StringFlag{
+				Name:     "server-alive-interval",
+				Usage:    "Over SSH interval of the keepalive requests",
+				Category: "SSH",
+			},
+			&cli.UintFlag{
+				Name:     "server-alive-count-max",
+				Usage:    "Over SSH number of unanswered keepalive requests closing the connection",
+				Category: "SSH",
+			},
+			&cli.StringFlag{
+				Name:     "retry-min",
+				Usage:    "Over SSH delay before retrying to connect, doubled on every retry",
+				Category: "SSH",
+			},
+			&cli.StringFlag{
+				Name:     "retry-max",
+				Usage:    "Over SSH maximum delay between retries to connect",
+				Category: "SSH",
+			},
+			&cli.StringFlag{
+				Name:     "forward",
+				Usage:    "Over SSH how streams reach the destination, one of [direct, stdio, auto]",
+				Category: "SSH",
+			},
+			&cli.StringFlag{
+				Name:     "relay-command",
+				Usage:    "Over SSH command relaying the streams of stdio forwarding to %h:%p",
+				Category: "SSH",
+			},
+			&cli.StringFlag{
+				Name:     "relay-unix-command",
+				Usage:    "Over SSH command relaying the streams of stdio forwarding to the unix domain socket %h",
+				Category: "SSH",
+			},
+			&cli.StringFlag{
+				Name:     "type",
+				Usage:    "Protocol proxied, one of [http, tcp], tcp forwards the connections of a port allocated on the server",
+				Category: "PROXY",
+			},
 			&cli.StringFlag{
 				Name:     "node",
 				Usage:    "Proxy to destination",
-				Required: true,
 				Category: "PROXY",
 			},
 			&cli.UintFlag{
 				Name:     "port",
 				Usage:    "Proxy to destination",
-				Required: true,
 				Category: "PROXY",
 			},
-		},
+			&cli.StringFlag{
+				Name:     "socket",
+				Usage:    "Proxy to the unix domain socket of this path on host, instead of node and port",
+				Category: "PROXY",
+			},
+			&cli.StringFlag{
+				Name:     "slurm-job",
+				Usage:    "Proxy to port of the node running this Slurm job, instead of node",
+				Category: "PROXY",
+			},
+			&cli.BoolFlag{
+				Name:     "slurm-expire",
+				Usage:    "Delete the proxy once the Slurm job ended, instead of suspending it",
+				Category: "PROXY",
+			},
+			&cli.StringFlag{
+				Name:     "resolve-command",
+				Usage:    "Proxy to the destination printed by this command on host, instead of node and port",
+				Category: "PROXY",
+			},
+			&cli.StringFlag{
+				Name:     "resolve-regexp",
+				Usage:    "Regexp with the named groups node and port, or socket, matching the output of the resolve command, JSON if empty",
+				Category: "PROXY",
+			},
+			&cli.StringFlag{
+				Name:     "resolve-ttl",
+				Usage:    "Time the resolved destination is used before running the resolve command again",
+				Category: "PROXY",
+			},
+			&cli.StringFlag{
+				Name:     "target-scheme",
+				Usage:    "Scheme of the destination, one of [http, https]",
+				Category: "TARGET",
+			},
+			&cli.StringFlag{
+				Name:     "target-base-path",
+				Usage:    "Path prepended to the paths of the requests to the destination, e.g. /lab",
+				Category: "TARGET",
+			},
+			&cli.BoolFlag{
+				Name:     "target-insecure-skip-verify",
+				Usage:    "Accept any certificate of the https destination",
+				Category: "TARGET",
+			},
+			&cli.StringFlag{
+				Name:     "target-ca",
+				Usage:    "File of the PEM certificates verifying the https destination",
+				Category: "TARGET",
+			},
+			&cli.StringFlag{
+				Name:     "target-cert",
+				Usage:    "File of the PEM client certificate presented to the https destination",
+				Category: "TARGET",
+			},
+			&cli.StringFlag{
+				Name:     "target-key",
+				Usage:    "File of the PEM private key of --target-cert",
+				Category: "TARGET",
+			},
+			&cli.StringFlag{
+				Name:     "target-server-name",
+				Usage:    "Name verified in the certificate of the https destination, instead of node",
+				Category: "TARGET",
+			},
+		}, accessFlags()...),
 		Action: ProxyCreateAction,
 	}
 
@@ -81,6 +233,7 @@ func ProxyCreateCmd() *cli.Command {
 func ProxyCreateAction(cCtx *cli.Context) error {
 	proxy := &batproxy.Proxy{
 		ID:         cCtx.String("name"),
+		Type:       cCtx.String("type"),
 		User:       cCtx.String("user"),
 		Host:       cCtx.String("host"),
 		PrivateKey: cCtx.String("private-key"),
@@ -88,7 +241,113 @@ func ProxyCreateAction(cCtx *cli.Context) error {
 		Password:   cCtx.String("password"),
 		Node:       cCtx.String("node"),
 		Port:       uint16(cCtx.Uint("port")),
+		Socket:     cCtx.String("socket"),
+
+		TOTPSecret:         cCtx.String("totp-secret"),
+		Certificate:        cCtx.String("certificate"),
+		SignCertificate:    cCtx.Bool("sign-certificate"),
+		Agent:              cCtx.Bool("agent"),
+		AgentKeyFilter:     cCtx.String("agent-key-filter"),
+		HostKeyFingerprint: cCtx.String("host-key-fingerprint"),
+		Upstream:           cCtx.String("upstream"),
+	}
+	for _, jump := range cCtx.StringSlice("jump") {
+		ss := strings.SplitN(jump, "@", 2)
+		if len(ss) < 2 {
+			return batproxy.Errorf(batproxy.EINVALID, "invalid jump host %s, expect user@host[:port]", jump)
+		}
+		proxy.JumpHosts = append(proxy.JumpHosts, &batproxy.JumpHost{
+			User:       ss[0],
+			Host:       ss[1],
+			PrivateKey: proxy.PrivateKey,
+			Passphrase: proxy.Passphrase,
+			Password:   proxy.Password,
+			TOTPSecret: proxy.TOTPSecret,
+
+			Certificate:     proxy.Certificate,
+			SignCertificate: proxy.SignCertificate,
+			Agent:           proxy.Agent,
+			AgentKeyFilter:  proxy.AgentKeyFilter,
+		})
+	}
+	sshOpts := &batproxy.SSHOptions{
+		ServerAliveCountMax: uint32(cCtx.Uint("server-alive-count-max")),
+		Forward:             cCtx.String("forward"),
+		RelayCommand:        cCtx.String("relay-command"),
+		RelayUnixCommand:    cCtx.String("relay-unix-command"),
+	}
+	for name, v := range map[string]*int64{
+		"connect-timeout":       &sshOpts.ConnectTimeout,
+		"server-alive-interval": &sshOpts.ServerAliveInterval,
+		"retry-min":             &sshOpts.RetryMin,
+		"retry-max":             &sshOpts.RetryMax,
+	} {
+		if !cCtx.IsSet(name) {
+			continue
+		}
+		n, err := seconds(cCtx, name)
+		if err != nil {
+			return err
+		}
+		*v = n
+	}
+	if *sshOpts != (batproxy.SSHOptions{}) {
+		proxy.SSHOptions = sshOpts
 	}
+	if cCtx.IsSet("slurm-job") {
+		proxy.SlurmJob = &batproxy.SlurmJob{
+			JobID:  cCtx.String("slurm-job"),
+			Expire: cCtx.Bool("slurm-expire"),
+		}
+	}
+	if cCtx.IsSet("resolve-command") {
+		proxy.Resolver = &batproxy.Resolver{
+			Command: cCtx.String("resolve-command"),
+			Regexp:  cCtx.String("resolve-regexp"),
+		}
+		if cCtx.IsSet("resolve-ttl") {
+			d, err := time.ParseDuration(cCtx.String("resolve-ttl"))
+			if err != nil {
+				return err
+			}
+			proxy.Resolver.TTL = int64(d / time.Second)
+		}
+	}
+	if cCtx.IsSet("target-scheme") || cCtx.IsSet("target-base-path") {
+		proxy.Target = &batproxy.Target{
+			Scheme:   cCtx.String("target-scheme"),
+			BasePath: cCtx.String("target-base-path"),
+		}
+	}
+	tlsOpts := &batproxy.TargetTLS{
+		InsecureSkipVerify: cCtx.Bool("target-insecure-skip-verify"),
+		ServerName:         cCtx.String("target-server-name"),
+	}
+	for name, v := range map[string]*string{
+		"target-ca":   &tlsOpts.CA,
+		"target-cert": &tlsOpts.Certificate,
+		"target-key":  &tlsOpts.PrivateKey,
+	} {
+		if !cCtx.IsSet(name) {
+			continue
+		}
+		buf, err := os.ReadFile(cCtx.String(name))
+		if err != nil {
+			return err
+		}
+		*v = string(buf)
+	}
+	if *tlsOpts != (batproxy.TargetTLS{}) {
+		if proxy.Target == nil {
+			proxy.Target = &batproxy.Target{}
+		}
+		proxy.Target.TLS = tlsOpts
+	}
+	access, err := accessFromFlags(cCtx)
+	if err != nil {
+		return err
+	}
+	proxy.Access = access
 	if err := proxy.Validate(); err != nil {
 		return err
 	}
@@ -109,8 +368,17 @@ func ProxyCreateAction(cCtx *cli.Context) error {
 	}
 
 	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-	fmt.Fprintf(tw, "NAME\tUSER\tHOST\tNODE\tPORT\n")
-	fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\n", proxy.ID, proxy.User, proxy.Host, proxy.Node, proxy.Port)
+	fmt.Fprintf(tw, "NAME\tUSER\tHOST\tNODE\tPORT\tSOCKET\tLISTEN\n")
+	fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", proxy.ID, proxy.User, proxy.Host, proxy.Node, proxy.Port, proxy.Socket, listenPort(proxy))
 
 	return tw.Flush()
 }
+
+// listenPort formats the port allocated to a tcp proxy, empty for the other
+// ones.
+func listenPort(p *batproxy.Proxy) string {
+	if p.ListenPort == 0 {
+		return ""
+	}
+	return strconv.Itoa(int(p.ListenPort))
+}
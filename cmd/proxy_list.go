@@ -57,9 +57,9 @@ func ProxiesListAction(cCtx *cli.Context) error {
 	}
 
 	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-	fmt.Fprintf(tw, "NAME\tUSER\tHOST\tNODE\tPORT\n")
+	fmt.Fprintf(tw, "NAME\tUSER\tHOST\tNODE\tPORT\tSOCKET\tLISTEN\n")
 	for _, p := range page.Proxies {
-		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\n", p.ID, p.User, p.Host, p.Node, p.Port)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", p.ID, p.User, p.Host, p.Node, p.Port, p.Socket, listenPort(p))
 	}
 
 	return tw.Flush()
@@ -13,7 +13,10 @@ import (
 	"github.com/batx-dev/batproxy/http"
 	"github.com/batx-dev/batproxy/logger"
 	"github.com/batx-dev/batproxy/sql"
+	"github.com/batx-dev/batproxy/ssh"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/acme"
+	gossh "golang.org/x/crypto/ssh"
 )
 
 func RunCmd() *cli.Command {
@@ -29,6 +32,84 @@ func RunCmd() *cli.Command {
 				Aliases: []string{"r"},
 				EnvVars: []string{"BATPROXY_REVERSE_LISTEN"},
 			},
+			&cli.StringFlag{
+				Name:    "tls-cert",
+				Usage:   "The default certificate of the reverse proxy, e.g. a wildcard one for the suffix, serves https with --tls-key",
+				EnvVars: []string{"BATPROXY_TLS_CERT"},
+			},
+			&cli.StringFlag{
+				Name:    "tls-key",
+				Usage:   "The private key of --tls-cert",
+				EnvVars: []string{"BATPROXY_TLS_KEY"},
+			},
+			&cli.StringFlag{
+				Name:    "tls-cert-dir",
+				Usage:   "The directory of the per proxy or per domain certificates, <name>.crt and <name>.key, selected by SNI",
+				EnvVars: []string{"BATPROXY_TLS_CERT_DIR"},
+			},
+			&cli.StringFlag{
+				Name:    "tls-reload-interval",
+				Usage:   "The interval of checking the certificate files for changes",
+				Value:   http.DefaultCertificatesReloadInterval.String(),
+				EnvVars: []string{"BATPROXY_TLS_RELOAD_INTERVAL"},
+			},
+			&cli.StringFlag{
+				Name:    "redirect-listen",
+				Usage:   "The http listen address redirecting to the https reverse proxy, e.g. :80, answers the ACME HTTP-01 challenges",
+				EnvVars: []string{"BATPROXY_REDIRECT_LISTEN"},
+			},
+			&cli.BoolFlag{
+				Name:    "acme",
+				Usage:   "Obtain the certificates of the proxies not covered by --tls-cert or --tls-cert-dir from an ACME server, stored in the database",
+				EnvVars: []string{"BATPROXY_ACME"},
+			},
+			&cli.StringFlag{
+				Name:    "acme-directory",
+				Usage:   "The directory URL of the ACME server",
+				Value:   acme.LetsEncryptURL,
+				EnvVars: []string{"BATPROXY_ACME_DIRECTORY"},
+			},
+			&cli.StringFlag{
+				Name:    "acme-email",
+				Usage:   "The contact email of the ACME account",
+				EnvVars: []string{"BATPROXY_ACME_EMAIL"},
+			},
+			&cli.StringFlag{
+				Name:    "acme-ca-cert",
+				Usage:   "The CA certificate trusted to reach the ACME server, e.g. the one of a local Pebble",
+				EnvVars: []string{"BATPROXY_ACME_CA_CERT"},
+			},
+			&cli.StringFlag{
+				Name:    "public-url",
+				Usage:   "The URL users reach the reverse proxy with, e.g. https://example.com, the launched applications are on its subdomains",
+				EnvVars: []string{"BATPROXY_PUBLIC_URL"},
+			},
+			&cli.StringFlag{
+				Name:    "access-secret",
+				Usage:   "The secret signing the access cookies of the proxies, shared by the replicas, random on each start if empty",
+				EnvVars: []string{"BATPROXY_ACCESS_SECRET"},
+			},
+			&cli.StringFlag{
+				Name:    "tcp-ports",
+				Usage:   "The range of ports allocated to the tcp proxies, <min>-<max>, e.g. 20000-20999",
+				EnvVars: []string{"BATPROXY_TCP_PORTS"},
+			},
+			&cli.StringFlag{
+				Name:    "tcp-host",
+				Usage:   "The host the tcp proxies listen on, all the interfaces if empty",
+				EnvVars: []string{"BATPROXY_TCP_HOST"},
+			},
+			&cli.StringFlag{
+				Name:    "tcp-sync-interval",
+				Usage:   "The interval of syncing the tcp listeners with the proxies created or deleted through the other replicas, 0 syncs them on start only",
+				Value:   "10s",
+				EnvVars: []string{"BATPROXY_TCP_SYNC_INTERVAL"},
+			},
+			&cli.BoolFlag{
+				Name:    "path-routing",
+				Usage:   "Route the requests of /p/<proxy id>/ by path instead of by host, for deployments without wildcard DNS",
+				EnvVars: []string{"BATPROXY_PATH_ROUTING"},
+			},
 			&cli.StringFlag{
 				Name:    "listen",
 				Usage:   "The manager proxy listen address",
@@ -75,6 +156,152 @@ func RunCmd() *cli.Command {
 				Aliases: []string{"e"},
 				EnvVars: []string{"BATPROXY_EXPIRATION"},
 			},
+			&cli.StringFlag{
+				Name:    "access-expiration",
+				Usage:   "The time of expiration of the proxy rules with an access, bounding how long the replaced credentials are accepted by the other replicas",
+				Value:   "5s",
+				EnvVars: []string{"BATPROXY_ACCESS_EXPIRATION"},
+			},
+			&cli.StringFlag{
+				Name:    "ssh-idle-timeout",
+				Usage:   "The time after which an unused ssh connection is closed, 0 keeps it open",
+				Value:   "30m",
+				EnvVars: []string{"BATPROXY_SSH_IDLE_TIMEOUT"},
+			},
+			&cli.StringFlag{
+				Name:    "host-key-policy",
+				Usage:   "The ssh host key policy for proxies without a pinned fingerprint, one of [strict, tofu]",
+				Value:   batproxy.HostKeyPolicyTOFU,
+				EnvVars: []string{"BATPROXY_HOST_KEY_POLICY"},
+				Action: func(c *cli.Context, s string) error {
+					switch s {
+					case batproxy.HostKeyPolicyStrict, batproxy.HostKeyPolicyTOFU:
+						return nil
+					default:
+						return batproxy.Errorf(batproxy.EINVALID, "host key policy: %s", s)
+					}
+				},
+			},
+			&cli.StringSliceFlag{
+				Name:    "known-hosts",
+				Usage:   "The known_hosts files trusted besides the database",
+				EnvVars: []string{"BATPROXY_KNOWN_HOSTS"},
+			},
+			&cli.StringFlag{
+				Name:    "ssh-auth-sock",
+				Usage:   "The ssh-agent socket used by proxies authenticating with the agent",
+				EnvVars: []string{"BATPROXY_SSH_AUTH_SOCK", "SSH_AUTH_SOCK"},
+			},
+			&cli.StringFlag{
+				Name:    "ssh-ca-key",
+				Usage:   "The private key file of the ssh certificate authority signing proxy certificates",
+				EnvVars: []string{"BATPROXY_SSH_CA_KEY"},
+			},
+			&cli.StringFlag{
+				Name:    "ssh-ca-validity",
+				Usage:   "The validity of signed ssh certificates",
+				Value:   "1h",
+				EnvVars: []string{"BATPROXY_SSH_CA_VALIDITY"},
+			},
+			&cli.StringFlag{
+				Name:    "ssh-upstream",
+				Usage:   "The SOCKS5 or HTTP CONNECT proxy to reach ssh servers through, <socks5|socks5h|http>://[user:password@]host:port",
+				EnvVars: []string{"BATPROXY_SSH_UPSTREAM"},
+				Action: func(c *cli.Context, s string) error {
+					if _, err := batproxy.ParseUpstream(s); err != nil {
+						return batproxy.Errorf(batproxy.EINVALID, "%v", err)
+					}
+					return nil
+				},
+			},
+			&cli.StringFlag{
+				Name:    "ssh-connect-timeout",
+				Usage:   "The maximum time to connect to an ssh server, retries included",
+				Value:   ssh.DefaultConnectTimeout.String(),
+				EnvVars: []string{"BATPROXY_SSH_CONNECT_TIMEOUT"},
+			},
+			&cli.StringFlag{
+				Name:    "ssh-server-alive-interval",
+				Usage:   "The interval of the keepalive requests sent to ssh servers",
+				Value:   ssh.DefaultServerAliveInterval.String(),
+				EnvVars: []string{"BATPROXY_SSH_SERVER_ALIVE_INTERVAL"},
+			},
+			&cli.UintFlag{
+				Name:    "ssh-server-alive-count-max",
+				Usage:   "The number of unanswered keepalive requests after which an ssh connection is closed",
+				Value:   3,
+				EnvVars: []string{"BATPROXY_SSH_SERVER_ALIVE_COUNT_MAX"},
+			},
+			&cli.StringFlag{
+				Name:    "ssh-retry-min",
+				Usage:   "The delay before retrying to reach an ssh server, doubled on every retry",
+				Value:   "1s",
+				EnvVars: []string{"BATPROXY_SSH_RETRY_MIN"},
+			},
+			&cli.StringFlag{
+				Name:    "ssh-retry-max",
+				Usage:   "The maximum delay between retries to reach an ssh server",
+				Value:   "1m",
+				EnvVars: []string{"BATPROXY_SSH_RETRY_MAX"},
+			},
+			&cli.StringFlag{
+				Name:    "ssh-forward",
+				Usage:   "How streams reach their destination, one of [direct, stdio, auto], stdio relays them through --ssh-relay-command for servers disabling tcp forwarding, auto once forwarding was refused",
+				Value:   ssh.ForwardDirect,
+				EnvVars: []string{"BATPROXY_SSH_FORWARD"},
+			},
+			&cli.StringFlag{
+				Name:    "ssh-relay-command",
+				Usage:   "The command run on the login host relaying streams to %h:%p",
+				Value:   ssh.DefaultRelayCommand,
+				EnvVars: []string{"BATPROXY_SSH_RELAY_COMMAND"},
+			},
+			&cli.StringFlag{
+				Name:    "ssh-relay-unix-command",
+				Usage:   "The command run on the login host relaying streams to the unix domain socket %h",
+				Value:   ssh.DefaultRelayUnixCommand,
+				EnvVars: []string{"BATPROXY_SSH_RELAY_UNIX_COMMAND"},
+			},
+			&cli.IntFlag{
+				Name:    "ssh-pool-size",
+				Usage:   "The maximum number of ssh connections to a login host, opened when it refuses more streams",
+				Value:   ssh.DefaultPoolSize,
+				EnvVars: []string{"BATPROXY_SSH_POOL_SIZE"},
+			},
+			&cli.StringFlag{
+				Name:    "ssh-pool-idle-timeout",
+				Usage:   "The time after which an extra ssh connection to a login host without streams is closed",
+				Value:   ssh.DefaultPoolIdleTimeout.String(),
+				EnvVars: []string{"BATPROXY_SSH_POOL_IDLE_TIMEOUT"},
+			},
+			&cli.StringSliceFlag{
+				Name:    "ssh-prompt-rule",
+				Usage:   "The keyboard-interactive prompt rule <host glob>;<prompt regexp>;<password|totp>, tried in order before the defaults",
+				EnvVars: []string{"BATPROXY_SSH_PROMPT_RULE"},
+			},
+			&cli.IntFlag{
+				Name:    "ssh-max-conns",
+				Usage:   "The maximum number of login hosts kept connected, each with up to --ssh-pool-size ssh connections, 0 means no limit",
+				EnvVars: []string{"BATPROXY_SSH_MAX_CONNS"},
+			},
+			&cli.IntFlag{
+				Name:    "backend-max-idle-conns",
+				Usage:   "The maximum number of idle connections kept to the destination of a proxy",
+				Value:   http.DefaultTransportMaxIdleConns,
+				EnvVars: []string{"BATPROXY_BACKEND_MAX_IDLE_CONNS"},
+			},
+			&cli.StringFlag{
+				Name:    "backend-idle-timeout",
+				Usage:   "The time after which an idle connection to the destination of a proxy is closed",
+				Value:   http.DefaultTransportIdleTimeout.String(),
+				EnvVars: []string{"BATPROXY_BACKEND_IDLE_TIMEOUT"},
+			},
+			&cli.StringFlag{
+				Name:    "slurm-poll-interval",
+				Usage:   "The interval of checking the slurm jobs of the proxies expiring with them, 0 checks them on requests only",
+				Value:   "1m",
+				EnvVars: []string{"BATPROXY_SLURM_POLL_INTERVAL"},
+			},
 		},
 		Action: RunAction,
 	}
@@ -98,12 +325,126 @@ func RunAction(cCtx *cli.Context) error {
 	suffix := cCtx.String("suffix")
 
 	expiration := cCtx.String("expiration")
+	accessExpiration := cCtx.String("access-expiration")
+
+	sshIdleTimeout := cCtx.String("ssh-idle-timeout")
 
 	server, err := http.NewServer(reverseListen, listen, ll.With("module", "http"))
 	if err != nil {
 		return err
 	}
 
+	if server.IdleTimeout, err = time.ParseDuration(sshIdleTimeout); err != nil {
+		return err
+	}
+	server.MaxConns = cCtx.Int("ssh-max-conns")
+	server.Upstream = cCtx.String("ssh-upstream")
+	server.PoolSize = cCtx.Int("ssh-pool-size")
+	if server.PoolIdleTimeout, err = time.ParseDuration(cCtx.String("ssh-pool-idle-timeout")); err != nil {
+		return err
+	}
+	if server.JobPollInterval, err = time.ParseDuration(cCtx.String("slurm-poll-interval")); err != nil {
+		return err
+	}
+	server.TransportMaxIdleConns = cCtx.Int("backend-max-idle-conns")
+	if server.TransportIdleTimeout, err = time.ParseDuration(cCtx.String("backend-idle-timeout")); err != nil {
+		return err
+	}
+
+	{
+		opts := batproxy.SSHOptions{
+			ServerAliveCountMax: uint32(cCtx.Uint("ssh-server-alive-count-max")),
+			Forward:             cCtx.String("ssh-forward"),
+			RelayCommand:        cCtx.String("ssh-relay-command"),
+			RelayUnixCommand:    cCtx.String("ssh-relay-unix-command"),
+		}
+		for name, v := range map[string]*int64{
+			"ssh-connect-timeout":       &opts.ConnectTimeout,
+			"ssh-server-alive-interval": &opts.ServerAliveInterval,
+			"ssh-retry-min":             &opts.RetryMin,
+			"ssh-retry-max":             &opts.RetryMax,
+		} {
+			if *v, err = seconds(cCtx, name); err != nil {
+				return err
+			}
+		}
+		if err := opts.Validate(); err != nil {
+			return batproxy.Errorf(batproxy.EINVALID, "%v", err)
+		}
+		server.SSHOptions = opts
+	}
+
+	{
+		breakers := ssh.NewBreakers(ll.With("module", "ssh"))
+		server.Breakers = breakers
+		server.BreakerService = logger.NewBreakerService(breakers, ll.With("module", "logger"))
+	}
+
+	{
+		conns := ssh.NewConnections(ll.With("module", "ssh"))
+		server.Connections = conns
+		server.ConnectionService = logger.NewConnectionService(conns, ll.With("module", "logger"))
+	}
+
+	if cCtx.String("tls-cert") != "" || cCtx.String("tls-key") != "" || cCtx.String("tls-cert-dir") != "" {
+		certs := &http.Certificates{
+			CertFile: cCtx.String("tls-cert"),
+			KeyFile:  cCtx.String("tls-key"),
+			Dir:      cCtx.String("tls-cert-dir"),
+			Logger:   ll.With("module", "http"),
+		}
+		if err := certs.Load(); err != nil {
+			return err
+		}
+		server.Certificates = certs
+		if server.CertificatesReloadInterval, err = time.ParseDuration(cCtx.String("tls-reload-interval")); err != nil {
+			return err
+		}
+	}
+	server.RedirectAddr = cCtx.String("redirect-listen")
+	if server.RedirectAddr != "" && server.Certificates == nil && !cCtx.Bool("acme") {
+		return batproxy.Errorf(batproxy.EINVALID, "redirect-listen requires tls-cert, tls-cert-dir or acme")
+	}
+
+	server.PublicURL = cCtx.String("public-url")
+	server.PathRouting = cCtx.Bool("path-routing")
+	server.TCPHost = cCtx.String("tcp-host")
+	if secret := cCtx.String("access-secret"); secret != "" {
+		server.AccessSecret = []byte(secret)
+	}
+	if server.TCPSyncInterval, err = time.ParseDuration(cCtx.String("tcp-sync-interval")); err != nil {
+		return err
+	}
+	server.LaunchService = logger.NewLaunchService(server.Launcher(), ll.With("module", "logger"))
+
+	if sock := cCtx.String("ssh-auth-sock"); sock != "" {
+		server.Agent = &ssh.Agent{Socket: sock}
+	}
+
+	if caKey := cCtx.String("ssh-ca-key"); caKey != "" {
+		buf, err := os.ReadFile(caKey)
+		if err != nil {
+			return err
+		}
+		signer, err := gossh.ParsePrivateKey(buf)
+		if err != nil {
+			return batproxy.Errorf(batproxy.EINVALID, "ssh ca key: %v", err)
+		}
+		validity, err := time.ParseDuration(cCtx.String("ssh-ca-validity"))
+		if err != nil {
+			return err
+		}
+		server.CA = &ssh.CertificateAuthority{Signer: signer, Validity: validity}
+	}
+
+	for _, s := range cCtx.StringSlice("ssh-prompt-rule") {
+		rule, err := ssh.ParsePromptRule(s)
+		if err != nil {
+			return batproxy.Errorf(batproxy.EINVALID, "%v", err)
+		}
+		server.PromptRules = append(server.PromptRules, rule)
+	}
+
 	db := sql.NewDB(dsn)
 	if err := db.Open(); err != nil {
 		return err
@@ -115,21 +456,87 @@ func RunAction(cCtx *cli.Context) error {
 		if err != nil {
 			return err
 		}
-		psvc = sql.NewProxyService(db, sql.ProxyServiceOptions{Suffix: suffix})
-		psvc = cache.NewProxyService(psvc, cache.ProxyServiceOptions{ProxyExpiration: duration})
-		psvc = logger.NewProxyService(psvc, ll.With("module", "logger"))
+		accessDuration, err := time.ParseDuration(accessExpiration)
+		if err != nil {
+			return err
+		}
+		var tcpPorts batproxy.PortRange
+		if s := cCtx.String("tcp-ports"); s != "" {
+			if tcpPorts, err = batproxy.ParsePortRange(s); err != nil {
+				return batproxy.Errorf(batproxy.EINVALID, "%v", err)
+			}
+		}
+		psvc = sql.NewProxyService(db, sql.ProxyServiceOptions{
+			Suffix:           suffix,
+			TCPPorts:         tcpPorts,
+			TCPPortAvailable: server.TCPPortAvailable,
+		})
+		csvc := cache.NewProxyService(psvc, cache.ProxyServiceOptions{
+			ProxyExpiration:  duration,
+			AccessExpiration: accessDuration,
+		})
+		psvc = logger.NewProxyService(csvc, ll.With("module", "logger"))
+		server.CacheService = logger.NewCacheService(csvc, ll.With("module", "logger"))
 	}
 
 	server.ProxyService = psvc
 
+	if cCtx.Bool("acme") {
+		if server.ACME, err = server.NewACME(http.ACMEOptions{
+			DirectoryURL: cCtx.String("acme-directory"),
+			Email:        cCtx.String("acme-email"),
+			CAFile:       cCtx.String("acme-ca-cert"),
+			Cache:        sql.NewCertCache(db),
+		}); err != nil {
+			return err
+		}
+	}
+
+	{
+		ksvc := logger.NewKnownHostService(sql.NewKnownHostService(db), ll.With("module", "logger"))
+		server.KnownHostService = ksvc
+		server.HostKeys = &ssh.HostKeys{
+			Policy:  cCtx.String("host-key-policy"),
+			Files:   cCtx.StringSlice("known-hosts"),
+			Service: ksvc,
+			Logger:  ll.With("module", "ssh"),
+		}
+	}
+
 	if err := server.Open(); err != nil {
 		return err
 	}
 
 	ll.Info("run", "module", "main", "reverse-listen", reverseListen)
 	ll.Info("run", "module", "main", "listen", listen)
+	ll.Info("run", "module", "main", "public-url", server.PublicURL)
+	ll.Info("run", "module", "main", "path-routing", server.PathRouting)
+	ll.Info("run", "module", "main", "tcp-ports", cCtx.String("tcp-ports"))
+	ll.Info("run", "module", "main", "tls-cert", cCtx.String("tls-cert"))
+	ll.Info("run", "module", "main", "tls-cert-dir", cCtx.String("tls-cert-dir"))
+	ll.Info("run", "module", "main", "redirect-listen", server.RedirectAddr)
+	if server.ACME != nil {
+		ll.Info("run", "module", "main", "acme-directory", server.ACME.Client.DirectoryURL)
+	}
 	ll.Info("run", "module", "main", "suffix", suffix)
 	ll.Info("run", "module", "main", "expiration", expiration)
+	ll.Info("run", "module", "main", "access-expiration", accessExpiration)
+	ll.Info("run", "module", "main", "ssh-idle-timeout", sshIdleTimeout)
+	ll.Info("run", "module", "main", "ssh-max-conns", server.MaxConns)
+	if u, err := batproxy.ParseUpstream(server.Upstream); err == nil {
+		ll.Info("run", "module", "main", "ssh-upstream", u.Redacted())
+	}
+	ll.Info("run", "module", "main", "ssh-options", server.SSHOptions)
+	ll.Info("run", "module", "main", "ssh-pool-size", server.PoolSize)
+	ll.Info("run", "module", "main", "ssh-pool-idle-timeout", server.PoolIdleTimeout)
+	ll.Info("run", "module", "main", "host-key-policy", server.HostKeys.Policy)
+	ll.Info("run", "module", "main", "ssh-auth-sock", cCtx.String("ssh-auth-sock"))
+	ll.Info("run", "module", "main", "ssh-ca-key", cCtx.String("ssh-ca-key"))
+	ll.Info("run", "module", "main", "ssh-prompt-rule", cCtx.StringSlice("ssh-prompt-rule"))
+	ll.Info("run", "module", "main", "slurm-poll-interval", server.JobPollInterval)
+	ll.Info("run", "module", "main", "tcp-sync-interval", server.TCPSyncInterval)
+	ll.Info("run", "module", "main", "backend-max-idle-conns", server.TransportMaxIdleConns)
+	ll.Info("run", "module", "main", "backend-idle-timeout", server.TransportIdleTimeout)
 
 	<-ctx.Done()
 
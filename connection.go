@@ -0,0 +1,57 @@
+package batproxy
+
+import (
+	"context"
+	"time"
+)
+
+type Connection struct {
+	// ID Unique id of the live ssh connection.
+	ID string `json:"connection_id"`
+
+	// User SSH login name.
+	User string `json:"user"`
+
+	// Host SSH server.
+	// Format: <host>:<port>
+	Host string `json:"host"`
+
+	// Via Jump hosts the connection goes through, user@host separated by
+	// " via ", the closest first.
+	Via string `json:"via,omitempty"`
+
+	// Slot Index of the connection in the pool of user@host.
+	Slot int `json:"slot"`
+
+	// Age Seconds since the connection was established.
+	Age int64 `json:"age"`
+
+	// Channels Number of open streams.
+	Channels int64 `json:"channels"`
+
+	// BytesRead Bytes received from the ssh server.
+	BytesRead uint64 `json:"bytes_read"`
+
+	// BytesWritten Bytes sent to the ssh server.
+	BytesWritten uint64 `json:"bytes_written"`
+
+	// CreateTime Time the connection was established.
+	CreateTime time.Time `json:"create_time"`
+
+	// LastKeepaliveTime Time the last keepalive was answered, zero if none
+	// was yet.
+	LastKeepaliveTime time.Time `json:"last_keepalive_time"`
+}
+
+type ListConnectionsPage struct {
+	Connections []*Connection `json:"connections"`
+}
+
+// ConnectionService manages the live ssh connections.
+type ConnectionService interface {
+	ListConnections(ctx context.Context) (*ListConnectionsPage, error)
+
+	// CloseConnection closes the connection with its streams, the next
+	// request through it dials again.
+	CloseConnection(ctx context.Context, id string) error
+}
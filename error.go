@@ -19,6 +19,27 @@ const (
 	EUNAUTHORIZED   = "unauthorized"
 	EFORBIDDEN      = "forbidden"
 	EBADGATEWAY     = "bad_gateway"
+	EUNAVAILABLE    = "unavailable"
+
+	// EHOSTKEY refines EBADGATEWAY, the ssh server presented a host key that
+	// is not trusted.
+	EHOSTKEY = "host_key_mismatch"
+
+	// ESSHAUTH refines EBADGATEWAY, the ssh server rejected the credentials
+	// or asked for one that is not configured.
+	ESSHAUTH = "ssh_auth_failed"
+
+	// ECIRCUITOPEN refines EBADGATEWAY, the ssh server failed to be reached
+	// recently and is not tried again before its next retry.
+	ECIRCUITOPEN = "circuit_open"
+
+	// EJOBPENDING refines EUNAVAILABLE, the scheduler job running the
+	// destination has not started yet.
+	EJOBPENDING = "job_pending"
+
+	// EJOBENDED refines ENOTFOUND, the scheduler job running the destination
+	// has ended.
+	EJOBENDED = "job_ended"
 )
 
 // Error represents an application-specific error. Application errors can be
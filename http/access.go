@@ -0,0 +1,176 @@
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/batx-dev/batproxy"
+)
+
+// Names of the access credentials of the proxies in requests.
+const (
+	AccessCookieName = "batproxy_access"
+	AccessTokenParam = "batproxy_token"
+)
+
+// authorize checks req carries a credential of the access of p, answering
+// the request itself otherwise. The credentials are removed from req, so the
+// destination never sees them.
+func (s *Server) authorize(w http.ResponseWriter, req *http.Request, p *batproxy.Proxy, prefix string) bool {
+	access := p.Access
+	if !access.Enabled() {
+		return true
+	}
+
+	// the token never reaches the destination, even along a valid cookie
+	query := req.URL.Query()
+	token := query.Get(AccessTokenParam)
+	if token != "" {
+		query.Del(AccessTokenParam)
+		req.URL.RawQuery = query.Encode()
+	}
+
+	ok := s.validAccessCookie(req, p.ID, access)
+	stripAccessCookie(req)
+	if ok {
+		return true
+	}
+
+	if token != "" {
+		for _, t := range access.QueryTokens {
+			if t.Verify(token) {
+				s.setAccessCookie(w, req, p.ID, prefix, t.TokenHash, access)
+				// drop the token from the address bar
+				http.Redirect(w, req, req.URL.RequestURI(), http.StatusFound)
+				return false
+			}
+		}
+	}
+
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+			token := auth[7:]
+			for _, t := range access.BearerTokens {
+				if t.Verify(token) {
+					req.Header.Del("Authorization")
+					return true
+				}
+			}
+		}
+		if user, password, ok := req.BasicAuth(); ok {
+			for _, u := range access.BasicAuth {
+				if u.User == user && u.Verify(password) {
+					req.Header.Del("Authorization")
+					// spare bcrypt to the next requests of browsers
+					s.setAccessCookie(w, req, p.ID, prefix, u.PasswordHash, access)
+					return true
+				}
+			}
+		}
+	}
+
+	if len(access.BasicAuth) > 0 {
+		w.Header().Set("WWW-Authenticate", `Basic realm="`+p.ID+`", charset="UTF-8"`)
+	}
+	Error(w, req, batproxy.Errorf(batproxy.EUNAUTHORIZED, "unauthorized"))
+	return false
+}
+
+// setAccessCookie lets the browser in until the cookie expires. It is signed
+// with AccessSecret, so the replicas sharing it accept it, over the hash of
+// the credential it was exchanged for, so changing the credential revokes
+// it.
+func (s *Server) setAccessCookie(w http.ResponseWriter, req *http.Request, proxyID string, prefix string, hash string, access *batproxy.Access) {
+	expire := time.Now().Add(access.CookieExpiration())
+	exp := strconv.FormatInt(expire.Unix(), 10)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     AccessCookieName,
+		Value:    exp + "." + s.accessMAC(hash, proxyID, exp),
+		Path:     prefix + "/",
+		Expires:  expire,
+		Secure:   req.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// validAccessCookie reports whether req carries an unexpired access cookie
+// signed for a credential of access.
+func (s *Server) validAccessCookie(req *http.Request, proxyID string, access *batproxy.Access) bool {
+	for _, cookie := range req.Cookies() {
+		if cookie.Name != AccessCookieName {
+			continue
+		}
+		exp, mac, ok := strings.Cut(cookie.Value, ".")
+		if !ok {
+			continue
+		}
+		expire, err := strconv.ParseInt(exp, 10, 64)
+		if err != nil || time.Now().Unix() > expire {
+			continue
+		}
+
+		for _, t := range access.QueryTokens {
+			if hmac.Equal([]byte(mac), []byte(s.accessMAC(t.TokenHash, proxyID, exp))) {
+				return true
+			}
+		}
+		for _, u := range access.BasicAuth {
+			if hmac.Equal([]byte(mac), []byte(s.accessMAC(u.PasswordHash, proxyID, exp))) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// accessMAC signs the cookie of proxyID expiring at exp for the credential of
+// hash. The hashes are stored and returned by the API, only the secret keeps
+// the cookies from being forged.
+func (s *Server) accessMAC(hash string, proxyID string, exp string) string {
+	mac := hmac.New(sha256.New, s.AccessSecret)
+	mac.Write([]byte(hash + "|" + proxyID + "|" + exp))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// stripAccessCookie removes the access cookies from the Cookie headers of
+// req, keeping the other cookies of the application.
+func stripAccessCookie(req *http.Request) {
+	values := req.Header.Values("Cookie")
+	if len(values) == 0 {
+		return
+	}
+
+	var kept []string
+	for _, value := range values {
+		for _, part := range strings.Split(value, ";") {
+			part = strings.TrimSpace(part)
+			if part == "" || strings.HasPrefix(part, AccessCookieName+"=") {
+				continue
+			}
+			kept = append(kept, part)
+		}
+	}
+
+	req.Header.Del("Cookie")
+	if len(kept) > 0 {
+		req.Header.Set("Cookie", strings.Join(kept, "; "))
+	}
+}
+
+// newAccessSecret returns a random AccessSecret.
+func newAccessSecret() ([]byte, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("access secret: %v", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,208 @@
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/batx-dev/batproxy"
+)
+
+// accessProxy returns a proxy of id allowing alice, a bearer token and a
+// query token in.
+func accessProxy(t *testing.T, id string) *batproxy.Proxy {
+	t.Helper()
+
+	access := &batproxy.Access{
+		BasicAuth:    []*batproxy.BasicAuthUser{{User: "alice", Password: "secret"}},
+		BearerTokens: []*batproxy.AccessToken{{Token: "bearer"}},
+		QueryTokens:  []*batproxy.AccessToken{{Token: "query"}},
+	}
+	if err := access.Hash(); err != nil {
+		t.Fatal(err)
+	}
+	return &batproxy.Proxy{ID: id, Access: access}
+}
+
+// accessCookie returns the access cookie of id signed by s for hash.
+func accessCookie(t *testing.T, s *Server, id string, hash string, access *batproxy.Access) *http.Cookie {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	s.setAccessCookie(w, httptest.NewRequest("GET", "/", nil), id, "", hash, access)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("cookies = %v, want one access cookie", cookies)
+	}
+	return cookies[0]
+}
+
+func TestAuthorize(t *testing.T) {
+	s := newTestServer(t, newMemProxies())
+	p := accessProxy(t, "p1")
+
+	tests := []struct {
+		name   string
+		url    string
+		header func(req *http.Request)
+		ok     bool
+		status int
+		cookie bool
+		url2   string // the url passed on to the destination, or redirected to
+	}{
+		{
+			name:   "none",
+			url:    "/lab?a=1",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "bearer",
+			url:    "/lab",
+			header: func(req *http.Request) { req.Header.Set("Authorization", "Bearer bearer") },
+			ok:     true,
+			url2:   "/lab",
+		},
+		{
+			name:   "bearer invalid",
+			url:    "/lab",
+			header: func(req *http.Request) { req.Header.Set("Authorization", "Bearer query") },
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "basic",
+			url:    "/lab",
+			header: func(req *http.Request) { req.SetBasicAuth("alice", "secret") },
+			ok:     true,
+			cookie: true,
+			url2:   "/lab",
+		},
+		{
+			name:   "basic invalid",
+			url:    "/lab",
+			header: func(req *http.Request) { req.SetBasicAuth("alice", "bearer") },
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "query",
+			url:    "/lab?a=1&batproxy_token=query",
+			status: http.StatusFound,
+			cookie: true,
+			url2:   "/lab?a=1",
+		},
+		{
+			name:   "query invalid",
+			url:    "/lab?batproxy_token=bearer",
+			status: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://p1.example.com"+tt.url, nil)
+			if tt.header != nil {
+				tt.header(req)
+			}
+			w := httptest.NewRecorder()
+
+			ok := s.authorize(w, req, p, "")
+			if ok != tt.ok {
+				t.Fatalf("authorize = %v, want %v", ok, tt.ok)
+			}
+			res := w.Result()
+			if tt.status != 0 && res.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", res.StatusCode, tt.status)
+			}
+			if got := len(res.Cookies()) == 1; got != tt.cookie {
+				t.Errorf("cookies = %v, want access cookie %v", res.Cookies(), tt.cookie)
+			}
+			if tt.status == http.StatusUnauthorized && res.Header.Get("WWW-Authenticate") == "" {
+				t.Error("WWW-Authenticate missing for the basic auth users")
+			}
+			switch {
+			case ok:
+				if got := req.URL.RequestURI(); got != tt.url2 {
+					t.Errorf("url = %s, want %s", got, tt.url2)
+				}
+				if auth := req.Header.Get("Authorization"); auth != "" {
+					t.Errorf("Authorization = %s passed on to the destination", auth)
+				}
+			case tt.status == http.StatusFound:
+				if got := res.Header.Get("Location"); got != tt.url2 {
+					t.Errorf("Location = %s, want %s", got, tt.url2)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthorizeCookie(t *testing.T) {
+	s := newTestServer(t, newMemProxies())
+	p := accessProxy(t, "p1")
+	cookie := accessCookie(t, s, p.ID, p.Access.QueryTokens[0].TokenHash, p.Access)
+
+	// the token of a stale link is dropped along a valid cookie
+	req := httptest.NewRequest("GET", "http://p1.example.com/lab?a=1&batproxy_token=stale", nil)
+	req.AddCookie(cookie)
+	req.AddCookie(&http.Cookie{Name: "app", Value: "1"})
+	w := httptest.NewRecorder()
+	if !s.authorize(w, req, p, "") {
+		t.Fatalf("authorize with cookie = false, status %d", w.Code)
+	}
+	if got := req.URL.RawQuery; got != "a=1" {
+		t.Errorf("query = %s, want a=1", got)
+	}
+	if got := req.Header.Get("Cookie"); got != "app=1" {
+		t.Errorf("Cookie = %s, want app=1", got)
+	}
+}
+
+func TestAccessCookie(t *testing.T) {
+	s := newTestServer(t, newMemProxies())
+	p := accessProxy(t, "p1")
+	hash := p.Access.BasicAuth[0].PasswordHash
+
+	replica := newTestServer(t, newMemProxies())
+	replica.AccessSecret = s.AccessSecret
+
+	valid := func(s *Server, cookie *http.Cookie, id string, access *batproxy.Access) bool {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(cookie)
+		return s.validAccessCookie(req, id, access)
+	}
+	cookie := accessCookie(t, s, p.ID, hash, p.Access)
+
+	if !valid(s, cookie, p.ID, p.Access) {
+		t.Error("cookie rejected")
+	}
+	if !valid(replica, cookie, p.ID, p.Access) {
+		t.Error("cookie rejected by a replica sharing the secret")
+	}
+	if valid(newTestServer(t, newMemProxies()), cookie, p.ID, p.Access) {
+		t.Error("cookie accepted by a server of another secret")
+	}
+	if valid(s, cookie, "p2", p.Access) {
+		t.Error("cookie accepted by another proxy")
+	}
+	if valid(s, cookie, p.ID, accessProxy(t, p.ID).Access) {
+		t.Error("cookie accepted once the credential changed")
+	}
+
+	exp := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	expired := &http.Cookie{Name: AccessCookieName, Value: exp + "." + s.accessMAC(hash, p.ID, exp)}
+	if valid(s, expired, p.ID, p.Access) {
+		t.Error("expired cookie accepted")
+	}
+
+	// the hashes are returned by the API, they cannot sign cookies
+	exp = strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(hash))
+	mac.Write([]byte(p.ID + "|" + exp))
+	forged := &http.Cookie{Name: AccessCookieName, Value: exp + "." + hex.EncodeToString(mac.Sum(nil))}
+	if valid(s, forged, p.ID, p.Access) {
+		t.Error("cookie signed by the credential hash accepted")
+	}
+}
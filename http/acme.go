@@ -0,0 +1,109 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/batx-dev/batproxy"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+type ACMEOptions struct {
+	// DirectoryURL is the directory of the ACME server. Empty means
+	// Let's Encrypt.
+	DirectoryURL string
+
+	// Email is the contact of the account, optional.
+	Email string
+
+	// CAFile trusts the certificates of this file to reach the ACME
+	// server, e.g. the one of a local Pebble. Empty trusts the system ones.
+	CAFile string
+
+	// Cache stores the account key and the certificates, shared by the
+	// replicas of the server.
+	Cache autocert.Cache
+}
+
+// NewACME returns the manager of the ACME certificates of the proxies,
+// restricted by HostPolicy.
+func (s *Server) NewACME(opts ACMEOptions) (*autocert.Manager, error) {
+	client := &acme.Client{DirectoryURL: opts.DirectoryURL}
+
+	if opts.CAFile != "" {
+		buf, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("acme: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(buf) {
+			return nil, fmt.Errorf("acme: no certificate in %s", opts.CAFile)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+		client.HTTPClient = &http.Client{Transport: transport}
+	}
+
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      opts.Cache,
+		HostPolicy: s.HostPolicy,
+		Email:      opts.Email,
+		Client:     client,
+	}, nil
+}
+
+// HostPolicy allows the ACME certificates only for the hosts that are the
+// id of an http proxy, so nobody can make the server request certificates
+// for arbitrary names, or for the tcp proxies never served over http.
+func (s *Server) HostPolicy(ctx context.Context, host string) error {
+	page, err := s.ProxyService.ListProxies(ctx, batproxy.ListProxiesOptions{
+		ProxyID: strings.ToLower(host),
+	})
+	if err != nil {
+		return err
+	}
+	if len(page.Proxies) == 0 {
+		return batproxy.Errorf(batproxy.ENOTFOUND, "acme: no proxy for host %q", host)
+	}
+	if page.Proxies[0].Type == batproxy.ProxyTCP {
+		return batproxy.Errorf(batproxy.EINVALID, "acme: proxy %q is a tcp one", host)
+	}
+	return nil
+}
+
+// getCertificate returns the certificate of the server name of hello, the
+// ones of Certificates valid for it first, then the ACME one, then the
+// default certificate.
+func (s *Server) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if s.ACME != nil && challenge(hello) {
+		return s.ACME.GetCertificate(hello)
+	}
+
+	if s.Certificates != nil {
+		if cert := s.Certificates.lookup(hello.ServerName); cert != nil {
+			return cert, nil
+		}
+	}
+
+	if s.ACME != nil {
+		cert, err := s.ACME.GetCertificate(hello)
+		if err == nil || s.Certificates == nil {
+			return cert, err
+		}
+		s.logger.Info("acme", "server_name", hello.ServerName, "status", "fallback", "err", err)
+	}
+
+	return s.Certificates.defaultCertificate(hello)
+}
+
+// challenge reports whether hello is the one of a TLS-ALPN-01 challenge.
+func challenge(hello *tls.ClientHelloInfo) bool {
+	return len(hello.SupportedProtos) == 1 && hello.SupportedProtos[0] == acme.ALPNProto
+}
@@ -0,0 +1,128 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/batx-dev/batproxy"
+	"github.com/batx-dev/batproxy/internal/sshtest"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TestACMEPebble obtains the certificate of a proxy from a Pebble ACME
+// server, with TLS-ALPN-01 on the reverse proxy. It runs with
+// PEBBLE_DIRECTORY set, e.g. against
+//
+//	pebble-challtestsrv -defaultIPv4 127.0.0.1 &
+//	PEBBLE_VA_NOSLEEP=1 pebble -config test/config/pebble-config.json -dnsserver 127.0.0.1:8053 &
+//	PEBBLE_DIRECTORY=https://localhost:14000/dir PEBBLE_CA_CERT=test/certs/pebble.minica.pem go test -run ACMEPebble ./http
+//
+// PEBBLE_TLS_PORT is the tlsPort of the Pebble config, 5001 by default.
+func TestACMEPebble(t *testing.T) {
+	directory := os.Getenv("PEBBLE_DIRECTORY")
+	if directory == "" {
+		t.Skip("PEBBLE_DIRECTORY not set")
+	}
+	port := os.Getenv("PEBBLE_TLS_PORT")
+	if port == "" {
+		port = "5001"
+	}
+
+	srv := sshtest.NewServer(t, nil)
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "app")
+	}))
+	defer app.Close()
+
+	const host = "abc.batproxy.test"
+	p := sshProxy(srv, host)
+	p.Node, p.Port = "127.0.0.1", uint16(app.Listener.Addr().(*net.TCPAddr).Port)
+
+	s, err := NewServer("127.0.0.1:"+port, "tcp://127.0.0.1:0", testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ProxyService = newMemProxies(p)
+	if s.ACME, err = s.NewACME(ACMEOptions{
+		DirectoryURL: directory,
+		CAFile:       os.Getenv("PEBBLE_CA_CERT"),
+		Cache:        autocert.DirCache(t.TempDir()),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// the certificate is issued by the Pebble CA, unknown to the system
+	tlsConfig := &tls.Config{ServerName: host, InsecureSkipVerify: true}
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: tlsConfig,
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, s.reverseProxyListen.Addr().String())
+		},
+	}}
+	res, err := client.Get("https://" + host + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK || string(body) != "app" {
+		t.Errorf("GET = %d %q, want the application", res.StatusCode, body)
+	}
+
+	cert := res.TLS.PeerCertificates[0]
+	if err := cert.VerifyHostname(host); err != nil {
+		t.Error(err)
+	}
+	if !strings.Contains(cert.Issuer.CommonName, "Pebble") {
+		t.Errorf("issuer = %s, want Pebble", cert.Issuer)
+	}
+
+	// the names without proxy are refused
+	if _, err := tls.Dial("tcp", s.reverseProxyListen.Addr().String(), &tls.Config{ServerName: "other.batproxy.test", InsecureSkipVerify: true}); err == nil {
+		t.Error("TLS handshake of a name without proxy succeeded")
+	}
+}
+
+func TestHostPolicy(t *testing.T) {
+	s := &Server{ProxyService: newMemProxies(
+		&batproxy.Proxy{ID: "app", User: "user1", Host: "login1", Node: "node1", Port: 8888},
+		&batproxy.Proxy{ID: "db", Type: batproxy.ProxyTCP, User: "user1", Host: "login1", Node: "node1", Port: 5432},
+	)}
+
+	tests := []struct {
+		host string
+		code string
+	}{
+		{host: "app"},
+		{host: "APP"},
+		{host: "missing", code: batproxy.ENOTFOUND},
+		{host: "db", code: batproxy.EINVALID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			err := s.HostPolicy(context.Background(), tt.host)
+			if tt.code == "" {
+				if err != nil {
+					t.Errorf("HostPolicy(%q) = %v, want allowed", tt.host, err)
+				}
+				return
+			}
+			if code := batproxy.ErrorCode(err); code != tt.code {
+				t.Errorf("HostPolicy(%q) = %v, want %s", tt.host, err, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/batx-dev/batproxy"
+	restfulspec "github.com/emicklei/go-restful-openapi/v2"
+	"github.com/emicklei/go-restful/v3"
+)
+
+func (s *Server) breakerService(ws *restful.WebService) {
+	tags := []string{"breakers"}
+
+	ws.Route(ws.GET("/breakers").To(s.listBreakers).
+		Doc("list the ssh servers whose circuit is open").
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Writes(batproxy.ListBreakersPage{}).
+		Returns(200, "OK", batproxy.ListBreakersPage{}))
+
+	ws.Route(ws.DELETE("/breakers/{host}").To(s.resetBreaker).
+		Doc("close the circuit of an ssh server, the next dial tries it right away").
+		Param(ws.PathParameter("host", "the ssh server, <host>:<port>").
+			DataType("string").Required(true)).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Returns(204, "NoContent", nil).
+		Returns(404, "NotFound", batproxy.Error{}))
+}
+
+func (s *Server) listBreakers(req *restful.Request, res *restful.Response) {
+	if s.BreakerService == nil {
+		Error(res.ResponseWriter, req.Request, batproxy.Errorf(batproxy.ENOTIMPLEMENTED, "circuit breakers are disabled"))
+		return
+	}
+
+	page, err := s.BreakerService.ListBreakers(req.Request.Context())
+	if err != nil {
+		Error(res.ResponseWriter, req.Request, err)
+		return
+	}
+
+	err = res.WriteEntity(page)
+	if err != nil {
+		s.logger.Error("breakers", "err", err, "req", req.Request.URL)
+	}
+}
+
+func (s *Server) resetBreaker(req *restful.Request, res *restful.Response) {
+	if s.BreakerService == nil {
+		Error(res.ResponseWriter, req.Request, batproxy.Errorf(batproxy.ENOTIMPLEMENTED, "circuit breakers are disabled"))
+		return
+	}
+
+	if err := s.BreakerService.ResetBreaker(req.Request.Context(), req.PathParameter("host")); err != nil {
+		Error(res.ResponseWriter, req.Request, err)
+		return
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+}
+
+type BreakerService struct {
+	Client *Client
+}
+
+func NewBreakerService(client *Client) *BreakerService {
+	return &BreakerService{Client: client}
+}
+
+func (s *BreakerService) ListBreakers(ctx context.Context) (*batproxy.ListBreakersPage, error) {
+	req, err := s.Client.newRequest(ctx, "GET", "/api/v1beta1/breakers", nil)
+	if err != nil {
+		return nil, fmt.Errorf("http new request: %v", err)
+	}
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http do request: %v", err)
+	} else if res.StatusCode != http.StatusOK {
+		return nil, parseResponseError(res)
+	}
+	defer res.Body.Close()
+
+	var page batproxy.ListBreakersPage
+	if err := json.NewDecoder(res.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("json decode: %v", err)
+	}
+
+	return &page, nil
+}
+
+func (s *BreakerService) ResetBreaker(ctx context.Context, host string) error {
+	req, err := s.Client.newRequest(ctx, "DELETE", "/api/v1beta1/breakers/"+url.PathEscape(host), nil)
+	if err != nil {
+		return fmt.Errorf("http new request: %v", err)
+	}
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	} else if res.StatusCode != http.StatusNoContent {
+		return parseResponseError(res)
+	}
+	defer res.Body.Close()
+
+	return nil
+}
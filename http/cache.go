@@ -0,0 +1,195 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/batx-dev/batproxy"
+	restfulspec "github.com/emicklei/go-restful-openapi/v2"
+	"github.com/emicklei/go-restful/v3"
+)
+
+func (s *Server) cacheService(ws *restful.WebService) {
+	tags := []string{"cache"}
+
+	ws.Route(ws.GET("/cache/entries").To(s.listCacheEntries).
+		Doc("list cached proxies").
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Writes(batproxy.ListCacheEntriesPage{}).
+		Returns(200, "OK", batproxy.ListCacheEntriesPage{}))
+
+	ws.Route(ws.GET("/cache/stats").To(s.getCacheStats).
+		Doc("get hit and miss statistics of the proxy cache").
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Writes(batproxy.CacheStats{}).
+		Returns(200, "OK", batproxy.CacheStats{}))
+
+	ws.Route(ws.DELETE("/cache/entries/{proxy_id}").To(s.evictCacheEntry).
+		Doc("evict a proxy from the cache").
+		Param(ws.PathParameter("proxy_id", "the id of the reverse proxy").
+			DataType("string").Required(true)).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Returns(204, "NoContent", nil).
+		Returns(404, "NotFound", batproxy.Error{}))
+
+	ws.Route(ws.DELETE("/cache/entries").To(s.flushCache).
+		Doc("evict every proxy from the cache").
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Returns(204, "NoContent", nil))
+}
+
+func (s *Server) listCacheEntries(req *restful.Request, res *restful.Response) {
+	if s.CacheService == nil {
+		Error(res.ResponseWriter, req.Request, batproxy.Errorf(batproxy.ENOTIMPLEMENTED, "proxy cache is disabled"))
+		return
+	}
+
+	page, err := s.CacheService.ListCacheEntries(req.Request.Context())
+	if err != nil {
+		Error(res.ResponseWriter, req.Request, err)
+		return
+	}
+
+	err = res.WriteEntity(page)
+	if err != nil {
+		s.logger.Error("cache", "err", err, "req", req.Request.URL)
+	}
+}
+
+func (s *Server) getCacheStats(req *restful.Request, res *restful.Response) {
+	if s.CacheService == nil {
+		Error(res.ResponseWriter, req.Request, batproxy.Errorf(batproxy.ENOTIMPLEMENTED, "proxy cache is disabled"))
+		return
+	}
+
+	stats, err := s.CacheService.GetCacheStats(req.Request.Context())
+	if err != nil {
+		Error(res.ResponseWriter, req.Request, err)
+		return
+	}
+
+	err = res.WriteEntity(stats)
+	if err != nil {
+		s.logger.Error("cache", "err", err, "req", req.Request.URL)
+	}
+}
+
+func (s *Server) evictCacheEntry(req *restful.Request, res *restful.Response) {
+	if s.CacheService == nil {
+		Error(res.ResponseWriter, req.Request, batproxy.Errorf(batproxy.ENOTIMPLEMENTED, "proxy cache is disabled"))
+		return
+	}
+
+	proxyID := req.PathParameter("proxy_id")
+	if err := s.CacheService.EvictCacheEntry(req.Request.Context(), proxyID); err != nil {
+		Error(res.ResponseWriter, req.Request, err)
+		return
+	}
+	// the proxy may have changed in the store
+	s.evictTransports(proxyID)
+
+	res.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) flushCache(req *restful.Request, res *restful.Response) {
+	if s.CacheService == nil {
+		Error(res.ResponseWriter, req.Request, batproxy.Errorf(batproxy.ENOTIMPLEMENTED, "proxy cache is disabled"))
+		return
+	}
+
+	if err := s.CacheService.FlushCache(req.Request.Context()); err != nil {
+		Error(res.ResponseWriter, req.Request, err)
+		return
+	}
+	s.evictTransports("")
+
+	res.WriteHeader(http.StatusNoContent)
+}
+
+type CacheService struct {
+	Client *Client
+}
+
+func NewCacheService(client *Client) *CacheService {
+	return &CacheService{Client: client}
+}
+
+func (s *CacheService) ListCacheEntries(ctx context.Context) (*batproxy.ListCacheEntriesPage, error) {
+	req, err := s.Client.newRequest(ctx, "GET", "/api/v1beta1/cache/entries", nil)
+	if err != nil {
+		return nil, fmt.Errorf("http new request: %v", err)
+	}
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http do request: %v", err)
+	} else if res.StatusCode != http.StatusOK {
+		return nil, parseResponseError(res)
+	}
+	defer res.Body.Close()
+
+	var page batproxy.ListCacheEntriesPage
+	if err := json.NewDecoder(res.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("json decode: %v", err)
+	}
+
+	return &page, nil
+}
+
+func (s *CacheService) GetCacheStats(ctx context.Context) (*batproxy.CacheStats, error) {
+	req, err := s.Client.newRequest(ctx, "GET", "/api/v1beta1/cache/stats", nil)
+	if err != nil {
+		return nil, fmt.Errorf("http new request: %v", err)
+	}
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http do request: %v", err)
+	} else if res.StatusCode != http.StatusOK {
+		return nil, parseResponseError(res)
+	}
+	defer res.Body.Close()
+
+	var stats batproxy.CacheStats
+	if err := json.NewDecoder(res.Body).Decode(&stats); err != nil {
+		return nil, fmt.Errorf("json decode: %v", err)
+	}
+
+	return &stats, nil
+}
+
+func (s *CacheService) EvictCacheEntry(ctx context.Context, proxyID string) error {
+	req, err := s.Client.newRequest(ctx, "DELETE", "/api/v1beta1/cache/entries/"+proxyID, nil)
+	if err != nil {
+		return fmt.Errorf("http new request: %v", err)
+	}
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	} else if res.StatusCode != http.StatusNoContent {
+		return parseResponseError(res)
+	}
+	defer res.Body.Close()
+
+	return nil
+}
+
+func (s *CacheService) FlushCache(ctx context.Context) error {
+	req, err := s.Client.newRequest(ctx, "DELETE", "/api/v1beta1/cache/entries", nil)
+	if err != nil {
+		return fmt.Errorf("http new request: %v", err)
+	}
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	} else if res.StatusCode != http.StatusNoContent {
+		return parseResponseError(res)
+	}
+	defer res.Body.Close()
+
+	return nil
+}
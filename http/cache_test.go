@@ -0,0 +1,91 @@
+package http
+
+import (
+	"context"
+	"testing"
+
+	"github.com/batx-dev/batproxy"
+	"github.com/batx-dev/batproxy/cache"
+)
+
+// newManagerClient returns a client of the manager api of s.
+func newManagerClient(t *testing.T, s *Server) *Client {
+	t.Helper()
+
+	c, err := NewClient("http://" + s.managerListen.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCacheService(t *testing.T) {
+	ctx := context.Background()
+	proxies := newMemProxies(&batproxy.Proxy{ID: "p1"}, &batproxy.Proxy{ID: "p2"})
+	c := cache.NewProxyService(proxies, cache.ProxyServiceOptions{})
+
+	s := newTestServer(t, proxies)
+	s.ProxyService = c
+	s.CacheService = c
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	api := NewCacheService(newManagerClient(t, s))
+
+	// drop the proxies cached by the tcp sync of Open
+	if err := c.FlushCache(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"p1", "p1", "p2"} {
+		if _, err := c.ListProxies(ctx, batproxy.ListProxiesOptions{ProxyID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := api.GetCacheStats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Entries != 2 || stats.Hits != 1 || stats.Misses != 2 {
+		t.Errorf("stats = %+v, want 2 entries, 1 hit and 2 misses", stats)
+	}
+
+	page, err := api.ListCacheEntries(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Entries) != 2 || page.Entries[0].ProxyID != "p1" || page.Entries[0].Hits != 1 {
+		t.Errorf("entries = %+v, want p1 hit once and p2", page.Entries)
+	}
+
+	if err := api.EvictCacheEntry(ctx, "p1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.EvictCacheEntry(ctx, "p1"); batproxy.ErrorCode(err) != batproxy.ENOTFOUND {
+		t.Errorf("evict uncached = %v, want %s", err, batproxy.ENOTFOUND)
+	}
+
+	if err := api.FlushCache(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if stats, err = api.GetCacheStats(ctx); err != nil {
+		t.Fatal(err)
+	} else if stats.Entries != 0 {
+		t.Errorf("entries = %d after flush, want 0", stats.Entries)
+	}
+}
+
+func TestCacheServiceDisabled(t *testing.T) {
+	s := newTestServer(t, newMemProxies())
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	_, err := NewCacheService(newManagerClient(t, s)).GetCacheStats(context.Background())
+	if batproxy.ErrorCode(err) != batproxy.ENOTIMPLEMENTED {
+		t.Errorf("stats without cache = %v, want %s", err, batproxy.ENOTIMPLEMENTED)
+	}
+}
@@ -0,0 +1,109 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/batx-dev/batproxy"
+	restfulspec "github.com/emicklei/go-restful-openapi/v2"
+	"github.com/emicklei/go-restful/v3"
+)
+
+func (s *Server) connectionService(ws *restful.WebService) {
+	tags := []string{"connections"}
+
+	ws.Route(ws.GET("/connections").To(s.listConnections).
+		Doc("list live ssh connections").
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Writes(batproxy.ListConnectionsPage{}).
+		Returns(200, "OK", batproxy.ListConnectionsPage{}))
+
+	ws.Route(ws.DELETE("/connections/{connection_id}").To(s.closeConnection).
+		Doc("close an ssh connection with its streams").
+		Param(ws.PathParameter("connection_id", "the id of the ssh connection").
+			DataType("string").Required(true)).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Returns(204, "NoContent", nil).
+		Returns(404, "NotFound", batproxy.Error{}))
+}
+
+func (s *Server) listConnections(req *restful.Request, res *restful.Response) {
+	if s.ConnectionService == nil {
+		Error(res.ResponseWriter, req.Request, batproxy.Errorf(batproxy.ENOTIMPLEMENTED, "connection tracking is disabled"))
+		return
+	}
+
+	page, err := s.ConnectionService.ListConnections(req.Request.Context())
+	if err != nil {
+		Error(res.ResponseWriter, req.Request, err)
+		return
+	}
+
+	err = res.WriteEntity(page)
+	if err != nil {
+		s.logger.Error("connections", "err", err, "req", req.Request.URL)
+	}
+}
+
+func (s *Server) closeConnection(req *restful.Request, res *restful.Response) {
+	if s.ConnectionService == nil {
+		Error(res.ResponseWriter, req.Request, batproxy.Errorf(batproxy.ENOTIMPLEMENTED, "connection tracking is disabled"))
+		return
+	}
+
+	if err := s.ConnectionService.CloseConnection(req.Request.Context(), req.PathParameter("connection_id")); err != nil {
+		Error(res.ResponseWriter, req.Request, err)
+		return
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+}
+
+type ConnectionService struct {
+	Client *Client
+}
+
+func NewConnectionService(client *Client) *ConnectionService {
+	return &ConnectionService{Client: client}
+}
+
+func (s *ConnectionService) ListConnections(ctx context.Context) (*batproxy.ListConnectionsPage, error) {
+	req, err := s.Client.newRequest(ctx, "GET", "/api/v1beta1/connections", nil)
+	if err != nil {
+		return nil, fmt.Errorf("http new request: %v", err)
+	}
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http do request: %v", err)
+	} else if res.StatusCode != http.StatusOK {
+		return nil, parseResponseError(res)
+	}
+	defer res.Body.Close()
+
+	var page batproxy.ListConnectionsPage
+	if err := json.NewDecoder(res.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("json decode: %v", err)
+	}
+
+	return &page, nil
+}
+
+func (s *ConnectionService) CloseConnection(ctx context.Context, id string) error {
+	req, err := s.Client.newRequest(ctx, "DELETE", "/api/v1beta1/connections/"+id, nil)
+	if err != nil {
+		return fmt.Errorf("http new request: %v", err)
+	}
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	} else if res.StatusCode != http.StatusNoContent {
+		return parseResponseError(res)
+	}
+	defer res.Body.Close()
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/batx-dev/batproxy"
+	"github.com/batx-dev/batproxy/ssh"
+)
+
+func TestConnectionService(t *testing.T) {
+	ctx := context.Background()
+	s, srv := newBackendServer(t, true)
+	connections := ssh.NewConnections(testLogger)
+	s.Connections = connections
+	s.ConnectionService = connections
+
+	getApp(t, s, http.DefaultClient)
+
+	api := NewConnectionService(newManagerClient(t, s))
+	page, err := api.ListConnections(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Connections) != 1 {
+		t.Fatalf("connections = %d, want the pooled one", len(page.Connections))
+	}
+	conn := page.Connections[0]
+	if conn.User != "user" || conn.Host != srv.Addr || conn.Slot != 0 || conn.BytesRead == 0 {
+		t.Errorf("connection = %+v, want user@%s slot 0 with traffic", conn, srv.Addr)
+	}
+
+	if err := api.CloseConnection(ctx, conn.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.CloseConnection(ctx, "missing"); batproxy.ErrorCode(err) != batproxy.ENOTFOUND {
+		t.Errorf("close missing connection = %v, want %s", err, batproxy.ENOTFOUND)
+	}
+
+	// the closed connection is forgotten once its client noticed
+	deadline := time.Now().Add(time.Second)
+	for {
+		page, err := api.ListConnections(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Connections) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("connections = %d after close, want 0", len(page.Connections))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the next request dials again
+	http.DefaultClient.CloseIdleConnections()
+	getApp(t, s, http.DefaultClient)
+	if got := srv.Conns(); got != 2 {
+		t.Errorf("ssh connections = %d, want a new one after close", got)
+	}
+}
@@ -60,10 +60,24 @@ var codes = map[string]int{
 	batproxy.EINTERNAL:       http.StatusInternalServerError,
 	batproxy.EFORBIDDEN:      http.StatusForbidden,
 	batproxy.EBADGATEWAY:     http.StatusBadGateway,
+	batproxy.EUNAVAILABLE:    http.StatusServiceUnavailable,
+}
+
+// lookup of application error subcodes to the code they refine, they share
+// its HTTP status code.
+var subcodes = map[string]string{
+	batproxy.EHOSTKEY:     batproxy.EBADGATEWAY,
+	batproxy.ESSHAUTH:     batproxy.EBADGATEWAY,
+	batproxy.ECIRCUITOPEN: batproxy.EBADGATEWAY,
+	batproxy.EJOBPENDING:  batproxy.EUNAVAILABLE,
+	batproxy.EJOBENDED:    batproxy.ENOTFOUND,
 }
 
 // ErrorStatusCode returns the associated HTTP status code for a BatProxy error code.
 func ErrorStatusCode(code string) int {
+	if v, ok := subcodes[code]; ok {
+		code = v
+	}
 	if v, ok := codes[code]; ok {
 		return v
 	}
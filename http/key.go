@@ -2,8 +2,11 @@ package http
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"time"
 
+	"github.com/batx-dev/batproxy"
 	"github.com/batx-dev/batproxy/memo"
 	"github.com/batx-dev/batproxy/ssh"
 	"golang.org/x/exp/slog"
@@ -29,24 +32,210 @@ type key struct {
 	// Password Over SSH login password.
 	// Optional.
 	Password string `json:"password,omitempty"`
+
+	// TOTPSecret Over SSH login one-time code seed.
+	// Optional.
+	TOTPSecret string `json:"totp_secret,omitempty"`
+
+	// Certificate Over SSH login certificate.
+	// Optional.
+	Certificate string `json:"certificate,omitempty"`
+
+	// SignCertificate Over SSH login with a certificate signed by the server.
+	// Optional.
+	SignCertificate bool `json:"sign_certificate,omitempty"`
+
+	// Agent Over SSH login with the server's ssh-agent.
+	// Optional.
+	Agent bool `json:"agent,omitempty"`
+
+	// AgentKeyFilter Over SSH login ssh-agent key filter.
+	// Optional.
+	AgentKeyFilter string `json:"agent_key_filter,omitempty"`
+
+	// HostKeyFingerprint Over SSH login host key fingerprint.
+	// Optional.
+	HostKeyFingerprint string `json:"host_key_fingerprint,omitempty"`
+
+	// Upstream Over SSH proxy to reach host through, unless Jump.
+	// Optional.
+	Upstream string `json:"upstream,omitempty"`
+
+	// SSHOptions Over SSH connection settings.
+	// Optional.
+	SSHOptions batproxy.SSHOptions `json:"ssh_options,omitempty"`
+
+	// Jump JSON encoded key of the jump host to dial through.
+	// Optional.
+	Jump string `json:"jump,omitempty"`
+}
+
+// newKey returns the key of the ssh connection to the login host of p,
+// chained through its jump hosts, which share its ssh options.
+func newKey(p *batproxy.Proxy) key {
+	var opts batproxy.SSHOptions
+	if p.SSHOptions != nil {
+		opts = *p.SSHOptions
+	}
+
+	// only the first hop is dialed through the upstream proxy
+	var jump string
+	for i, j := range p.JumpHosts {
+		var upstream string
+		if i == 0 {
+			upstream = p.Upstream
+		}
+		buf, _ := json.Marshal(key{
+			User:               j.User,
+			Host:               j.Host,
+			PrivateKey:         j.PrivateKey,
+			Passphrase:         j.Passphrase,
+			Password:           j.Password,
+			TOTPSecret:         j.TOTPSecret,
+			Certificate:        j.Certificate,
+			SignCertificate:    j.SignCertificate,
+			Agent:              j.Agent,
+			AgentKeyFilter:     j.AgentKeyFilter,
+			HostKeyFingerprint: j.HostKeyFingerprint,
+			Upstream:           upstream,
+			SSHOptions:         opts,
+			Jump:               jump,
+		})
+		jump = string(buf)
+	}
+
+	k := key{
+		User:               p.User,
+		Host:               p.Host,
+		PrivateKey:         p.PrivateKey,
+		Passphrase:         p.Passphrase,
+		Password:           p.Password,
+		TOTPSecret:         p.TOTPSecret,
+		Certificate:        p.Certificate,
+		SignCertificate:    p.SignCertificate,
+		Agent:              p.Agent,
+		AgentKeyFilter:     p.AgentKeyFilter,
+		HostKeyFingerprint: p.HostKeyFingerprint,
+		SSHOptions:         opts,
+		Jump:               jump,
+	}
+	if len(p.JumpHosts) == 0 {
+		k.Upstream = p.Upstream
+	}
+
+	return k
+}
+
+func (k *key) jump() (*key, error) {
+	if k.Jump == "" {
+		return nil, nil
+	}
+
+	var jump key
+	if err := json.Unmarshal([]byte(k.Jump), &jump); err != nil {
+		return nil, err
+	}
+	return &jump, nil
 }
 
 func (k *key) String() string {
+	if jump, err := k.jump(); err == nil && jump != nil {
+		return fmt.Sprintf("%s@%s via %s", k.User, k.Host, jump)
+	}
 	return fmt.Sprintf("%s@%s", k.User, k.Host)
 }
 
-func sshFunc(logger *slog.Logger) memo.Func[key, *ssh.Ssh] {
+func (s *Server) sshFunc(logger *slog.Logger) memo.Func[key, *ssh.Ssh] {
 	return func(ctx context.Context, key key, cleanup func()) (*ssh.Ssh, error) {
 		client := &ssh.Client{
-			User:       key.User,
-			Host:       key.Host,
-			PrivateKey: key.PrivateKey,
-			Passphrase: key.Passphrase,
-			Password:   key.Password,
-			Logger:     logger,
+			User:               key.User,
+			Host:               key.Host,
+			PrivateKey:         key.PrivateKey,
+			Passphrase:         key.Passphrase,
+			Password:           key.Password,
+			TOTPSecret:         key.TOTPSecret,
+			PromptRules:        s.PromptRules,
+			Certificate:        key.Certificate,
+			SignCertificate:    key.SignCertificate,
+			CA:                 s.CA,
+			UseAgent:           key.Agent,
+			AgentKeyFilter:     key.AgentKeyFilter,
+			Agent:              s.Agent,
+			HostKeyFingerprint: key.HostKeyFingerprint,
+			HostKeys:           s.HostKeys,
+			Breakers:           s.Breakers,
+			Connections:        s.Connections,
+			Upstream:           key.Upstream,
+			Logger:             logger,
+		}
+
+		// zero settings are left to the defaults of the client
+		opts := s.sshOptions(key.SSHOptions)
+		client.ConnectTimeout = time.Duration(opts.ConnectTimeout) * time.Second
+		client.ServerAliveInterval = time.Duration(opts.ServerAliveInterval) * time.Second
+		client.ServerAliveCountMax = opts.ServerAliveCountMax
+		client.RetryMin = time.Duration(opts.RetryMin) * time.Second
+		client.RetryMax = time.Duration(opts.RetryMax) * time.Second
+		client.Forward = opts.Forward
+		client.RelayCommand = opts.RelayCommand
+		client.RelayUnixCommand = opts.RelayUnixCommand
+
+		jump, err := key.jump()
+		if err != nil {
+			return nil, batproxy.Errorf(batproxy.EINVALID, "jump host: %v", err)
+		}
+		if client.Upstream == "" && jump == nil {
+			client.Upstream = s.Upstream
+		}
+
+		// The jump host is shared with the other keys behind it, and held
+		// as long as this ssh connection is memoized.
+		var release func()
+		if jump != nil {
+			if client.Jump, release, err = s.memo.Acquire(ctx, *jump); err != nil {
+				return nil, err
+			}
 		}
 
-		s := ssh.New(logger, client)
-		return s, nil
+		sc := ssh.New(logger, client)
+		sc.OnClose = release
+		if s.PoolSize > 0 {
+			sc.PoolSize = s.PoolSize
+		}
+		if s.PoolIdleTimeout > 0 {
+			sc.PoolIdleTimeout = s.PoolIdleTimeout
+		}
+		return sc, nil
+	}
+}
+
+// sshOptions returns the server's ssh options overridden by the non-zero
+// fields of o.
+func (s *Server) sshOptions(o batproxy.SSHOptions) batproxy.SSHOptions {
+	res := s.SSHOptions
+	if o.ConnectTimeout > 0 {
+		res.ConnectTimeout = o.ConnectTimeout
+	}
+	if o.ServerAliveInterval > 0 {
+		res.ServerAliveInterval = o.ServerAliveInterval
+	}
+	if o.ServerAliveCountMax > 0 {
+		res.ServerAliveCountMax = o.ServerAliveCountMax
+	}
+	if o.RetryMin > 0 {
+		res.RetryMin = o.RetryMin
+	}
+	if o.RetryMax > 0 {
+		res.RetryMax = o.RetryMax
+	}
+	if o.Forward != "" {
+		res.Forward = o.Forward
+	}
+	if o.RelayCommand != "" {
+		res.RelayCommand = o.RelayCommand
+	}
+	if o.RelayUnixCommand != "" {
+		res.RelayUnixCommand = o.RelayUnixCommand
 	}
+	return res
 }
@@ -0,0 +1,97 @@
+package http
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/batx-dev/batproxy"
+	"github.com/batx-dev/batproxy/internal/sshtest"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestNewKeyJumpHosts(t *testing.T) {
+	p := &batproxy.Proxy{
+		User:     "user1",
+		Host:     "login1:22",
+		Password: "123456",
+		Upstream: "socks5://gateway:1080",
+		JumpHosts: []*batproxy.JumpHost{
+			{User: "user1", Host: "bastion1:22", Password: "123456"},
+			{User: "user1", Host: "bastion2:22", Password: "123456", HostKeyFingerprint: "SHA256:bastion2"},
+		},
+		SSHOptions: &batproxy.SSHOptions{ConnectTimeout: 5, ServerAliveInterval: 3},
+	}
+
+	k := newKey(p)
+	if k.Upstream != "" || k.SSHOptions != *p.SSHOptions {
+		t.Errorf("login host key = %+v, want the ssh options and no upstream", k)
+	}
+
+	hops := []string{"bastion2:22", "bastion1:22"}
+	for i, host := range hops {
+		jump, err := k.jump()
+		if err != nil || jump == nil {
+			t.Fatalf("jump %d: %v, %v", i, jump, err)
+		}
+		if jump.Host != host {
+			t.Errorf("jump %d host = %s, want %s", i, jump.Host, host)
+		}
+		if jump.SSHOptions != *p.SSHOptions {
+			t.Errorf("jump %s ssh options = %+v, want %+v", host, jump.SSHOptions, *p.SSHOptions)
+		}
+		if first := i == len(hops)-1; (jump.Upstream != "") != first {
+			t.Errorf("jump %s upstream = %q, want it on the first hop only", host, jump.Upstream)
+		}
+		k = *jump
+	}
+	if k.Jump != "" {
+		t.Errorf("first hop dials through %s", k.Jump)
+	}
+}
+
+// fingerprint returns the pinned fingerprint of the host key of srv.
+func fingerprint(srv *sshtest.Server) string {
+	return ssh.FingerprintSHA256(srv.HostKey.PublicKey())
+}
+
+func TestJumpHosts(t *testing.T) {
+	bastion := sshtest.NewServer(t, nil)
+	login := sshtest.NewServer(t, nil)
+
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "app")
+	}))
+	defer app.Close()
+
+	p := sshProxy(login, "app")
+	p.Node = "127.0.0.1"
+	p.Port = uint16(app.Listener.Addr().(*net.TCPAddr).Port)
+	p.JumpHosts = []*batproxy.JumpHost{{User: "user", Host: bastion.Addr, Password: sshtest.Password}}
+	p.HostKeyFingerprint = "SHA256:not-the-login-host"
+	p.JumpHosts[0].HostKeyFingerprint = "SHA256:not-the-bastion"
+
+	s := newTestServer(t, newMemProxies(p))
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// the pinned keys of both hops are checked
+	if res := get(t, s, "app"); res.StatusCode == http.StatusOK {
+		t.Fatalf("status = %d through unpinned hosts", res.StatusCode)
+	}
+
+	p.JumpHosts[0].HostKeyFingerprint = fingerprint(bastion)
+	p.HostKeyFingerprint = fingerprint(login)
+	res := get(t, s, "app")
+	if res.StatusCode != http.StatusOK || res.body != "app" {
+		t.Fatalf("response = %d %q, want app", res.StatusCode, res.body)
+	}
+	if bastion.Channels() != 1 || login.Channels() != 1 {
+		t.Errorf("channels = %d on the bastion, %d on the login host, want one each",
+			bastion.Channels(), login.Channels())
+	}
+}
@@ -0,0 +1,194 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/batx-dev/batproxy"
+	restfulspec "github.com/emicklei/go-restful-openapi/v2"
+	"github.com/emicklei/go-restful/v3"
+)
+
+func (s *Server) knownHostService(ws *restful.WebService) {
+	tags := []string{"known_hosts"}
+
+	ws.Route(ws.GET("/known_hosts").To(s.listKnownHosts).
+		Doc("list ssh server host keys").
+		Param(ws.QueryParameter("host", "the ssh server, <host>:<port>").
+			DataType("string")).
+		Param(ws.QueryParameter("status", "one of [trusted, pending]").
+			DataType("string")).
+		Param(ws.QueryParameter("page_size", "sets the maximum number of known hosts to be returned").
+			DataType("integer").DefaultValue("1000")).
+		Param(ws.QueryParameter("page_token", "page_token may be filled in with the next_page_token from a previous list call").
+			DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Writes(batproxy.ListKnownHostsPage{}).
+		Returns(200, "OK", batproxy.ListKnownHostsPage{}))
+
+	ws.Route(ws.POST("/known_hosts/approve").To(s.approveKnownHost).
+		Doc("trust a pending host key").
+		Param(ws.QueryParameter("host", "the ssh server, <host>:<port>").
+			DataType("string").Required(true)).
+		Param(ws.QueryParameter("fingerprint", "the SHA256 fingerprint of the host key").
+			DataType("string").Required(true)).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Returns(204, "NoContent", nil).
+		Returns(404, "NotFound", batproxy.Error{}))
+
+	ws.Route(ws.DELETE("/known_hosts").To(s.deleteKnownHost).
+		Doc("forget a host key").
+		Param(ws.QueryParameter("host", "the ssh server, <host>:<port>").
+			DataType("string").Required(true)).
+		Param(ws.QueryParameter("fingerprint", "the SHA256 fingerprint of the host key").
+			DataType("string").Required(true)).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Returns(204, "NoContent", nil))
+}
+
+func (s *Server) listKnownHosts(req *restful.Request, res *restful.Response) {
+	if s.KnownHostService == nil {
+		Error(res.ResponseWriter, req.Request, batproxy.Errorf(batproxy.ENOTIMPLEMENTED, "known hosts are disabled"))
+		return
+	}
+
+	opts := batproxy.ListKnownHostsOptions{}
+	decoder.IgnoreUnknownKeys(true)
+	if err := decoder.Decode(&opts, req.Request.URL.Query()); err != nil {
+		Error(res.ResponseWriter, req.Request, batproxy.Errorf(batproxy.EINVALID, "%v", err))
+		return
+	}
+
+	page, err := s.KnownHostService.ListKnownHosts(req.Request.Context(), opts)
+	if err != nil {
+		Error(res.ResponseWriter, req.Request, err)
+		return
+	}
+
+	err = res.WriteEntity(page)
+	if err != nil {
+		s.logger.Error("known host", "err", err, "req", req.Request.URL)
+	}
+}
+
+func (s *Server) approveKnownHost(req *restful.Request, res *restful.Response) {
+	if s.KnownHostService == nil {
+		Error(res.ResponseWriter, req.Request, batproxy.Errorf(batproxy.ENOTIMPLEMENTED, "known hosts are disabled"))
+		return
+	}
+
+	if err := s.KnownHostService.ApproveKnownHost(
+		req.Request.Context(),
+		req.QueryParameter("host"),
+		req.QueryParameter("fingerprint"),
+	); err != nil {
+		Error(res.ResponseWriter, req.Request, err)
+		return
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) deleteKnownHost(req *restful.Request, res *restful.Response) {
+	if s.KnownHostService == nil {
+		Error(res.ResponseWriter, req.Request, batproxy.Errorf(batproxy.ENOTIMPLEMENTED, "known hosts are disabled"))
+		return
+	}
+
+	if err := s.KnownHostService.DeleteKnownHost(
+		req.Request.Context(),
+		req.QueryParameter("host"),
+		req.QueryParameter("fingerprint"),
+	); err != nil {
+		Error(res.ResponseWriter, req.Request, err)
+		return
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+}
+
+type KnownHostService struct {
+	Client *Client
+}
+
+func NewKnownHostService(client *Client) *KnownHostService {
+	return &KnownHostService{Client: client}
+}
+
+// AddKnownHost is not exposed by the manager API, host keys are recorded when
+// they are presented.
+func (s *KnownHostService) AddKnownHost(ctx context.Context, host *batproxy.KnownHost) error {
+	return batproxy.Errorf(batproxy.ENOTIMPLEMENTED, "add known host")
+}
+
+func (s *KnownHostService) ListKnownHosts(ctx context.Context, opts batproxy.ListKnownHostsOptions) (*batproxy.ListKnownHostsPage, error) {
+	query := url.Values{}
+	err := encoder.Encode(opts, query)
+	if err != nil {
+		return nil, batproxy.Errorf(batproxy.EINVALID, "query encode: %v", err)
+	}
+
+	req, err := s.Client.newRequest(ctx, "GET",
+		"/api/v1beta1/known_hosts?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("http new request: %v", err)
+	}
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http do request: %v", err)
+	} else if res.StatusCode != http.StatusOK {
+		return nil, parseResponseError(res)
+	}
+	defer res.Body.Close()
+
+	var page batproxy.ListKnownHostsPage
+	if err := json.NewDecoder(res.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("json decode: %v", err)
+	}
+
+	return &page, nil
+}
+
+func (s *KnownHostService) ApproveKnownHost(ctx context.Context, host, fingerprint string) error {
+	query := url.Values{"host": {host}, "fingerprint": {fingerprint}}
+
+	req, err := s.Client.newRequest(ctx, "POST",
+		"/api/v1beta1/known_hosts/approve?"+query.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("http new request: %v", err)
+	}
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	} else if res.StatusCode != http.StatusNoContent {
+		return parseResponseError(res)
+	}
+	defer res.Body.Close()
+
+	return nil
+}
+
+func (s *KnownHostService) DeleteKnownHost(ctx context.Context, host, fingerprint string) error {
+	query := url.Values{"host": {host}, "fingerprint": {fingerprint}}
+
+	req, err := s.Client.newRequest(ctx, "DELETE",
+		"/api/v1beta1/known_hosts?"+query.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("http new request: %v", err)
+	}
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	} else if res.StatusCode != http.StatusNoContent {
+		return parseResponseError(res)
+	}
+	defer res.Body.Close()
+
+	return nil
+}
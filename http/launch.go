@@ -0,0 +1,99 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/batx-dev/batproxy"
+	restfulspec "github.com/emicklei/go-restful-openapi/v2"
+	"github.com/emicklei/go-restful/v3"
+)
+
+func (s *Server) launchService(ws *restful.WebService) {
+	tags := []string{"launches"}
+
+	ws.Route(ws.POST("/launches").To(s.launch).
+		Doc("launch an application as a batch job and create the proxy to it").
+		Param(ws.QueryParameter("suffix", "the proxy id suffix").
+			DataType("string")).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Reads(batproxy.Launch{}).
+		Writes(batproxy.Launch{}).
+		Returns(201, "Created", batproxy.Launch{}).
+		Returns(503, "ServiceUnavailable", batproxy.Error{}))
+}
+
+func (s *Server) launch(req *restful.Request, res *restful.Response) {
+	if s.LaunchService == nil {
+		Error(res.ResponseWriter, req.Request, batproxy.Errorf(batproxy.ENOTIMPLEMENTED, "launches are disabled"))
+		return
+	}
+
+	opts := batproxy.CreateProxyOptions{}
+	decoder.IgnoreUnknownKeys(true)
+	if err := decoder.Decode(&opts, req.Request.URL.Query()); err != nil {
+		Error(res.ResponseWriter, req.Request, batproxy.Errorf(batproxy.EINVALID, "%v", err))
+		return
+	}
+
+	launch := &batproxy.Launch{}
+	if err := req.ReadEntity(launch); err != nil {
+		Error(res.ResponseWriter, req.Request, batproxy.Errorf(batproxy.EINVALID, "%v", err))
+		return
+	}
+
+	if err := s.LaunchService.Launch(req.Request.Context(), launch, opts); err != nil {
+		Error(res.ResponseWriter, req.Request, err)
+		return
+	}
+
+	err := res.WriteHeaderAndEntity(http.StatusCreated, launch)
+	if err != nil {
+		s.logger.Error("launch", "err", err, "req", req.Request.URL)
+	}
+}
+
+type LaunchService struct {
+	Client *Client
+}
+
+func NewLaunchService(client *Client) *LaunchService {
+	return &LaunchService{Client: client}
+}
+
+func (s *LaunchService) Launch(ctx context.Context, launch *batproxy.Launch, opts batproxy.CreateProxyOptions) error {
+	body, err := json.Marshal(launch)
+	if err != nil {
+		return batproxy.Errorf(batproxy.EINVALID, "json encode: %v", err)
+	}
+
+	query := url.Values{}
+	if err := encoder.Encode(opts, query); err != nil {
+		return batproxy.Errorf(batproxy.EINVALID, "query encode: %v", err)
+	}
+
+	req, err := s.Client.newRequest(ctx, "POST",
+		"/api/v1beta1/launches?"+query.Encode(),
+		bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("http new request: %v", err)
+	}
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	} else if res.StatusCode != http.StatusCreated {
+		return parseResponseError(res)
+	}
+	defer res.Body.Close()
+
+	if err := json.NewDecoder(res.Body).Decode(launch); err != nil {
+		return fmt.Errorf("json decode: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,306 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/batx-dev/batproxy"
+	"github.com/batx-dev/batproxy/ssh"
+)
+
+// LaunchPollInterval is how often a launch checks whether its application
+// started.
+const LaunchPollInterval = 2 * time.Second
+
+// launcher submits the launched applications over the ssh connections of the
+// server.
+type launcher struct {
+	s *Server
+}
+
+// Launcher returns the launch service submitting the jobs over the ssh
+// connections of s, and creating their proxies with s.ProxyService.
+func (s *Server) Launcher() batproxy.LaunchService {
+	return &launcher{s: s}
+}
+
+// launchInfo is written by the job once its application listens.
+type launchInfo struct {
+	Node string `json:"node"`
+	Port uint16 `json:"port"`
+}
+
+func (l *launcher) Launch(ctx context.Context, launch *batproxy.Launch, opts batproxy.CreateProxyOptions) (err error) {
+	if err := launch.Validate(); err != nil {
+		return batproxy.Errorf(batproxy.EINVALID, "%v", err)
+	}
+
+	p := *launch.Proxy
+
+	sc, release, err := l.s.memo.Acquire(ctx, newKey(&p))
+	if err != nil {
+		return err
+	}
+	// the connection is released by watch once the proxy is created
+	defer func() {
+		if err != nil {
+			release()
+		}
+	}()
+
+	id, err := newLaunchID()
+	if err != nil {
+		return err
+	}
+	token, err := newLaunchToken()
+	if err != nil {
+		return err
+	}
+
+	out, err := sc.Output(ctx, submitCommand(id, token, launch))
+	if err != nil {
+		return err
+	}
+	// --parsable prints <job id>[;<cluster>]
+	job := &batproxy.SlurmJob{
+		JobID:  strings.TrimSpace(strings.SplitN(string(out), ";", 2)[0]),
+		Expire: true,
+	}
+	if err := job.Validate(); err != nil {
+		return batproxy.Errorf(batproxy.EBADGATEWAY, "launch %s: sbatch: unexpected output: %s", launch.App, out)
+	}
+	launch.JobID = job.JobID
+
+	// the job is cancelled unless its proxy is created
+	defer func() {
+		if err != nil {
+			l.cancel(sc, job)
+		}
+	}()
+
+	// the proxy is pending with the job, and finds the port of the
+	// application once it started
+	p.SlurmJob = job
+	p.Resolver = &batproxy.Resolver{Command: `cat "$HOME/.batproxy/launch-` + id + `.json" 2>/dev/null; true`}
+	p.Access = launchAccess(p.Access, token)
+	if err := l.s.ProxyService.CreateProxy(ctx, &p, opts); err != nil {
+		return err
+	}
+
+	launch.Proxy = &p
+	launch.Token = token
+	launch.URL = l.s.proxyURL(p.ID, launchPath(launch.App, token))
+
+	go l.watch(sc, release, &p, id, launch.Expiration())
+
+	return nil
+}
+
+// watch waits for the application of the launched proxy p to start, the
+// proxy is deleted and its job cancelled if it does not within timeout.
+func (l *launcher) watch(sc *ssh.Ssh, release func(), p *batproxy.Proxy, id string, timeout time.Duration) {
+	defer release()
+
+	ctx := l.s.ctx
+	if _, err := l.wait(ctx, sc, id, p.SlurmJob, timeout); err != nil {
+		if ctx.Err() != nil {
+			// the proxy expires with the job
+			return
+		}
+		l.s.logger.Error("launch", "proxy_id", p.ID, "job_id", p.SlurmJob.JobID, "err", err)
+		l.cancel(sc, p.SlurmJob)
+		l.s.expire(ctx, p)
+		return
+	}
+
+	// the requests while it was pending resolve again right away
+	l.s.unresolve(p)
+	l.s.logger.Info("launch", "status", "started", "proxy_id", p.ID, "job_id", p.SlurmJob.JobID)
+}
+
+// launchAccess returns a copy of access letting in the users with token too.
+func launchAccess(access *batproxy.Access, token string) *batproxy.Access {
+	a := &batproxy.Access{}
+	if access != nil {
+		*a = *access
+	}
+	a.QueryTokens = append(append([]*batproxy.AccessToken(nil), a.QueryTokens...), &batproxy.AccessToken{Token: token})
+	return a
+}
+
+// launchPath returns the path the users open to reach the application of
+// app, with token for the application and for the access of its proxy.
+func launchPath(app string, token string) string {
+	path := strings.ReplaceAll(batproxy.Apps[app].Path, "{token}", url.QueryEscape(token))
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + AccessTokenParam + "=" + url.QueryEscape(token)
+}
+
+// wait polls the file the job writes once its application started, until
+// timeout.
+func (l *launcher) wait(ctx context.Context, sc *ssh.Ssh, id string, job *batproxy.SlurmJob, timeout time.Duration) (*launchInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(LaunchPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return nil, batproxy.Errorf(batproxy.EUNAVAILABLE, "slurm job %s: application did not start within %s", job.JobID, timeout)
+			}
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+
+		out, err := sc.Output(ctx, `cat "$HOME/.batproxy/launch-`+id+`.json" 2>/dev/null; true`)
+		if err != nil {
+			return nil, err
+		}
+		if len(out) > 0 {
+			var info launchInfo
+			if err := json.Unmarshal(out, &info); err != nil || info.Port == 0 {
+				return nil, batproxy.Errorf(batproxy.EBADGATEWAY, "slurm job %s: invalid launch info: %s", job.JobID, out)
+			}
+			return &info, nil
+		}
+
+		if out, err = sc.Output(ctx, job.Command()); err != nil {
+			return nil, err
+		}
+		if err := job.Resolve(&batproxy.Proxy{}, out); err != nil {
+			if batproxy.ErrorCode(err) == batproxy.EJOBPENDING {
+				continue
+			}
+			if batproxy.ErrorCode(err) == batproxy.EJOBENDED {
+				return nil, batproxy.Errorf(batproxy.EBADGATEWAY, "slurm job %s ended before its application started, see ~/.batproxy/launch-%s.log", job.JobID, id)
+			}
+			return nil, err
+		}
+	}
+}
+
+// cancel cancels job, even if the launch was cancelled.
+func (l *launcher) cancel(sc *ssh.Ssh, job *batproxy.SlurmJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), ResolveTimeout)
+	defer cancel()
+
+	if _, err := sc.Output(ctx, "scancel "+job.JobID); err != nil {
+		l.s.logger.Error("launch", "status", "cancel", "job_id", job.JobID, "err", err)
+		return
+	}
+	l.s.logger.Info("launch", "status", "cancel", "job_id", job.JobID)
+}
+
+// submitCommand returns the command submitting the job of launch, its
+// application authenticates with token and the job writes
+// $HOME/.batproxy/launch-<id>.json once the application accepts connections,
+// so the proxy does not resolve to a port nothing listens on yet.
+func submitCommand(id string, token string, launch *batproxy.Launch) string {
+	args := []string{
+		"sbatch", "--parsable",
+		"--job-name=batproxy-" + launch.App,
+		`--output="$HOME/.batproxy/launch-` + id + `.log"`,
+	}
+	if o := launch.Scheduler; o != nil {
+		for _, opt := range [][2]string{
+			{"--partition", o.Partition},
+			{"--account", o.Account},
+			{"--time", o.Time},
+			{"--mem", o.Memory},
+		} {
+			if opt[1] != "" {
+				args = append(args, opt[0]+"="+opt[1])
+			}
+		}
+		if o.CPUs > 0 {
+			args = append(args, "--cpus-per-task="+strconv.Itoa(o.CPUs))
+		}
+		if o.GPUs > 0 {
+			args = append(args, "--gres=gpu:"+strconv.Itoa(o.GPUs))
+		}
+	}
+
+	script := `#!/bin/bash
+port=$(python3 -c 'import socket; s = socket.socket(); s.bind(("", 0)); print(s.getsockname()[1])' 2>/dev/null || shuf -i 20000-60000 -n 1)
+token=` + token + `
+info="$HOME/.batproxy/launch-` + id + `.json"
+` + batproxy.Apps[launch.App].Command + ` &
+app=$!
+trap 'kill "$app" 2>/dev/null' INT TERM
+until (: > "/dev/tcp/127.0.0.1/$port") 2>/dev/null; do
+	kill -0 "$app" 2>/dev/null || { wait "$app"; exit; }
+	sleep 1
+done
+printf '{"node":"%s","port":%s}\n' "$(hostname)" "$port" > "$info.tmp" && mv "$info.tmp" "$info"
+wait "$app"
+`
+
+	return `mkdir -p "$HOME/.batproxy" && ` + strings.Join(args, " ") + " <<'BATPROXY_EOF'\n" + script + "BATPROXY_EOF\n"
+}
+
+// proxyURL returns the URL of path through the proxy of proxyID.
+func (s *Server) proxyURL(proxyID string, path string) string {
+	u := &url.URL{Scheme: "http", Host: proxyID}
+	if s.PublicURL != "" {
+		if pu, err := url.Parse(s.PublicURL); err == nil {
+			if s.PathRouting {
+				return strings.TrimSuffix(pu.String(), "/") + PathRoutePrefix + proxyID + path
+			}
+			u.Scheme = pu.Scheme
+			if port := pu.Port(); port != "" {
+				u.Host = net.JoinHostPort(proxyID, port)
+			}
+		}
+		return u.String() + path
+	}
+
+	defaultPort := "80"
+	if s.Certificates != nil || s.ACME != nil {
+		u.Scheme, defaultPort = "https", "443"
+	}
+	host, port, err := net.SplitHostPort(s.reverseProxyAddr)
+	if err != nil {
+		return u.String() + path
+	}
+	if s.PathRouting {
+		// the users reach the reverse proxy address itself
+		if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+			host = "localhost"
+		}
+		u.Host, path = host, PathRoutePrefix+proxyID+path
+	}
+	if port != defaultPort {
+		u.Host = net.JoinHostPort(u.Host, port)
+	}
+	return u.String() + path
+}
+
+func newLaunchID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("launch id: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func newLaunchToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("launch token: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,330 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/batx-dev/batproxy"
+	"github.com/batx-dev/batproxy/internal/sshtest"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// fakeScheduler installs a fake slurm on srv: sbatch saves the job script to
+// launch.sh and submits the job 4242, scontrol prints the job written to
+// job-<id>, and scancel records the cancelled jobs to cancelled.
+func fakeScheduler(t *testing.T, srv *sshtest.Server) {
+	t.Helper()
+
+	srv.WriteScript(t, "sbatch", `#!/bin/sh
+cat > "$HOME/launch.sh"
+echo "4242;cluster"
+`)
+	srv.WriteScript(t, "scontrol", `#!/bin/sh
+cat "$HOME/job-$4" 2>/dev/null && exit
+echo "slurm_load_jobs error: Invalid job id specified" >&2
+exit 1
+`)
+	srv.WriteScript(t, "scancel", `#!/bin/sh
+echo "$1" >> "$HOME/cancelled"
+`)
+}
+
+// setJob sets the state of the job 4242 of the fake scheduler.
+func setJob(t *testing.T, srv *sshtest.Server, state, batchHost string) {
+	t.Helper()
+	writeFile(t, srv, "job-4242", fmt.Sprintf("JobId=4242 JobName=batproxy-jupyter JobState=%s BatchHost=%s\n", state, batchHost))
+}
+
+var launchIDRegexp = regexp.MustCompile(`launch-([0-9a-f]+)\.json`)
+
+func TestLaunch(t *testing.T) {
+	srv := sshtest.NewServer(t, nil)
+	fakeScheduler(t, srv)
+	setJob(t, srv, "PENDING", "(null)")
+
+	var (
+		mu    sync.Mutex
+		query string
+	)
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		query = r.URL.RawQuery
+		mu.Unlock()
+		io.WriteString(w, "app")
+	}))
+	defer app.Close()
+
+	proxies := newMemProxies()
+	s := newTestServer(t, proxies)
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	launch := &batproxy.Launch{App: "jupyter", Proxy: sshProxy(srv, "")}
+	start := time.Now()
+	if err := s.Launcher().Launch(context.Background(), launch, batproxy.CreateProxyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > LaunchPollInterval {
+		t.Errorf("Launch took %s, want it back while the job is pending", d)
+	}
+
+	script, err := os.ReadFile(filepath.Join(srv.Dir, "launch.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(script), "token="+launch.Token+"\n") {
+		t.Errorf("job script without the token %s:\n%s", launch.Token, script)
+	}
+	m := launchIDRegexp.FindSubmatch(script)
+	if m == nil {
+		t.Fatalf("job script without its launch info:\n%s", script)
+	}
+
+	p := proxies.get(launch.Proxy.ID)
+	if p == nil || p.SlurmJob == nil || p.SlurmJob.JobID != "4242" || p.Resolver == nil {
+		t.Fatalf("proxy = %+v, want pending with the job 4242", p)
+	}
+	if !p.Access.Enabled() || !p.Access.QueryTokens[0].Verify(launch.Token) {
+		t.Fatalf("proxy access = %+v, want the launch token", p.Access)
+	}
+
+	// the access is checked before the job
+	res, err := newClient(t, s).Get("http://" + launch.Proxy.ID + "/lab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET without token = %d, want %d", res.StatusCode, http.StatusUnauthorized)
+	}
+
+	client := newClient(t, s)
+	res, err = client.Get(launch.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("GET while pending = %d, want %d", res.StatusCode, http.StatusServiceUnavailable)
+	}
+
+	setJob(t, srv, "RUNNING", "127.0.0.1")
+	_, port, _ := net.SplitHostPort(app.Listener.Addr().String())
+	writeFile(t, srv, filepath.Join(".batproxy", "launch-"+string(m[1])+".json"), `{"node": "127.0.0.1", "port": `+port+`}`)
+
+	// the cookie lets the browser in from now on
+	u := "http://" + launch.Proxy.ID + "/lab?token=" + launch.Token
+	deadline := time.Now().Add(3 * LaunchPollInterval)
+	for {
+		res, err = client.Get(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode == http.StatusOK && string(body) == "app" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("GET = %d %q, want the application once started", res.StatusCode, body)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if query != "token="+launch.Token {
+		t.Errorf("application query = %q, want its token only", query)
+	}
+}
+
+func TestLaunchTimeout(t *testing.T) {
+	srv := sshtest.NewServer(t, nil)
+	fakeScheduler(t, srv)
+	setJob(t, srv, "PENDING", "(null)")
+
+	proxies := newMemProxies()
+	s := newTestServer(t, proxies)
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	launch := &batproxy.Launch{App: "rstudio", Proxy: sshProxy(srv, ""), Timeout: 1}
+	if err := s.Launcher().Launch(context.Background(), launch, batproxy.CreateProxyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for proxies.get(launch.Proxy.ID) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("the proxy of the application not started was not deleted")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	cancelled, _ := os.ReadFile(filepath.Join(srv.Dir, "cancelled"))
+	if string(cancelled) != "4242\n" {
+		t.Errorf("cancelled jobs = %q, want 4242", cancelled)
+	}
+}
+
+func TestSubmitCommandListening(t *testing.T) {
+	// the application tells its port, and listens once the test does
+	batproxy.Apps["test"] = &batproxy.App{Command: `echo "$port" > "$HOME/port"; sleep 60`}
+	defer delete(batproxy.Apps, "test")
+
+	home := t.TempDir()
+	bin := filepath.Join(home, "bin")
+	if err := os.Mkdir(bin, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// sbatch runs the job script in the background
+	sbatch := "#!/bin/sh\ncat > \"$HOME/job.sh\"\nbash \"$HOME/job.sh\" > \"$HOME/job.log\" 2>&1 &\necho $! > \"$HOME/job.pid\"\necho 4242\n"
+	if err := os.WriteFile(filepath.Join(bin, "sbatch"), []byte(sbatch), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("sh", "-c", submitCommand("0123456789abcdef", "secret", &batproxy.Launch{App: "test"}))
+	cmd.Env = append(os.Environ(), "HOME="+home, "PATH="+bin+":"+os.Getenv("PATH"))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("submit: %v: %s", err, out)
+	}
+	defer func() {
+		if pid, err := os.ReadFile(filepath.Join(home, "job.pid")); err == nil {
+			exec.Command("kill", strings.TrimSpace(string(pid))).Run()
+		}
+	}()
+
+	var port string
+	deadline := time.Now().Add(5 * time.Second)
+	for port == "" {
+		if b, err := os.ReadFile(filepath.Join(home, "port")); err == nil {
+			port = strings.TrimSpace(string(b))
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the application did not start")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	info := filepath.Join(home, ".batproxy", "launch-0123456789abcdef.json")
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := os.Stat(info); err == nil {
+		t.Fatal("launch info written before the application listens")
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:"+port)
+	if err != nil {
+		t.Skipf("port %s of the application: %v", port, err)
+	}
+	defer l.Close()
+
+	deadline = time.Now().Add(5 * time.Second)
+	for {
+		b, err := os.ReadFile(info)
+		if err == nil {
+			if !strings.Contains(string(b), `"port":`+port+`}`) {
+				t.Errorf("launch info = %s, want the port %s", b, port)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			log, _ := os.ReadFile(filepath.Join(home, "job.log"))
+			t.Fatalf("launch info not written once the application listens:\n%s", log)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestProxyURL(t *testing.T) {
+	tests := []struct {
+		name             string
+		reverseProxyAddr string
+		publicURL        string
+		pathRouting      bool
+		certificates     bool
+		acme             bool
+		want             string
+	}{
+		{
+			name:             "host",
+			reverseProxyAddr: ":8080",
+			want:             "http://abc:8080/lab",
+		},
+		{
+			name:             "host default port",
+			reverseProxyAddr: ":80",
+			want:             "http://abc/lab",
+		},
+		{
+			name:             "host tls",
+			reverseProxyAddr: ":443",
+			certificates:     true,
+			want:             "https://abc/lab",
+		},
+		{
+			name:             "host acme",
+			reverseProxyAddr: ":8443",
+			acme:             true,
+			want:             "https://abc:8443/lab",
+		},
+		{
+			name:             "public host",
+			reverseProxyAddr: ":8080",
+			publicURL:        "https://example.com:8443",
+			want:             "https://abc:8443/lab",
+		},
+		{
+			name:             "path",
+			reverseProxyAddr: "10.0.0.1:8080",
+			pathRouting:      true,
+			want:             "http://10.0.0.1:8080/p/abc/lab",
+		},
+		{
+			name:             "path all interfaces",
+			reverseProxyAddr: ":80",
+			pathRouting:      true,
+			want:             "http://localhost/p/abc/lab",
+		},
+		{
+			name:             "public path",
+			reverseProxyAddr: ":8080",
+			publicURL:        "https://example.com/batproxy/",
+			pathRouting:      true,
+			want:             "https://example.com/batproxy/p/abc/lab",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{
+				reverseProxyAddr: tt.reverseProxyAddr,
+				PublicURL:        tt.publicURL,
+				PathRouting:      tt.pathRouting,
+			}
+			if tt.certificates {
+				s.Certificates = &Certificates{}
+			}
+			if tt.acme {
+				s.ACME = &autocert.Manager{}
+			}
+			if got := s.proxyURL("abc", "/lab"); got != tt.want {
+				t.Errorf("proxyURL = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -36,6 +36,16 @@ func (s *Server) proxyService(ws *restful.WebService) {
 		Writes(batproxy.ListProxiesPage{}).
 		Returns(200, "OK", batproxy.ListProxiesPage{}))
 
+	ws.Route(ws.PUT("/proxies/{proxy_id}/access").To(s.updateProxyAccess).
+		Doc("replace the access of a reverse proxy, hashing its credentials").
+		Param(ws.PathParameter("proxy_id", "the id of the reverse proxy").
+			DataType("string").Required(true)).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Reads(batproxy.Access{}).
+		Writes(batproxy.Access{}).
+		Returns(200, "OK", batproxy.Access{}).
+		Returns(404, "NotFound", batproxy.Error{}))
+
 	ws.Route(ws.DELETE("/proxies/{proxy_id}").To(s.deleteProxy).
 		// docs
 		Doc("delete a reverse proxy").
@@ -68,6 +78,17 @@ func (s *Server) createProxy(req *restful.Request, res *restful.Response) {
 		return
 	}
 
+	if proxy.Type == batproxy.ProxyTCP {
+		if err := s.listenTCP(proxy); err != nil {
+			// the port is taken by something else, free it for a retry
+			if derr := s.ProxyService.DeleteProxy(req.Request.Context(), proxy.ID); derr != nil {
+				s.logger.Error("proxy", "proxy_id", proxy.ID, "err", derr)
+			}
+			Error(res.ResponseWriter, req.Request, err)
+			return
+		}
+	}
+
 	err := res.WriteHeaderAndEntity(http.StatusCreated, proxy)
 	if err != nil {
 		s.logger.Error("proxy", "err", err, "req", req.Request.URL)
@@ -98,11 +119,34 @@ func (s *Server) updateProxy(req *restful.Request, res *restful.Response) {
 	panic("implement me")
 }
 
+func (s *Server) updateProxyAccess(req *restful.Request, res *restful.Response) {
+	proxyID := req.PathParameter("proxy_id")
+
+	access := &batproxy.Access{}
+	if err := req.ReadEntity(access); err != nil {
+		Error(res.ResponseWriter, req.Request, batproxy.Errorf(batproxy.EINVALID, "%v", err))
+		return
+	}
+
+	if err := s.ProxyService.UpdateProxyAccess(req.Request.Context(), proxyID, access); err != nil {
+		Error(res.ResponseWriter, req.Request, err)
+		return
+	}
+
+	err := res.WriteEntity(access)
+	if err != nil {
+		s.logger.Error("proxy", "err", err, "req", req.Request.URL)
+	}
+}
+
 func (s *Server) deleteProxy(req *restful.Request, res *restful.Response) {
-	if err := s.ProxyService.DeleteProxy(req.Request.Context(), req.PathParameter("proxy_id")); err != nil {
+	proxyID := req.PathParameter("proxy_id")
+	if err := s.ProxyService.DeleteProxy(req.Request.Context(), proxyID); err != nil {
 		Error(res.ResponseWriter, req.Request, err)
 		return
 	}
+	s.evictTransports(proxyID)
+	s.closeTCP(proxyID)
 
 	res.WriteHeader(http.StatusNoContent)
 }
@@ -181,6 +225,38 @@ func (s *ProxyService) UpdateProxy(req *restful.Request, res *restful.Response)
 	panic("implement me")
 }
 
+func (s *ProxyService) UpdateProxyAccess(ctx context.Context, proxyID string, access *batproxy.Access) error {
+	if access == nil {
+		access = &batproxy.Access{}
+	}
+
+	body, err := json.Marshal(access)
+	if err != nil {
+		return batproxy.Errorf(batproxy.EINVALID, "json encode: %v", err)
+	}
+
+	req, err := s.Client.newRequest(ctx, "PUT",
+		"/api/v1beta1/proxies/"+proxyID+"/access",
+		bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("http new request: %v", err)
+	}
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	} else if res.StatusCode != http.StatusOK {
+		return parseResponseError(res)
+	}
+	defer res.Body.Close()
+
+	if err := json.NewDecoder(res.Body).Decode(access); err != nil {
+		return fmt.Errorf("json decode: %v", err)
+	}
+
+	return nil
+}
+
 func (s *ProxyService) DeleteProxy(ctx context.Context, proxyID string) error {
 	req, err := s.Client.newRequest(ctx, "DELETE",
 		"/api/v1beta1/proxies/"+proxyID+"?",
@@ -0,0 +1,201 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/batx-dev/batproxy"
+	"github.com/batx-dev/batproxy/memo"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// ResolveTimeout bounds the run of the command of a resolver.
+	ResolveTimeout = 30 * time.Second
+
+	// ResolveErrorExpiration is how long a failed resolution is remembered
+	// before the next request runs the command again.
+	ResolveErrorExpiration = 5 * time.Second
+
+	// ResolveIdleTimeout forgets the destinations of proxies nobody has
+	// requested for this long.
+	ResolveIdleTimeout = 10 * time.Minute
+)
+
+// resolveKey identifies a resolved destination, changing the resolver, the
+// slurm job or the login of a proxy resolves it again.
+type resolveKey struct {
+	ProxyID  string
+	Resolver batproxy.Resolver
+	SlurmJob batproxy.SlurmJob
+	SSH      key
+}
+
+// resolution is the destination found by a resolver.
+type resolution struct {
+	Node   string
+	Port   uint16
+	Socket string
+
+	expire time.Time
+}
+
+// resolvable reports whether the destination of p is found on its login
+// host.
+func resolvable(p *batproxy.Proxy) bool {
+	return p.Resolver != nil || p.SlurmJob != nil
+}
+
+func newResolveKey(p *batproxy.Proxy) resolveKey {
+	k := resolveKey{
+		ProxyID: p.ID,
+		SSH:     newKey(p),
+	}
+	if p.Resolver != nil {
+		k.Resolver = *p.Resolver
+	}
+	if p.SlurmJob != nil {
+		k.SlurmJob = *p.SlurmJob
+	}
+	return k
+}
+
+func (s *Server) resolveFunc(logger *slog.Logger) memo.Func[resolveKey, *resolution] {
+	return func(ctx context.Context, key resolveKey, cleanup func()) (*resolution, error) {
+		ctx, cancel := context.WithTimeout(ctx, ResolveTimeout)
+		defer cancel()
+
+		sc, release, err := s.memo.Acquire(ctx, key.SSH)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+
+		p := &batproxy.Proxy{ID: key.ProxyID}
+		expiration := key.Resolver.Expiration()
+
+		// the resolver of a slurm job runs once the job does
+		if key.SlurmJob.JobID != "" {
+			out, err := sc.Output(ctx, key.SlurmJob.Command())
+			if err != nil {
+				return nil, err
+			}
+			if err := key.SlurmJob.Resolve(p, out); err != nil {
+				return nil, err
+			}
+			expiration = key.SlurmJob.Expiration()
+		}
+
+		if key.Resolver.Command != "" {
+			out, err := sc.Output(ctx, key.Resolver.Command)
+			if err != nil {
+				return nil, err
+			}
+			if key.SlurmJob.JobID != "" && len(bytes.TrimSpace(out)) == 0 {
+				return nil, batproxy.Errorf(batproxy.EJOBPENDING, "slurm job %s of %s runs, its application has not started", key.SlurmJob.JobID, key.ProxyID)
+			}
+			if err := key.Resolver.Resolve(p, out); err != nil {
+				return nil, err
+			}
+		}
+
+		logger.Info("resolve",
+			"proxy_id", key.ProxyID,
+			"node", p.Node,
+			"port", p.Port,
+			"socket", p.Socket,
+		)
+
+		return &resolution{
+			Node:   p.Node,
+			Port:   p.Port,
+			Socket: p.Socket,
+			expire: time.Now().Add(expiration),
+		}, nil
+	}
+}
+
+// resolve returns a copy of p with the destination found by its resolver or
+// its slurm job, running the command once the previous destination expired.
+// The proxy of an ended slurm job expiring with it is deleted.
+func (s *Server) resolve(ctx context.Context, p *batproxy.Proxy) (*batproxy.Proxy, error) {
+	k := newResolveKey(p)
+
+	r, err := s.resolutions.Get(ctx, k)
+	if err == nil && time.Now().After(r.expire) {
+		s.resolutions.Evict(k)
+		r, err = s.resolutions.Get(ctx, k)
+	}
+	if err != nil {
+		if batproxy.ErrorCode(err) == batproxy.EJOBENDED && p.SlurmJob != nil && p.SlurmJob.Expire {
+			s.expire(ctx, p)
+		}
+		return nil, err
+	}
+
+	resolved := *p
+	resolved.Node = r.Node
+	if p.SlurmJob == nil || p.Resolver != nil {
+		resolved.Port, resolved.Socket = r.Port, r.Socket
+	}
+	return &resolved, nil
+}
+
+// expire deletes p, its slurm job has ended.
+func (s *Server) expire(ctx context.Context, p *batproxy.Proxy) {
+	if err := s.ProxyService.DeleteProxy(ctx, p.ID); err != nil {
+		if batproxy.ErrorCode(err) != batproxy.ENOTFOUND {
+			s.logger.Error("expire", "proxy_id", p.ID, "err", err)
+		}
+		return
+	}
+	s.evictTransports(p.ID)
+	s.closeTCP(p.ID)
+	s.logger.Info("expire", "proxy_id", p.ID, "job_id", p.SlurmJob.JobID)
+}
+
+// pollJobs checks the slurm jobs of the proxies expiring with them every
+// interval, until ctx is done.
+func (s *Server) pollJobs(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		opts := batproxy.ListProxiesOptions{}
+		for {
+			page, err := s.ProxyService.ListProxies(ctx, opts)
+			if err != nil {
+				s.logger.Error("poll jobs", "err", err)
+				break
+			}
+			for _, p := range page.Proxies {
+				if p.SlurmJob != nil && p.SlurmJob.Expire {
+					_, _ = s.resolve(ctx, p)
+				}
+			}
+			if page.NextPageToken == "" {
+				break
+			}
+			opts.PageToken = page.NextPageToken
+		}
+	}
+}
+
+// unresolve forgets the destination of p, e.g. after the remote application
+// restarted elsewhere.
+func (s *Server) unresolve(p *batproxy.Proxy) {
+	if !resolvable(p) {
+		return
+	}
+	if s.resolutions.Evict(newResolveKey(p)) {
+		s.logger.Info("unresolve", "proxy_id", p.ID)
+		s.evictTransports(p.ID)
+	}
+}
@@ -0,0 +1,202 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/batx-dev/batproxy"
+	"github.com/batx-dev/batproxy/internal/sshtest"
+)
+
+// writeFile writes content to name in the directory of srv.
+func writeFile(t *testing.T, srv *sshtest.Server, name, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(srv.Dir, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResolveResolver(t *testing.T) {
+	srv := sshtest.NewServer(t, nil)
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "app")
+	}))
+	defer app.Close()
+	host, port, _ := net.SplitHostPort(app.Listener.Addr().String())
+
+	p := sshProxy(srv, "resolved")
+	p.Resolver = &batproxy.Resolver{Command: "cat app.json"}
+	proxies := newMemProxies(p)
+	s := newTestServer(t, proxies)
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	writeFile(t, srv, "app.json", fmt.Sprintf(`{"node": %q, "port": %s}`, host, port))
+	res := get(t, s, "resolved")
+	if res.StatusCode != http.StatusOK || res.body != "app" {
+		t.Fatalf("GET = %d %q, want the application", res.StatusCode, res.body)
+	}
+
+	// the destination is kept until it expires or fails
+	writeFile(t, srv, "app.json", `{"node": "cn01", "port": 1}`)
+	r, err := s.resolve(context.Background(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Node != host || fmt.Sprint(r.Port) != port {
+		t.Errorf("resolve = %s:%d, want the memoized %s:%s", r.Node, r.Port, host, port)
+	}
+
+	s.unresolve(p)
+	if r, err = s.resolve(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+	if r.Node != "cn01" || r.Port != 1 {
+		t.Errorf("resolve = %s:%d, want cn01:1 once unresolved", r.Node, r.Port)
+	}
+
+	// the failures are remembered for ResolveErrorExpiration only
+	q := sshProxy(srv, "unresolved")
+	q.Resolver = &batproxy.Resolver{Command: "echo starting"}
+	if _, err := s.resolve(context.Background(), q); batproxy.ErrorCode(err) != batproxy.EBADGATEWAY {
+		t.Errorf("resolve = %v, want %s", err, batproxy.EBADGATEWAY)
+	}
+}
+
+// response is a response with its body read.
+type response struct {
+	*http.Response
+	body string
+}
+
+// get requests the proxy of id on the reverse proxy of s, routed by host.
+func get(t *testing.T, s *Server, id string) *response {
+	t.Helper()
+
+	req, err := http.NewRequest("GET", "http://"+s.reverseProxyListen.Addr().String()+"/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = id
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &response{Response: res, body: string(body)}
+}
+
+// scontrol prints the jobs of a fake slurm controller: 100 runs on
+// 127.0.0.1, 101 is pending, 102 has completed and the others are unknown.
+const scontrol = `#!/bin/sh
+case "$4" in
+100) echo "JobId=100 JobName=app JobState=RUNNING Reason=None BatchHost=127.0.0.1" ;;
+101) echo "JobId=101 JobName=app JobState=PENDING Reason=Priority BatchHost=(null)" ;;
+102) echo "JobId=102 JobName=app JobState=COMPLETED Reason=None BatchHost=127.0.0.1" ;;
+*) echo "slurm_load_jobs error: Invalid job id specified" >&2; exit 1 ;;
+esac
+`
+
+func TestResolveSlurmJob(t *testing.T) {
+	srv := sshtest.NewServer(t, nil)
+	srv.WriteScript(t, "scontrol", scontrol)
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "app")
+	}))
+	defer app.Close()
+	port := uint16(app.Listener.Addr().(*net.TCPAddr).Port)
+
+	job := func(id, jobID string, expire bool) *batproxy.Proxy {
+		p := sshProxy(srv, id)
+		p.Port = port
+		p.SlurmJob = &batproxy.SlurmJob{JobID: jobID, Expire: expire}
+		return p
+	}
+	proxies := newMemProxies(
+		job("running", "100", false),
+		job("pending", "101", true),
+		job("completed", "102", false),
+		job("expired", "102", true),
+		job("forgotten", "103", true),
+	)
+	s := newTestServer(t, proxies)
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		id     string
+		status int
+		kept   bool // the proxy after the request
+	}{
+		{id: "running", status: http.StatusOK, kept: true},
+		{id: "pending", status: http.StatusServiceUnavailable, kept: true},
+		{id: "completed", status: http.StatusNotFound, kept: true},
+		{id: "expired", status: http.StatusNotFound},
+		{id: "forgotten", status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			res := get(t, s, tt.id)
+			if res.StatusCode != tt.status {
+				t.Errorf("GET = %d %q, want %d", res.StatusCode, res.body, tt.status)
+			}
+			if kept := proxies.get(tt.id) != nil; kept != tt.kept {
+				t.Errorf("proxy kept = %v, want %v", kept, tt.kept)
+			}
+		})
+	}
+}
+
+func TestPollJobs(t *testing.T) {
+	srv := sshtest.NewServer(t, nil)
+	srv.WriteScript(t, "scontrol", scontrol)
+
+	job := func(id, jobID string, expire bool) *batproxy.Proxy {
+		p := sshProxy(srv, id)
+		p.Port = 8888
+		p.SlurmJob = &batproxy.SlurmJob{JobID: jobID, Expire: expire}
+		return p
+	}
+	proxies := newMemProxies(
+		job("running", "100", true),
+		job("pending", "101", true),
+		job("suspended", "102", false),
+		job("expired", "102", true),
+	)
+	s := newTestServer(t, proxies)
+	s.JobPollInterval = 10 * time.Millisecond
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for proxies.get("expired") != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("the proxy of the ended job was not deleted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, id := range []string{"running", "pending", "suspended"} {
+		if proxies.get(id) == nil {
+			t.Errorf("proxy %s deleted, want kept", id)
+		}
+	}
+}
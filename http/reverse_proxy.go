@@ -1,80 +1,136 @@
 package http
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"strconv"
-	"strings"
-	"time"
 
 	"github.com/batx-dev/batproxy"
 )
 
 func (s *Server) reverseProxy(w http.ResponseWriter, req *http.Request) {
 	defer req.Body.Close()
-	reverseProxy, err := s.newReverseProxy(req)
+	// the relative URLs of the applications resolve under the prefix only
+	// with the trailing slash
+	if _, prefix := s.route(req); prefix != "" && req.URL.Path == prefix {
+		u := *req.URL
+		u.Path, u.RawPath = prefix+"/", ""
+		http.Redirect(w, req, u.RequestURI(), http.StatusFound)
+		return
+	}
+	p, prefix, err := s.lookupProxy(req)
 	if err != nil {
 		Error(w, req, err)
 		return
 	}
+	if !s.authorize(w, req, p, prefix) {
+		return
+	}
+	reverseProxy, release, err := s.newReverseProxy(req, p, prefix)
+	if err != nil {
+		Error(w, req, err)
+		return
+	}
+	defer release()
 	reverseProxy.ServeHTTP(w, req)
 }
 
-func (s *Server) newReverseProxy(req *http.Request) (*httputil.ReverseProxy, error) {
-	ctx := req.Context()
-
-	proxyID := strings.Split(req.Host, ":")[0]
+// lookupProxy returns the proxy req is routed to, and the path prefix
+// selecting it when routed by path.
+func (s *Server) lookupProxy(req *http.Request) (_ *batproxy.Proxy, prefix string, err error) {
+	proxyID, prefix := s.route(req)
+	if proxyID == "" {
+		return nil, "", batproxy.Errorf(batproxy.ENOTFOUND, "invalid proxy")
+	}
 
-	ps, err := s.ProxyService.ListProxies(ctx, batproxy.ListProxiesOptions{
+	ps, err := s.ProxyService.ListProxies(req.Context(), batproxy.ListProxiesOptions{
 		ProxyID: proxyID,
 	})
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	if len(ps.Proxies) == 0 {
-		return nil, batproxy.Errorf(batproxy.ENOTFOUND, "invalid proxy")
+		return nil, "", batproxy.Errorf(batproxy.ENOTFOUND, "invalid proxy")
 	}
 
 	p := ps.Proxies[0]
+	if p.Type == batproxy.ProxyTCP {
+		return nil, "", batproxy.Errorf(batproxy.ENOTFOUND, "invalid proxy")
+	}
+
+	return p, prefix, nil
+}
 
-	k := key{
-		User:       p.User,
-		Host:       p.Host,
-		PrivateKey: p.PrivateKey,
-		Passphrase: p.Passphrase,
-		Password:   p.Password,
+// newReverseProxy returns the reverse proxy of req to p, with its transport
+// held until release is called.
+func (s *Server) newReverseProxy(req *http.Request, p *batproxy.Proxy, prefix string) (_ *httputil.ReverseProxy, release func(), err error) {
+	ctx := req.Context()
+
+	if resolvable(p) {
+		if p, err = s.resolve(ctx, p); err != nil {
+			return nil, nil, err
+		}
 	}
 
 	target := p.Node + ":" + strconv.Itoa(int(p.Port))
+	if p.Socket != "" {
+		target = "localhost"
+	}
 
-	sc, err := s.memo.Get(ctx, k)
-	if err != nil {
-		return nil, err
+	scheme, basePath := batproxy.TargetHTTP, ""
+	if p.Target != nil {
+		if p.Target.Scheme != "" {
+			scheme = p.Target.Scheme
+		}
+		basePath = p.Target.BasePath
 	}
 
-	target = "http://" + target
+	parse, err := url.Parse(scheme + "://" + target + basePath)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	parse, err := url.Parse(target)
+	t, release, err := s.transports.Acquire(ctx, newTransportKey(p))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	rp := httputil.NewSingleHostReverseProxy(parse)
+	rp.Transport = t
+
+	director := rp.Director
+	rp.Director = func(req *http.Request) {
+		if prefix != "" {
+			stripPrefix(req, prefix)
+		}
+		director(req)
+		// the applications build their absolute URLs with the scheme
+		// the users see
+		if req.TLS != nil {
+			req.Header.Set("X-Forwarded-Proto", "https")
+		}
+	}
 
-	rp.Transport = &http.Transport{
-		DialContext:           sc.DialContext,
-		ForceAttemptHTTP2:     true,
-		MaxIdleConns:          100,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
+	if prefix != "" || basePath != "" {
+		rp.ModifyResponse = func(res *http.Response) error {
+			rewriteResponse(res, basePath, prefix)
+			return nil
+		}
 	}
 
-	rp.ErrorHandler = s.reverseProxyHandlerError
+	rp.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+		// the remote application may have moved, resolve it again
+		if !errors.Is(err, context.Canceled) {
+			s.unresolve(p)
+		}
+		s.reverseProxyHandlerError(w, req, err)
+	}
 
-	return rp, nil
+	return rp, release, nil
 }
 
 func (s *Server) reverseProxyHandlerError(w http.ResponseWriter, req *http.Request, err error) {
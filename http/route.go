@@ -0,0 +1,97 @@
+package http
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// PathRoutePrefix is the path prefix of the requests routed by path, as
+// /p/{proxy_id}/..., for the deployments without wildcard DNS.
+const PathRoutePrefix = "/p/"
+
+// route returns the proxy id of req, empty if none, and the path prefix
+// selecting it when routed by path.
+func (s *Server) route(req *http.Request) (proxyID string, prefix string) {
+	if !s.PathRouting {
+		return strings.Split(req.Host, ":")[0], ""
+	}
+	if !strings.HasPrefix(req.URL.Path, PathRoutePrefix) {
+		return "", ""
+	}
+	proxyID, _, _ = strings.Cut(strings.TrimPrefix(req.URL.Path, PathRoutePrefix), "/")
+	if proxyID == "" {
+		return "", ""
+	}
+	return proxyID, PathRoutePrefix + proxyID
+}
+
+// stripPrefix removes prefix from the path of req, telling the destination
+// about it with X-Forwarded-Prefix.
+func stripPrefix(req *http.Request, prefix string) {
+	req.URL.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(req.URL.Path, prefix), "/")
+	if req.URL.RawPath != "" {
+		req.URL.RawPath = "/" + strings.TrimPrefix(strings.TrimPrefix(req.URL.RawPath, prefix), "/")
+	}
+	req.Header.Set("X-Forwarded-Prefix", prefix)
+}
+
+// rewriteResponse maps the paths of the redirects and the cookies of res
+// back to the ones the users see, stripping the base path of the target and
+// adding the prefix of the route, so the applications keep working.
+func rewriteResponse(res *http.Response, basePath string, prefix string) {
+	if location := res.Header.Get("Location"); location != "" {
+		res.Header.Set("Location", rewriteLocation(location, res.Request.Host, basePath, prefix))
+	}
+
+	cookies := res.Header.Values("Set-Cookie")
+	for i, cookie := range cookies {
+		cookies[i] = rewriteCookiePath(cookie, basePath, prefix)
+	}
+}
+
+// rewritePath strips basePath from the absolute path p, and adds prefix.
+func rewritePath(p string, basePath string, prefix string) string {
+	if basePath = strings.TrimSuffix(basePath, "/"); basePath != "" {
+		if p == basePath {
+			p = "/"
+		} else if strings.HasPrefix(p, basePath+"/") {
+			p = strings.TrimPrefix(p, basePath)
+		}
+	}
+	return prefix + p
+}
+
+// rewriteLocation rewrites the path of location if it is an absolute path,
+// or a URL of host.
+func rewriteLocation(location string, host string, basePath string, prefix string) string {
+	u, err := url.Parse(location)
+	if err != nil || !strings.HasPrefix(u.Path, "/") {
+		return location
+	}
+	if u.Host != "" && !strings.EqualFold(u.Host, host) {
+		return location
+	}
+	u.Path = rewritePath(u.Path, basePath, prefix)
+	if u.RawPath != "" {
+		u.RawPath = rewritePath(u.RawPath, basePath, prefix)
+	}
+	return u.String()
+}
+
+// rewriteCookiePath rewrites the path attribute of the Set-Cookie header
+// value cookie, keeping its other attributes as they are.
+func rewriteCookiePath(cookie string, basePath string, prefix string) string {
+	parts := strings.Split(cookie, ";")
+	for i, part := range parts {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || i == 0 || !strings.EqualFold(name, "path") {
+			continue
+		}
+		if !strings.HasPrefix(value, "/") {
+			continue
+		}
+		parts[i] = " Path=" + rewritePath(value, basePath, prefix)
+	}
+	return strings.Join(parts, ";")
+}
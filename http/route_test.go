@@ -0,0 +1,114 @@
+package http
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/batx-dev/batproxy"
+	"github.com/batx-dev/batproxy/internal/sshtest"
+)
+
+func TestRewriteLocation(t *testing.T) {
+	tests := []struct {
+		name     string
+		location string
+		basePath string
+		prefix   string
+		want     string
+	}{
+		{name: "prefix", location: "/login?next=%2F", prefix: "/p/abc", want: "/p/abc/login?next=%2F"},
+		{name: "base path", location: "/lab/tree", basePath: "/lab", want: "/tree"},
+		{name: "base path root", location: "/lab", basePath: "/lab/", want: "/"},
+		{name: "base path and prefix", location: "/lab/tree", basePath: "/lab", prefix: "/p/abc", want: "/p/abc/tree"},
+		{name: "outside base path", location: "/laboratory", basePath: "/lab", want: "/laboratory"},
+		{name: "same host", location: "http://abc.example.com/lab/tree", basePath: "/lab", want: "http://abc.example.com/tree"},
+		{name: "other host", location: "https://sso.example.com/lab/login", basePath: "/lab", prefix: "/p/abc", want: "https://sso.example.com/lab/login"},
+		{name: "relative", location: "tree", basePath: "/lab", prefix: "/p/abc", want: "tree"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rewriteLocation(tt.location, "abc.example.com", tt.basePath, tt.prefix); got != tt.want {
+				t.Errorf("rewriteLocation = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteCookiePath(t *testing.T) {
+	tests := []struct {
+		name     string
+		cookie   string
+		basePath string
+		prefix   string
+		want     string
+	}{
+		{name: "prefix", cookie: "sid=1; Path=/; HttpOnly", prefix: "/p/abc", want: "sid=1; Path=/p/abc/; HttpOnly"},
+		{name: "base path", cookie: "sid=1; path=/lab", basePath: "/lab", want: "sid=1; Path=/"},
+		{name: "base path and prefix", cookie: "sid=1; Path=/lab/api; Secure", basePath: "/lab", prefix: "/p/abc", want: "sid=1; Path=/p/abc/api; Secure"},
+		{name: "no path", cookie: "sid=1; HttpOnly", basePath: "/lab", prefix: "/p/abc", want: "sid=1; HttpOnly"},
+		{name: "value named path", cookie: "path=/lab", basePath: "/lab", want: "path=/lab"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rewriteCookiePath(tt.cookie, tt.basePath, tt.prefix); got != tt.want {
+				t.Errorf("rewriteCookiePath = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReverseProxyBasePath(t *testing.T) {
+	srv := sshtest.NewServer(t, nil)
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/lab/":
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "1", Path: "/lab"})
+			http.Redirect(w, r, "/lab/tree", http.StatusFound)
+		case "/lab/tree":
+			io.WriteString(w, "tree")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer app.Close()
+
+	p := sshProxy(srv, "abc")
+	p.Node, p.Port = "127.0.0.1", uint16(app.Listener.Addr().(*net.TCPAddr).Port)
+	p.Target = &batproxy.Target{BasePath: "/lab"}
+	s := newTestServer(t, newMemProxies(p))
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	client := newClient(t, s)
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	res, err := client.Get("http://abc/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if location := res.Header.Get("Location"); location != "/tree" {
+		t.Errorf("Location = %s, want /tree", location)
+	}
+	if cookies := res.Cookies(); len(cookies) != 1 || cookies[0].Path != "/" {
+		t.Errorf("cookies = %v, want the path / of the users", cookies)
+	}
+
+	res, err = client.Get("http://abc/tree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "tree" {
+		t.Errorf("GET redirect = %d %q, want tree", res.StatusCode, body)
+	}
+}
@@ -2,10 +2,12 @@ package http
 
 import (
 	"context"
+	"crypto/tls"
 	"net"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/batx-dev/batproxy"
@@ -14,6 +16,8 @@ import (
 	"github.com/batx-dev/batproxy/ssh"
 	"github.com/emicklei/go-restful/v3"
 	"github.com/felixge/httpsnoop"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
 	"golang.org/x/exp/slog"
 )
 
@@ -23,6 +27,17 @@ const ShutdownTimeout = 1 * time.Second
 type Server struct {
 	memo *memo.Memo[key, *ssh.Ssh]
 
+	// transports memoizes the transports to the destinations of the proxies.
+	transports *memo.Memo[transportKey, *transport]
+
+	// resolutions memoizes the destinations found by the resolvers.
+	resolutions *memo.Memo[resolveKey, *resolution]
+
+	// ctx is done once the server closes, cancel stops the background work
+	// of the server.
+	ctx    context.Context
+	cancel context.CancelFunc
+
 	logger *slog.Logger
 
 	managerListen net.Listener
@@ -33,19 +48,186 @@ type Server struct {
 	reverseProxyServer *http.Server
 	reverseProxyAddr   string
 
+	redirectListen net.Listener
+	redirectServer *http.Server
+
+	tcpMu        sync.Mutex              // guards tcpListeners
+	tcpListeners map[string]*tcpListener // listeners of the tcp proxies by id
+
 	ProxyService batproxy.ProxyService
+
+	// CacheService is optional, the cache endpoints answer not implemented
+	// without it.
+	CacheService batproxy.CacheService
+
+	// KnownHostService is optional, the known host endpoints answer not
+	// implemented without it.
+	KnownHostService batproxy.KnownHostService
+
+	// BreakerService is optional, the breaker endpoints answer not
+	// implemented without it.
+	BreakerService batproxy.BreakerService
+
+	// Breakers fail the dials fast while a login host cannot be reached.
+	// If nil, every dial tries the host.
+	Breakers *ssh.Breakers
+
+	// ConnectionService is optional, the connection endpoints answer not
+	// implemented without it.
+	ConnectionService batproxy.ConnectionService
+
+	// Connections tracks the live ssh connections.
+	// If nil, they are not tracked.
+	Connections *ssh.Connections
+
+	// LaunchService is optional, the launch endpoint answers not
+	// implemented without it.
+	LaunchService batproxy.LaunchService
+
+	// HostKeys verifies the host keys of ssh servers.
+	// If nil, any host key is accepted unless pinned by the proxy.
+	HostKeys *ssh.HostKeys
+
+	// Agent signs for the proxies authenticating with the ssh-agent.
+	// If nil, they fail to dial.
+	Agent *ssh.Agent
+
+	// CA signs the certificates of the proxies authenticating with one.
+	// If nil, they fail to dial.
+	CA *ssh.CertificateAuthority
+
+	// PromptRules answer the keyboard-interactive prompts of ssh servers,
+	// before ssh.DefaultPromptRules.
+	PromptRules []*ssh.PromptRule
+
+	// IdleTimeout closes ssh connections nobody has used for this long.
+	// Zero keeps them until they break.
+	IdleTimeout time.Duration
+
+	// MaxConns bounds the number of login hosts kept connected, each with
+	// up to PoolSize ssh connections, closing the least recently used idle
+	// one first. Zero means no bound.
+	MaxConns int
+
+	// Upstream is the SOCKS5 or HTTP CONNECT proxy to reach the ssh servers
+	// through, unless the proxy has its own. Empty dials them directly.
+	Upstream string
+
+	// SSHOptions are the default connection settings of the ssh
+	// connections, overridden by the ones of each proxy.
+	SSHOptions batproxy.SSHOptions
+
+	// PoolSize bounds the number of ssh connections to a login host.
+	// Zero means ssh.DefaultPoolSize.
+	PoolSize int
+
+	// PoolIdleTimeout closes the extra ssh connections to a login host
+	// without streams for this long. Zero means ssh.DefaultPoolIdleTimeout.
+	PoolIdleTimeout time.Duration
+
+	// TransportMaxIdleConns bounds the number of idle streams kept to the
+	// destination of a proxy. Zero means DefaultTransportMaxIdleConns.
+	TransportMaxIdleConns int
+
+	// TransportIdleTimeout closes the idle streams to the destination of a
+	// proxy after this long, and the transport to it once it has none.
+	// Zero means DefaultTransportIdleTimeout.
+	TransportIdleTimeout time.Duration
+
+	// Certificates terminates TLS on the reverse proxy listener.
+	Certificates *Certificates
+
+	// ACME obtains the certificates of the proxies not covered by
+	// Certificates, through TLS-ALPN-01 on the reverse proxy listener or
+	// HTTP-01 on the redirect one. Its HostPolicy should be the one of the
+	// server. If both are nil, the reverse proxy serves plain http.
+	ACME *autocert.Manager
+
+	// CertificatesReloadInterval checks the certificate files for changes
+	// this often. Zero means DefaultCertificatesReloadInterval.
+	CertificatesReloadInterval time.Duration
+
+	// RedirectAddr listens for http requests redirected to the https
+	// reverse proxy. Empty disables it.
+	RedirectAddr string
+
+	// PublicURL is the URL users reach the reverse proxy with, the URLs of
+	// the launched applications replace its host by the proxy id, or add
+	// the path prefix of the proxy with PathRouting. Empty means http, or
+	// https with Certificates or ACME, on the port of the reverse proxy
+	// address, and on its host with PathRouting.
+	PublicURL string
+
+	// TCPHost is the host the tcp proxies listen on, all the interfaces if
+	// empty.
+	TCPHost string
+
+	// TCPSyncInterval syncs the tcp listeners with the ProxyService this
+	// often, for the tcp proxies created or deleted through the other
+	// replicas. Zero syncs them on Open only.
+	TCPSyncInterval time.Duration
+
+	// PathRouting routes the requests of /p/{proxy_id}/... by path instead
+	// of by host, stripping the prefix, for the deployments without
+	// wildcard DNS.
+	PathRouting bool
+
+	// AccessSecret signs the access cookies of the proxies, shared by the
+	// replicas so that they accept the cookies of each other. NewServer
+	// sets a random one, valid until the server exits.
+	AccessSecret []byte
+
+	// JobPollInterval checks the slurm jobs of the proxies expiring with them
+	// this often, deleting the proxies of the ended ones. Zero checks them
+	// on requests only.
+	JobPollInterval time.Duration
 }
 
 func NewServer(reverseProxyAddr, managerAddr string, l *slog.Logger) (*Server, error) {
-	return &Server{
-		memo:             memo.New(sshFunc(logger.New(logger.Options{}).With("module", "ssh"))),
+	s := &Server{
 		logger:           l,
 		managerAddr:      managerAddr,
 		reverseProxyAddr: reverseProxyAddr,
-	}, nil
+		tcpListeners:     make(map[string]*tcpListener),
+	}
+
+	var err error
+	if s.AccessSecret, err = newAccessSecret(); err != nil {
+		return nil, err
+	}
+
+	s.memo = memo.New(s.sshFunc(logger.New(logger.Options{}).With("module", "ssh")))
+	s.memo.OnEvict = func(key key, sc *ssh.Ssh) {
+		l.Info("evict ssh", "key", key.String())
+		// the transports would dial again through the closed connection
+		s.transports.EvictFunc(func(k transportKey) bool { return k.SSH == key })
+		_ = sc.Close()
+	}
+
+	s.transports = memo.New(s.transportFunc())
+	s.transports.OnEvict = func(key transportKey, t *transport) {
+		t.CloseIdleConnections()
+		t.release()
+	}
+
+	s.resolutions = memo.New(s.resolveFunc(l))
+	s.resolutions.ErrorExpiration = ResolveErrorExpiration
+	s.resolutions.IdleTimeout = ResolveIdleTimeout
+
+	return s, nil
 }
 
 func (s *Server) Open() (err error) {
+	s.memo.IdleTimeout = s.IdleTimeout
+	s.memo.MaxEntries = s.MaxConns
+	s.transports.IdleTimeout = s.transportIdleTimeout()
+
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	ctx := s.ctx
+	if s.JobPollInterval > 0 {
+		go s.pollJobs(ctx, s.JobPollInterval)
+	}
+
 	// listen reverse reverseProxy address
 	{
 		s.reverseProxyServer = &http.Server{}
@@ -56,11 +238,53 @@ func (s *Server) Open() (err error) {
 			return err
 		}
 
+		if s.Certificates != nil {
+			interval := s.CertificatesReloadInterval
+			if interval <= 0 {
+				interval = DefaultCertificatesReloadInterval
+			}
+			go s.Certificates.Watch(ctx, interval)
+		}
+
+		if s.Certificates != nil || s.ACME != nil {
+			s.reverseProxyServer.TLSConfig = &tls.Config{
+				GetCertificate: s.getCertificate,
+				NextProtos:     []string{"h2", "http/1.1", acme.ALPNProto},
+				MinVersion:     tls.VersionTLS12,
+			}
+			go func() {
+				s.reverseProxyServer.ServeTLS(s.reverseProxyListen, "", "")
+			}()
+		} else {
+			go func() {
+				s.reverseProxyServer.Serve(s.reverseProxyListen)
+			}()
+		}
+	}
+
+	// listen http redirect address
+	if s.RedirectAddr != "" {
+		_, port, _ := net.SplitHostPort(s.reverseProxyListen.Addr().String())
+		s.redirectServer = &http.Server{Handler: redirectHandler(port)}
+		if s.ACME != nil {
+			s.redirectServer.Handler = s.ACME.HTTPHandler(s.redirectServer.Handler)
+		}
+
+		if s.redirectListen, err = net.Listen("tcp", s.RedirectAddr); err != nil {
+			return err
+		}
+
 		go func() {
-			s.reverseProxyServer.Serve(s.reverseProxyListen)
+			s.redirectServer.Serve(s.redirectListen)
 		}()
 	}
 
+	// listen the ports of the tcp proxies
+	s.syncTCP(ctx)
+	if s.TCPSyncInterval > 0 {
+		go s.pollTCP(ctx, s.TCPSyncInterval)
+	}
+
 	// listen manager reverseProxy address
 	{
 		c := restful.NewContainer()
@@ -70,6 +294,11 @@ func (s *Server) Open() (err error) {
 			Produces(restful.MIME_JSON)
 
 		s.proxyService(corev1beta1)
+		s.cacheService(corev1beta1)
+		s.knownHostService(corev1beta1)
+		s.breakerService(corev1beta1)
+		s.connectionService(corev1beta1)
+		s.launchService(corev1beta1)
 
 		c.Add(corev1beta1)
 
@@ -93,6 +322,10 @@ func (s *Server) Open() (err error) {
 }
 
 func (s *Server) Close() error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
 	defer cancel()
 
@@ -104,6 +337,14 @@ func (s *Server) Close() error {
 		return err
 	}
 
+	if s.redirectServer != nil {
+		if err := s.redirectServer.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+
+	s.closeTCPs()
+
 	return nil
 }
 
@@ -0,0 +1,149 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/batx-dev/batproxy"
+	"github.com/batx-dev/batproxy/internal/sshtest"
+	"golang.org/x/exp/slog"
+)
+
+// testLogger discards the logs of the tests.
+var testLogger = slog.New(slog.NewTextHandler(io.Discard))
+
+// memProxies is a ProxyService keeping the proxies in memory.
+type memProxies struct {
+	mu      sync.Mutex
+	proxies map[string]*batproxy.Proxy
+}
+
+func newMemProxies(proxies ...*batproxy.Proxy) *memProxies {
+	s := &memProxies{proxies: make(map[string]*batproxy.Proxy)}
+	for _, p := range proxies {
+		s.proxies[p.ID] = p
+	}
+	return s
+}
+
+func (s *memProxies) CreateProxy(ctx context.Context, p *batproxy.Proxy, opts batproxy.CreateProxyOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := p.Validate(); err != nil {
+		return batproxy.Errorf(batproxy.EINVALID, "%v", err)
+	}
+	if p.ID == "" {
+		p.ID = "p" + strconv.Itoa(len(s.proxies))
+	}
+	if _, ok := s.proxies[p.ID]; ok {
+		return batproxy.Errorf(batproxy.ECONFLICT, "proxy %s exists", p.ID)
+	}
+	if p.Access != nil {
+		if err := p.Access.Hash(); err != nil {
+			return err
+		}
+	}
+	cp := *p
+	s.proxies[p.ID] = &cp
+	return nil
+}
+
+func (s *memProxies) ListProxies(ctx context.Context, opts batproxy.ListProxiesOptions) (*batproxy.ListProxiesPage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	page := &batproxy.ListProxiesPage{}
+	for id, p := range s.proxies {
+		if opts.ProxyID == "" || opts.ProxyID == id {
+			cp := *p
+			page.Proxies = append(page.Proxies, &cp)
+		}
+	}
+	sort.Slice(page.Proxies, func(i, j int) bool { return page.Proxies[i].ID < page.Proxies[j].ID })
+	return page, nil
+}
+
+func (s *memProxies) DeleteProxy(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.proxies[id]; !ok {
+		return batproxy.Errorf(batproxy.ENOTFOUND, "proxy %s not found", id)
+	}
+	delete(s.proxies, id)
+	return nil
+}
+
+func (s *memProxies) UpdateProxyAccess(ctx context.Context, id string, a *batproxy.Access) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.proxies[id]
+	if !ok {
+		return batproxy.Errorf(batproxy.ENOTFOUND, "proxy %s not found", id)
+	}
+	if a != nil {
+		if err := a.Hash(); err != nil {
+			return err
+		}
+	}
+	p.Access = a
+	return nil
+}
+
+func (s *memProxies) get(id string) *batproxy.Proxy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.proxies[id]
+}
+
+// newTestServer returns a server of proxies, not listening until opened.
+func newTestServer(t *testing.T, proxies *memProxies) *Server {
+	t.Helper()
+
+	s, err := NewServer("127.0.0.1:0", "tcp://127.0.0.1:0", testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ProxyService = proxies
+	return s
+}
+
+// sshProxy returns a proxy of id logging in to srv.
+func sshProxy(srv *sshtest.Server, id string) *batproxy.Proxy {
+	return &batproxy.Proxy{
+		ID:       id,
+		User:     "user",
+		Host:     srv.Addr,
+		Password: sshtest.Password,
+	}
+}
+
+// newClient returns a client keeping the cookies, sending the requests to
+// the reverse proxy of s whatever their host.
+func newClient(t *testing.T, s *Server) *http.Client {
+	t.Helper()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := s.reverseProxyListen.Addr().String()
+	return &http.Client{
+		Jar: jar,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		},
+	}
+}
@@ -0,0 +1,266 @@
+package http
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/batx-dev/batproxy"
+)
+
+// TCPDialTimeout is the time given to the destination of a tcp proxy to
+// accept a connection, once the ssh connection is up.
+const TCPDialTimeout = 30 * time.Second
+
+// tcpListener forwards the connections of the port of a tcp proxy to its
+// destination.
+type tcpListener struct {
+	net.Listener
+
+	port uint16
+
+	mu     sync.Mutex            // guards conns and closed
+	conns  map[net.Conn]struct{} // live connections
+	closed bool
+}
+
+// track records c to be closed with the listener, false if already closed.
+func (l *tcpListener) track(c net.Conn) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return false
+	}
+	l.conns[c] = struct{}{}
+	return true
+}
+
+func (l *tcpListener) untrack(c net.Conn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.conns, c)
+}
+
+// close stops listening and closes the live connections.
+func (l *tcpListener) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.closed = true
+	_ = l.Listener.Close()
+	for c := range l.conns {
+		_ = c.Close()
+	}
+}
+
+// listenTCP listens on the port allocated to the tcp proxy p.
+func (s *Server) listenTCP(p *batproxy.Proxy) error {
+	s.tcpMu.Lock()
+	defer s.tcpMu.Unlock()
+
+	if l, ok := s.tcpListeners[p.ID]; ok {
+		if l.port == p.ListenPort {
+			return nil
+		}
+		l.close()
+		delete(s.tcpListeners, p.ID)
+	}
+
+	ln, err := net.Listen("tcp", net.JoinHostPort(s.TCPHost, strconv.Itoa(int(p.ListenPort))))
+	if err != nil {
+		return batproxy.Errorf(batproxy.EUNAVAILABLE, "tcp proxy %s: %v", p.ID, err)
+	}
+
+	l := &tcpListener{
+		Listener: ln,
+		port:     p.ListenPort,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	s.tcpListeners[p.ID] = l
+	go s.serveTCP(l, p.ID)
+
+	s.logger.Info("tcp", "proxy_id", p.ID, "status", "listen", "port", p.ListenPort)
+	return nil
+}
+
+// TCPPortAvailable reports whether nothing listens on port of TCPHost yet,
+// so it can be allocated to a tcp proxy.
+func (s *Server) TCPPortAvailable(port uint16) bool {
+	ln, err := net.Listen("tcp", net.JoinHostPort(s.TCPHost, strconv.Itoa(int(port))))
+	if err != nil {
+		return false
+	}
+	_ = ln.Close()
+	return true
+}
+
+// closeTCP stops listening for the tcp proxy of proxyID, closing its
+// connections.
+func (s *Server) closeTCP(proxyID string) {
+	s.tcpMu.Lock()
+	defer s.tcpMu.Unlock()
+
+	if l, ok := s.tcpListeners[proxyID]; ok {
+		l.close()
+		delete(s.tcpListeners, proxyID)
+		s.logger.Info("tcp", "proxy_id", proxyID, "status", "close", "port", l.port)
+	}
+}
+
+// closeTCPs stops listening for all the tcp proxies.
+func (s *Server) closeTCPs() {
+	s.tcpMu.Lock()
+	defer s.tcpMu.Unlock()
+
+	for id, l := range s.tcpListeners {
+		l.close()
+		delete(s.tcpListeners, id)
+	}
+}
+
+// syncTCP listens for the tcp proxies of the ProxyService and stops
+// listening for the deleted ones, so that every replica serves the tcp
+// proxies created or deleted through the others, or before a restart.
+func (s *Server) syncTCP(ctx context.Context) {
+	ids := make(map[string]struct{})
+	opts := batproxy.ListProxiesOptions{}
+	for {
+		page, err := s.ProxyService.ListProxies(ctx, opts)
+		if err != nil {
+			// a partial listing would close the listeners of live proxies
+			s.logger.Error("tcp", "status", "sync", "err", err)
+			return
+		}
+		for _, p := range page.Proxies {
+			if p.Type != batproxy.ProxyTCP {
+				continue
+			}
+			ids[p.ID] = struct{}{}
+			if err := s.listenTCP(p); err != nil {
+				s.logger.Error("tcp", "proxy_id", p.ID, "status", "sync", "err", err)
+			}
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		opts.PageToken = page.NextPageToken
+	}
+
+	s.tcpMu.Lock()
+	var gone []string
+	for id := range s.tcpListeners {
+		if _, ok := ids[id]; !ok {
+			gone = append(gone, id)
+		}
+	}
+	s.tcpMu.Unlock()
+
+	for _, id := range gone {
+		s.closeTCP(id)
+	}
+}
+
+// pollTCP syncs the tcp listeners every interval until ctx is done.
+func (s *Server) pollTCP(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.syncTCP(ctx)
+	}
+}
+
+func (s *Server) serveTCP(l *tcpListener, proxyID string) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go s.forwardTCP(l, proxyID, c)
+	}
+}
+
+// forwardTCP copies the bytes between c and the destination of the proxy of
+// proxyID, until both sides are done.
+func (s *Server) forwardTCP(l *tcpListener, proxyID string, c net.Conn) {
+	defer c.Close()
+	if !l.track(c) {
+		return
+	}
+	defer l.untrack(c)
+
+	ctx := context.Background()
+
+	ps, err := s.ProxyService.ListProxies(ctx, batproxy.ListProxiesOptions{
+		ProxyID: proxyID,
+	})
+	if err != nil {
+		s.logger.Error("tcp", "proxy_id", proxyID, "remote", c.RemoteAddr(), "err", err)
+		return
+	}
+	if len(ps.Proxies) == 0 {
+		return
+	}
+	p := ps.Proxies[0]
+
+	if resolvable(p) {
+		if p, err = s.resolve(ctx, p); err != nil {
+			s.logger.Error("tcp", "proxy_id", proxyID, "remote", c.RemoteAddr(), "err", err)
+			return
+		}
+	}
+
+	sc, release, err := s.memo.Acquire(ctx, newKey(p))
+	if err != nil {
+		s.logger.Error("tcp", "proxy_id", proxyID, "remote", c.RemoteAddr(), "err", err)
+		return
+	}
+	defer release()
+
+	network, addr := "tcp", net.JoinHostPort(p.Node, strconv.Itoa(int(p.Port)))
+	if p.Socket != "" {
+		network, addr = "unix", p.Socket
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, TCPDialTimeout)
+	upstream, err := sc.DialContext(dialCtx, network, addr)
+	cancel()
+	if err != nil {
+		// the remote application may have moved, resolve it again
+		s.unresolve(p)
+		s.logger.Error("tcp", "proxy_id", proxyID, "remote", c.RemoteAddr(), "err", err)
+		return
+	}
+	defer upstream.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(upstream, c)
+		closeWrite(upstream)
+	}()
+	go func() {
+		defer wg.Done()
+		_, _ = io.Copy(c, upstream)
+		closeWrite(c)
+	}()
+	wg.Wait()
+}
+
+// closeWrite half-closes c if it can, telling its peer nothing more is sent.
+func closeWrite(c net.Conn) {
+	if cw, ok := c.(interface{ CloseWrite() error }); ok {
+		_ = cw.CloseWrite()
+	}
+}
@@ -0,0 +1,62 @@
+package http
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/batx-dev/batproxy"
+)
+
+// freePort returns a port nothing listens on.
+func freePort(t *testing.T) uint16 {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return uint16(ln.Addr().(*net.TCPAddr).Port)
+}
+
+// listening reports whether port accepts connections.
+func listening(port uint16) bool {
+	c, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(int(port))))
+	if err != nil {
+		return false
+	}
+	_ = c.Close()
+	return true
+}
+
+func TestSyncTCP(t *testing.T) {
+	ctx := context.Background()
+	proxies := newMemProxies()
+	s := newTestServer(t, proxies)
+	s.TCPHost = "127.0.0.1"
+	defer s.closeTCPs()
+
+	// created through another replica
+	p := &batproxy.Proxy{
+		ID: "db", Type: batproxy.ProxyTCP, User: "user1", Host: "login1",
+		Password: "123456", Node: "node1", Port: 5432, ListenPort: freePort(t),
+	}
+	if err := proxies.CreateProxy(ctx, p, batproxy.CreateProxyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	s.syncTCP(ctx)
+	if !listening(p.ListenPort) {
+		t.Fatalf("port %d of proxy %s not listened after sync", p.ListenPort, p.ID)
+	}
+
+	// deleted through another replica
+	if err := proxies.DeleteProxy(ctx, p.ID); err != nil {
+		t.Fatal(err)
+	}
+	s.syncTCP(ctx)
+	if listening(p.ListenPort) {
+		t.Errorf("port %d of deleted proxy %s still listened after sync", p.ListenPort, p.ID)
+	}
+}
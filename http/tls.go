@@ -0,0 +1,208 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// DefaultCertificatesReloadInterval is how often the certificate files are
+// checked for changes.
+const DefaultCertificatesReloadInterval = time.Minute
+
+// Certificates serves the certificates of the reverse proxy, selected by the
+// server name of the TLS handshake.
+type Certificates struct {
+	// CertFile and KeyFile are the default certificate, e.g. a wildcard one
+	// for the proxy id suffix. Optional if Dir has certificates.
+	CertFile string
+	KeyFile  string
+
+	// Dir holds the per proxy or per domain certificates as pairs of
+	// <name>.crt and <name>.key files, selected by the names they are valid
+	// for.
+	Dir string
+
+	Logger *slog.Logger
+
+	mu     sync.RWMutex                // guards def, names and mtimes
+	def    *tls.Certificate            // default certificate
+	names  map[string]*tls.Certificate // certificates of Dir by name
+	mtimes map[string]time.Time        // modification times of the loaded files
+}
+
+// Load reads the certificates from disk, replacing the loaded ones only if
+// all of them are valid.
+func (c *Certificates) Load() error {
+	mtimes := make(map[string]time.Time)
+
+	var def *tls.Certificate
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := loadCertificate(c.CertFile, c.KeyFile, mtimes)
+		if err != nil {
+			return err
+		}
+		def = cert
+	}
+
+	names := make(map[string]*tls.Certificate)
+	if c.Dir != "" {
+		files, err := filepath.Glob(filepath.Join(c.Dir, "*.crt"))
+		if err != nil {
+			return err
+		}
+		for _, certFile := range files {
+			cert, err := loadCertificate(certFile, strings.TrimSuffix(certFile, ".crt")+".key", mtimes)
+			if err != nil {
+				return err
+			}
+			for _, name := range cert.Leaf.DNSNames {
+				names[strings.ToLower(name)] = cert
+			}
+		}
+	}
+
+	if def == nil && len(names) == 0 {
+		return fmt.Errorf("tls: no certificate")
+	}
+
+	c.mu.Lock()
+	c.def, c.names, c.mtimes = def, names, mtimes
+	c.mu.Unlock()
+
+	return nil
+}
+
+// loadCertificate reads a certificate, and records the modification times of
+// its files in mtimes.
+func loadCertificate(certFile string, keyFile string, mtimes map[string]time.Time) (*tls.Certificate, error) {
+	for _, file := range []string{certFile, keyFile} {
+		fi, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("tls: %v", err)
+		}
+		mtimes[file] = fi.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("tls: %s: %v", certFile, err)
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return nil, fmt.Errorf("tls: %s: %v", certFile, err)
+	}
+	return &cert, nil
+}
+
+// GetCertificate returns the certificate of the server name of hello, the
+// exact name first, then its wildcard, then the default certificate.
+func (c *Certificates) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if cert := c.lookup(hello.ServerName); cert != nil {
+		return cert, nil
+	}
+	return c.defaultCertificate(hello)
+}
+
+// lookup returns the certificate valid for serverName, the exact name of Dir
+// first, then its wildcard, then the default certificate, or nil.
+func (c *Certificates) lookup(serverName string) *tls.Certificate {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	name := strings.ToLower(strings.TrimSuffix(serverName, "."))
+	if cert := c.names[name]; cert != nil {
+		return cert
+	}
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		if cert := c.names["*"+name[i:]]; cert != nil {
+			return cert
+		}
+	}
+	if c.def != nil && name != "" && c.def.Leaf.VerifyHostname(name) == nil {
+		return c.def
+	}
+	return nil
+}
+
+// defaultCertificate returns the default certificate.
+func (c *Certificates) defaultCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.def != nil {
+		return c.def, nil
+	}
+	return nil, fmt.Errorf("tls: no certificate for %q", hello.ServerName)
+}
+
+// Watch reloads the certificates every interval once their files changed,
+// until ctx is done.
+func (c *Certificates) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !c.changed() {
+			continue
+		}
+		if err := c.Load(); err != nil {
+			c.Logger.Error("tls", "status", "reload", "err", err)
+			continue
+		}
+		c.Logger.Info("tls", "status", "reload")
+	}
+}
+
+// changed reports whether the certificate files changed since loaded.
+func (c *Certificates) changed() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.Dir != "" {
+		files, _ := filepath.Glob(filepath.Join(c.Dir, "*.crt"))
+		for _, file := range files {
+			if _, ok := c.mtimes[file]; !ok {
+				return true
+			}
+		}
+	}
+	for file, mtime := range c.mtimes {
+		fi, err := os.Stat(file)
+		if err != nil || !fi.ModTime().Equal(mtime) {
+			return true
+		}
+	}
+	return false
+}
+
+// redirectHandler redirects the http requests to https on port.
+func redirectHandler(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		host := req.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		u := *req.URL
+		u.Scheme, u.Host = "https", host
+		http.Redirect(w, req, u.String(), http.StatusPermanentRedirect)
+	})
+}
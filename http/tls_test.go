@@ -0,0 +1,200 @@
+package http
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate for names to certFile and its
+// key to keyFile, with a modification time of mtime.
+func writeCert(t *testing.T, certFile string, keyFile string, mtime time.Time, names ...string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for file, block := range map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: der},
+		keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := os.WriteFile(file, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// certName returns the first name of the certificate served to serverName,
+// or "" if none.
+func certName(t *testing.T, c *Certificates, serverName string) string {
+	t.Helper()
+
+	cert, err := c.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+	if err != nil {
+		return ""
+	}
+	return cert.Leaf.DNSNames[0]
+}
+
+func TestCertificates(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	writeCert(t, filepath.Join(dir, "app.crt"), filepath.Join(dir, "app.key"), now, "app.example.com")
+	writeCert(t, filepath.Join(dir, "wildcard.crt"), filepath.Join(dir, "wildcard.key"), now, "*.example.com")
+	writeCert(t, filepath.Join(dir, "default.pem"), filepath.Join(dir, "default-key.pem"), now, "*.proxy.example.org")
+
+	tests := []struct {
+		name       string
+		def        bool
+		serverName string
+		want       string
+	}{
+		{name: "exact", serverName: "app.example.com", want: "app.example.com"},
+		{name: "exact case", serverName: "APP.Example.com.", want: "app.example.com"},
+		{name: "wildcard", serverName: "other.example.com", want: "*.example.com"},
+		{name: "wildcard one label", serverName: "a.b.example.com"},
+		{name: "apex", serverName: "example.com"},
+		{name: "unknown", serverName: "example.net"},
+		{name: "default wildcard", def: true, serverName: "abc.proxy.example.org", want: "*.proxy.example.org"},
+		{name: "default fallback", def: true, serverName: "example.net", want: "*.proxy.example.org"},
+		{name: "default without name", def: true, want: "*.proxy.example.org"},
+		{name: "dir before default", def: true, serverName: "app.example.com", want: "app.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Certificates{Dir: dir, Logger: testLogger}
+			if tt.def {
+				c.CertFile, c.KeyFile = filepath.Join(dir, "default.pem"), filepath.Join(dir, "default-key.pem")
+			}
+			if err := c.Load(); err != nil {
+				t.Fatal(err)
+			}
+			if got := certName(t, c, tt.serverName); got != tt.want {
+				t.Errorf("certificate of %q = %q, want %q", tt.serverName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCertificatesLoadError(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := (&Certificates{Dir: dir}).Load(); err == nil {
+		t.Error("Load of an empty directory succeeded")
+	}
+
+	writeCert(t, filepath.Join(dir, "app.crt"), filepath.Join(dir, "app.key"), time.Now(), "app.example.com")
+	if err := os.Remove(filepath.Join(dir, "app.key")); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&Certificates{Dir: dir}).Load(); err == nil {
+		t.Error("Load of a certificate without its key succeeded")
+	}
+}
+
+func TestCertificatesWatch(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "app.crt"), filepath.Join(dir, "app.key")
+	start := time.Now().Add(-time.Minute)
+	writeCert(t, certFile, keyFile, start, "app.example.com")
+
+	c := &Certificates{Dir: dir, Logger: testLogger}
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Watch(ctx, 10*time.Millisecond)
+
+	// wait returns once serverName is served the certificate of want
+	wait := func(serverName string, want string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for certName(t, c, serverName) != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("certificate of %q = %q, want %q", serverName, certName(t, c, serverName), want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// rewritten files
+	writeCert(t, certFile, keyFile, start.Add(time.Second), "new.example.com")
+	wait("new.example.com", "new.example.com")
+	wait("app.example.com", "")
+
+	// a new file
+	writeCert(t, filepath.Join(dir, "other.crt"), filepath.Join(dir, "other.key"), start, "other.example.com")
+	wait("other.example.com", "other.example.com")
+
+	// an invalid file keeps the loaded certificates
+	if err := os.WriteFile(certFile, []byte("invalid"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got := certName(t, c, "new.example.com"); got != "new.example.com" {
+		t.Errorf("certificate of %q after an invalid reload = %q, want the loaded one", "new.example.com", got)
+	}
+	writeCert(t, certFile, keyFile, start.Add(2*time.Second), "app.example.com")
+	wait("app.example.com", "app.example.com")
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		port   string
+		target string
+		want   string
+	}{
+		{name: "default port", port: "443", target: "http://app.example.com/lab?token=a", want: "https://app.example.com/lab?token=a"},
+		{name: "no port", target: "http://app.example.com/", want: "https://app.example.com/"},
+		{name: "port", port: "8443", target: "http://app.example.com:8080/lab", want: "https://app.example.com:8443/lab"},
+		{name: "ipv6", port: "8443", target: "http://[::1]:8080/", want: "https://[::1]:8443/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			redirectHandler(tt.port).ServeHTTP(w, httptest.NewRequest("GET", tt.target, nil))
+			if w.Code != http.StatusPermanentRedirect {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusPermanentRedirect)
+			}
+			if got := w.Header().Get("Location"); got != tt.want {
+				t.Errorf("Location = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package http
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/batx-dev/batproxy"
+	"github.com/batx-dev/batproxy/memo"
+)
+
+// Defaults of the transports to the destinations of the proxies.
+const (
+	DefaultTransportMaxIdleConns = 32
+	DefaultTransportIdleTimeout  = 90 * time.Second
+)
+
+// transportKey identifies the transport to the destination of a proxy,
+// changing the login, the destination or its tls settings builds another one.
+type transportKey struct {
+	ProxyID string
+	SSH     key
+	Node    string
+	Port    uint16
+	Socket  string
+	TLS     batproxy.TargetTLS
+}
+
+func newTransportKey(p *batproxy.Proxy) transportKey {
+	key := transportKey{
+		ProxyID: p.ID,
+		SSH:     newKey(p),
+		Node:    p.Node,
+		Port:    p.Port,
+		Socket:  p.Socket,
+	}
+	if p.Target != nil && p.Target.TLS != nil {
+		key.TLS = *p.Target.TLS
+	}
+	return key
+}
+
+// transport keeps the streams to the destination of a proxy alive between
+// requests. It holds its ssh connection until evicted.
+type transport struct {
+	*http.Transport
+
+	release func()
+}
+
+func (s *Server) transportFunc() memo.Func[transportKey, *transport] {
+	return func(ctx context.Context, key transportKey, cleanup func()) (*transport, error) {
+		sc, release, err := s.memo.Acquire(ctx, key.SSH)
+		if err != nil {
+			return nil, err
+		}
+
+		dial := sc.DialContext
+		if key.Socket != "" {
+			// the target host only names the socket in requests
+			dial = func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return sc.DialContext(ctx, "unix", key.Socket)
+			}
+		}
+
+		// the tls settings of the https destinations, the defaults verify
+		// their certificate against node
+		tlsConfig, err := key.TLS.Config()
+		if err != nil {
+			release()
+			return nil, batproxy.Errorf(batproxy.EINVALID, "%v", err)
+		}
+
+		maxIdleConns := s.TransportMaxIdleConns
+		if maxIdleConns <= 0 {
+			maxIdleConns = DefaultTransportMaxIdleConns
+		}
+
+		return &transport{
+			Transport: &http.Transport{
+				DialContext:           dial,
+				TLSClientConfig:       tlsConfig,
+				ForceAttemptHTTP2:     true,
+				MaxIdleConns:          maxIdleConns,
+				MaxIdleConnsPerHost:   maxIdleConns,
+				IdleConnTimeout:       s.transportIdleTimeout(),
+				TLSHandshakeTimeout:   10 * time.Second,
+				ExpectContinueTimeout: 1 * time.Second,
+			},
+			release: release,
+		}, nil
+	}
+}
+
+func (s *Server) transportIdleTimeout() time.Duration {
+	if s.TransportIdleTimeout > 0 {
+		return s.TransportIdleTimeout
+	}
+	return DefaultTransportIdleTimeout
+}
+
+// evictTransports closes the transports to the proxy of proxyID, or to all
+// proxies if empty.
+func (s *Server) evictTransports(proxyID string) {
+	n := s.transports.EvictFunc(func(k transportKey) bool {
+		return proxyID == "" || k.ProxyID == proxyID
+	})
+	if n > 0 {
+		s.logger.Info("evict transports", "proxy_id", proxyID, "num", n)
+	}
+}
@@ -0,0 +1,166 @@
+package http
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/batx-dev/batproxy"
+	"github.com/batx-dev/batproxy/internal/sshtest"
+)
+
+// newBackendServer returns a server of the proxy "app" to a backend over an
+// in-process ssh server. The backend closes its connections after every
+// response unless keepAlive.
+func newBackendServer(tb testing.TB, keepAlive bool) (*Server, *sshtest.Server) {
+	tb.Helper()
+
+	srv := sshtest.NewServer(tb, nil)
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !keepAlive {
+			w.Header().Set("Connection", "close")
+		}
+		io.WriteString(w, "app")
+	}))
+	tb.Cleanup(app.Close)
+
+	p := &batproxy.Proxy{
+		ID:       "app",
+		User:     "user",
+		Host:     srv.Addr,
+		Password: sshtest.Password,
+		Node:     "127.0.0.1",
+		Port:     uint16(app.Listener.Addr().(*net.TCPAddr).Port),
+	}
+	s, err := NewServer("127.0.0.1:0", "tcp://127.0.0.1:0", testLogger)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	s.ProxyService = newMemProxies(p)
+	if err := s.Open(); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { s.Close() })
+
+	return s, srv
+}
+
+// getApp requests the proxy "app" with client.
+func getApp(tb testing.TB, s *Server, client *http.Client) {
+	req, err := http.NewRequest("GET", "http://"+s.reverseProxyListen.Addr().String()+"/", nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	req.Host = "app"
+	res, err := client.Do(req)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || string(body) != "app" {
+		tb.Fatalf("GET = %d %q, want the backend", res.StatusCode, body)
+	}
+}
+
+func TestTransportReuse(t *testing.T) {
+	tests := []struct {
+		name      string
+		keepAlive bool
+		channels  int64
+	}{
+		{name: "reuse", keepAlive: true, channels: 1},
+		{name: "no reuse", channels: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, srv := newBackendServer(t, tt.keepAlive)
+			client := &http.Client{Transport: &http.Transport{}}
+			for i := 0; i < 10; i++ {
+				getApp(t, s, client)
+			}
+			if n := srv.Channels(); n != tt.channels {
+				t.Errorf("ssh channels = %d, want %d for 10 requests", n, tt.channels)
+			}
+		})
+	}
+}
+
+// BenchmarkTransport compares the requests reusing the streams to the
+// backend with the ones opening an ssh channel each.
+func BenchmarkTransport(b *testing.B) {
+	for _, bb := range []struct {
+		name      string
+		keepAlive bool
+	}{
+		{name: "reuse", keepAlive: true},
+		{name: "no reuse"},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			s, srv := newBackendServer(b, bb.keepAlive)
+			client := &http.Client{Transport: &http.Transport{}}
+			getApp(b, s, client)
+
+			start := srv.Channels()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				getApp(b, s, client)
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(srv.Channels()-start)/float64(b.N), "channels/op")
+		})
+	}
+}
+
+func TestTransportSocket(t *testing.T) {
+	srv := sshtest.NewServer(t, nil)
+
+	// unix socket paths are short, the test directory may not be
+	dir, err := os.MkdirTemp("", "batproxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	l, err := net.Listen("unix", filepath.Join(dir, "app.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &httptest.Server{
+		Listener: l,
+		Config: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "app")
+		})},
+	}
+	app.Start()
+	defer app.Close()
+
+	p := &batproxy.Proxy{
+		ID:       "app",
+		User:     "user",
+		Host:     srv.Addr,
+		Password: sshtest.Password,
+		Socket:   filepath.Join(dir, "app.sock"),
+	}
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServer("127.0.0.1:0", "tcp://127.0.0.1:0", testLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ProxyService = newMemProxies(p)
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	getApp(t, s, &http.Client{Transport: &http.Transport{}})
+	if n := srv.Channels(); n != 1 {
+		t.Errorf("ssh channels = %d, want the streamlocal one", n)
+	}
+}
@@ -0,0 +1,325 @@
+// Package sshtest provides an in-process ssh server for tests.
+package sshtest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Password is accepted for any user, unless the config of the server
+// changes the password callback.
+const Password = "secret"
+
+// Server is an ssh server on a local port, forwarding tcp and unix socket
+// channels and running the commands of exec sessions with sh.
+type Server struct {
+	// Addr is the host:port of the server.
+	Addr string
+
+	// HostKey is the key of the server.
+	HostKey ssh.Signer
+
+	// Dir is the home and working directory of the commands, Dir/bin comes
+	// first in their PATH.
+	Dir string
+
+	config   *ssh.ServerConfig
+	listener net.Listener
+
+	noForward   atomic.Bool
+	noReply     atomic.Bool
+	maxChannels atomic.Int64
+	conns       atomic.Int64
+	channels    atomic.Int64
+
+	mu   sync.Mutex
+	live map[net.Conn]struct{}
+}
+
+// NewServer starts a server closed with the test. config may change the
+// server config before it is used, e.g. its authentication callbacks.
+func NewServer(tb testing.TB, config func(*ssh.ServerConfig)) *Server {
+	tb.Helper()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	hostKey, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	cfg := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if string(password) == Password {
+				return nil, nil
+			}
+			return nil, errors.New("wrong password")
+		},
+	}
+	if config != nil {
+		config(cfg)
+	}
+	cfg.AddHostKey(hostKey)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	s := &Server{
+		Addr:     l.Addr().String(),
+		HostKey:  hostKey,
+		Dir:      tb.TempDir(),
+		config:   cfg,
+		listener: l,
+		live:     make(map[net.Conn]struct{}),
+	}
+	if err := os.Mkdir(filepath.Join(s.Dir, "bin"), 0o755); err != nil {
+		tb.Fatal(err)
+	}
+
+	go s.serve()
+	tb.Cleanup(s.Close)
+
+	return s
+}
+
+// Close stops the server and closes its connections.
+func (s *Server) Close() {
+	_ = s.listener.Close()
+	s.CloseConns()
+}
+
+// CloseConns closes the live connections, like a restarted server.
+func (s *Server) CloseConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for c := range s.live {
+		_ = c.Close()
+	}
+}
+
+// SetForwarding allows or rejects the forwarding channels, like
+// AllowTcpForwarding.
+func (s *Server) SetForwarding(allow bool) {
+	s.noForward.Store(!allow)
+}
+
+// SetReplies answers the global requests, e.g. the keepalives, or leaves
+// them without answer like a hung server.
+func (s *Server) SetReplies(reply bool) {
+	s.noReply.Store(!reply)
+}
+
+// SetMaxChannels rejects the forwarding channels past n open on a
+// connection, like a limit of sshd. Zero means no limit.
+func (s *Server) SetMaxChannels(n int) {
+	s.maxChannels.Store(int64(n))
+}
+
+// Conns returns the number of connections accepted so far.
+func (s *Server) Conns() int64 {
+	return s.conns.Load()
+}
+
+// Channels returns the number of forwarding channels opened so far.
+func (s *Server) Channels() int64 {
+	return s.channels.Load()
+}
+
+// WriteScript writes an executable named name in Dir/bin.
+func (s *Server) WriteScript(tb testing.TB, name, script string) {
+	tb.Helper()
+
+	if err := os.WriteFile(filepath.Join(s.Dir, "bin", name), []byte(script), 0o755); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func (s *Server) serve() {
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.conns.Add(1)
+		go s.serveConn(c)
+	}
+}
+
+func (s *Server) serveConn(c net.Conn) {
+	s.mu.Lock()
+	s.live[c] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.live, c)
+		s.mu.Unlock()
+		_ = c.Close()
+	}()
+
+	_, chans, reqs, err := ssh.NewServerConn(c, s.config)
+	if err != nil {
+		return
+	}
+	go func() {
+		for req := range reqs {
+			if req.WantReply && !s.noReply.Load() {
+				_ = req.Reply(true, nil)
+			}
+		}
+	}()
+
+	// open forwarding channels of the connection
+	var open atomic.Int64
+
+	for nc := range chans {
+		switch nc.ChannelType() {
+		case "direct-tcpip":
+			var m struct {
+				Raddr string
+				Rport uint32
+				Laddr string
+				Lport uint32
+			}
+			if err := ssh.Unmarshal(nc.ExtraData(), &m); err != nil {
+				_ = nc.Reject(ssh.ConnectionFailed, err.Error())
+				continue
+			}
+			go s.forward(nc, &open, "tcp", net.JoinHostPort(m.Raddr, strconv.Itoa(int(m.Rport))))
+		case "direct-streamlocal@openssh.com":
+			var m struct {
+				Path     string
+				Reserved string
+				Port     uint32
+			}
+			if err := ssh.Unmarshal(nc.ExtraData(), &m); err != nil {
+				_ = nc.Reject(ssh.ConnectionFailed, err.Error())
+				continue
+			}
+			go s.forward(nc, &open, "unix", m.Path)
+		case "session":
+			go s.session(nc)
+		default:
+			_ = nc.Reject(ssh.UnknownChannelType, "unknown channel type")
+		}
+	}
+}
+
+func (s *Server) forward(nc ssh.NewChannel, open *atomic.Int64, network, addr string) {
+	s.channels.Add(1)
+	if s.noForward.Load() {
+		_ = nc.Reject(ssh.Prohibited, "administratively prohibited")
+		return
+	}
+	if max := s.maxChannels.Load(); open.Add(1) > max && max > 0 {
+		open.Add(-1)
+		_ = nc.Reject(ssh.Prohibited, "too many channels")
+		return
+	}
+	var closeOnce sync.Once
+	closed := func() { closeOnce.Do(func() { open.Add(-1) }) }
+
+	upstream, err := net.Dial(network, addr)
+	if err != nil {
+		closed()
+		_ = nc.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	ch, reqs, err := nc.Accept()
+	if err != nil {
+		closed()
+		_ = upstream.Close()
+		return
+	}
+	go func() {
+		// the requests end with the channel
+		ssh.DiscardRequests(reqs)
+		closed()
+	}()
+
+	go func() {
+		_, _ = io.Copy(ch, upstream)
+		_ = ch.CloseWrite()
+		_ = ch.Close()
+	}()
+	go func() {
+		_, _ = io.Copy(upstream, ch)
+		if cw, ok := upstream.(interface{ CloseWrite() error }); ok {
+			_ = cw.CloseWrite()
+		} else {
+			_ = upstream.Close()
+		}
+	}()
+}
+
+// session runs the command of an exec request with sh, the other requests
+// are refused.
+func (s *Server) session(nc ssh.NewChannel) {
+	ch, reqs, err := nc.Accept()
+	if err != nil {
+		return
+	}
+	defer ch.Close()
+
+	for req := range reqs {
+		if req.Type != "exec" {
+			if req.WantReply {
+				_ = req.Reply(false, nil)
+			}
+			continue
+		}
+
+		var m struct{ Command string }
+		if err := ssh.Unmarshal(req.Payload, &m); err != nil {
+			_ = req.Reply(false, nil)
+			continue
+		}
+		_ = req.Reply(true, nil)
+
+		cmd := exec.Command("sh", "-c", m.Command)
+		cmd.Dir = s.Dir
+		cmd.Env = append(os.Environ(),
+			"HOME="+s.Dir,
+			"PATH="+filepath.Join(s.Dir, "bin")+string(os.PathListSeparator)+os.Getenv("PATH"),
+		)
+		cmd.Stdout = ch
+		cmd.Stderr = ch.Stderr()
+		// Run would wait for the client to close stdin
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return
+		}
+		go func() {
+			_, _ = io.Copy(stdin, ch)
+			_ = stdin.Close()
+		}()
+
+		status := 0
+		if err := cmd.Run(); err != nil {
+			status = 127
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				status = exitErr.ExitCode()
+			}
+		}
+
+		_, _ = ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+		return
+	}
+}
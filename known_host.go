@@ -0,0 +1,82 @@
+package batproxy
+
+import (
+	"context"
+	"time"
+)
+
+// Host key policies, applied to proxies without a pinned host key fingerprint.
+const (
+	// HostKeyPolicyStrict only accepts host keys already trusted.
+	HostKeyPolicyStrict = "strict"
+
+	// HostKeyPolicyTOFU trusts and records the host key of a host seen for
+	// the first time.
+	HostKeyPolicyTOFU = "tofu"
+)
+
+// Known host statuses.
+const (
+	// KnownHostTrusted host key is accepted.
+	KnownHostTrusted = "trusted"
+
+	// KnownHostPending host key was presented but not trusted, it waits
+	// for approval.
+	KnownHostPending = "pending"
+)
+
+type KnownHost struct {
+	// Host SSH server the key belongs to.
+	// Format: <host>:<port>
+	Host string `json:"host"`
+
+	// KeyType Algorithm of the host key, e.g. ssh-ed25519.
+	KeyType string `json:"key_type"`
+
+	// Fingerprint SHA256 fingerprint of the host key.
+	Fingerprint string `json:"fingerprint"`
+
+	// PublicKey Host key in authorized_keys format.
+	PublicKey string `json:"public_key"`
+
+	// Status One of [trusted, pending].
+	Status string `json:"status"`
+
+	// CreateTime Time the key was first presented.
+	// Output only.
+	CreateTime time.Time `json:"create_time"`
+
+	// UpdateTime Time the key was last presented or approved.
+	// Output only.
+	UpdateTime time.Time `json:"update_time"`
+}
+
+type ListKnownHostsPage struct {
+	KnownHosts    []*KnownHost `json:"known_hosts"`
+	NextPageToken string       `json:"next_page_token,omitempty"`
+}
+
+type ListKnownHostsOptions struct {
+	// Host filters by ssh server.
+	Host string `schema:"host,omitempty"`
+
+	// Status filters by status.
+	Status string `schema:"status,omitempty"`
+
+	// PageSize sets the maximum number of known hosts to be returned.
+	PageSize int `schema:"page_size,omitempty"`
+
+	// PageToken may be filled in with the NextPageToken from a previous
+	// ListKnownHosts call.
+	PageToken string `schema:"page_token,omitempty"`
+}
+
+type KnownHostService interface {
+	// AddKnownHost records a host key, does nothing if it is already known.
+	AddKnownHost(ctx context.Context, host *KnownHost) error
+	ListKnownHosts(ctx context.Context, opts ListKnownHostsOptions) (*ListKnownHostsPage, error)
+	// ApproveKnownHost trusts a pending host key, replacing the trusted keys
+	// of the same type.
+	ApproveKnownHost(ctx context.Context, host, fingerprint string) error
+	DeleteKnownHost(ctx context.Context, host, fingerprint string) error
+}
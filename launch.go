@@ -0,0 +1,151 @@
+package batproxy
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// DefaultLaunchTimeout is how long a launch waits for its application to
+// start, including the time its job is pending.
+const DefaultLaunchTimeout = 5 * time.Minute
+
+// App is the template of an interactive application launched as a batch job.
+type App struct {
+	// Command Shell command starting the application in the foreground,
+	// listening on $port of all addresses, authenticating with $token if it
+	// can. The proxy lets in the users with the token only anyway.
+	Command string
+
+	// Path URL path the users open, {token} is replaced by the token.
+	Path string
+}
+
+// Apps are the application templates by name.
+var Apps = map[string]*App{
+	"jupyter": {
+		Command: `jupyter lab --no-browser --ip=0.0.0.0 --port="$port" --ServerApp.token="$token"`,
+		Path:    "/lab?token={token}",
+	},
+	"rstudio": {
+		Command: `rserver --www-address=0.0.0.0 --www-port="$port" --server-user="$USER" --auth-none=1`,
+		Path:    "/",
+	},
+	"code-server": {
+		Command: `PASSWORD="$token" code-server --bind-addr=0.0.0.0:"$port" --auth=password --disable-telemetry`,
+		Path:    "/",
+	},
+}
+
+// Launch submits an application as a batch job and creates the proxy to it,
+// pending until the application started.
+type Launch struct {
+	// App Template of the application, one of [jupyter, rstudio,
+	// code-server].
+	// Required.
+	App string `json:"app"`
+
+	// Proxy Login submitting the job, and the proxy created to the
+	// application. Its destination is set by the launch.
+	// Required.
+	Proxy *Proxy `json:"proxy"`
+
+	// Scheduler Resources of the job.
+	// Optional.
+	Scheduler *SchedulerOptions `json:"scheduler,omitempty"`
+
+	// Timeout Seconds to wait for the application to start, the job is
+	// cancelled and the proxy deleted after that.
+	// Default: 300.
+	// Optional.
+	Timeout int64 `json:"timeout,omitempty"`
+
+	// JobID Slurm job id of the application.
+	// Output only.
+	JobID string `json:"job_id,omitempty"`
+
+	// Token Token authenticating to the application, and to the access of
+	// the proxy.
+	// Output only.
+	Token string `json:"token,omitempty"`
+
+	// URL URL of the application through the proxy.
+	// Output only.
+	URL string `json:"url,omitempty"`
+}
+
+// SchedulerOptions are the sbatch options of a launched job. Empty fields
+// keep the defaults of the cluster.
+type SchedulerOptions struct {
+	// Partition sbatch --partition.
+	Partition string `json:"partition,omitempty"`
+
+	// Account sbatch --account.
+	Account string `json:"account,omitempty"`
+
+	// Time sbatch --time, e.g. 8:00:00.
+	Time string `json:"time,omitempty"`
+
+	// CPUs sbatch --cpus-per-task.
+	CPUs int `json:"cpus,omitempty"`
+
+	// Memory sbatch --mem, e.g. 16G.
+	Memory string `json:"memory,omitempty"`
+
+	// GPUs sbatch --gres=gpu:<gpus>.
+	GPUs int `json:"gpus,omitempty"`
+}
+
+var schedulerOptionRegexp = regexp.MustCompile(`^[A-Za-z0-9_.:,+-]*$`)
+
+func (l *Launch) Validate() error {
+	if Apps[l.App] == nil {
+		return fmt.Errorf("invalid launch app %q, expect one of [jupyter, rstudio, code-server]", l.App)
+	}
+
+	if l.Proxy == nil {
+		return fmt.Errorf("launch proxy required")
+	}
+	if l.Proxy.Node != "" || l.Proxy.Port != 0 || l.Proxy.Socket != "" || l.Proxy.Resolver != nil || l.Proxy.SlurmJob != nil {
+		return fmt.Errorf("launch proxy destination is set by the launch")
+	}
+	// the destination found once the application started
+	p := *l.Proxy
+	p.Port, p.SlurmJob = 1, &SlurmJob{JobID: "1"}
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	if o := l.Scheduler; o != nil {
+		for _, v := range []string{o.Partition, o.Account, o.Time, o.Memory} {
+			if !schedulerOptionRegexp.MatchString(v) {
+				return fmt.Errorf("invalid launch scheduler option %q", v)
+			}
+		}
+		if o.CPUs < 0 || o.GPUs < 0 {
+			return fmt.Errorf("invalid launch scheduler options, expect non-negative cpus and gpus")
+		}
+	}
+
+	if l.Timeout < 0 {
+		return fmt.Errorf("invalid launch timeout %d, expect non-negative seconds", l.Timeout)
+	}
+
+	return nil
+}
+
+// Expiration returns how long the launch waits for its application to
+// start.
+func (l *Launch) Expiration() time.Duration {
+	if l.Timeout > 0 {
+		return time.Duration(l.Timeout) * time.Second
+	}
+	return DefaultLaunchTimeout
+}
+
+type LaunchService interface {
+	// Launch submits the job of launch and creates its proxy, then waits
+	// for its application to start in the background.
+	Launch(ctx context.Context, launch *Launch, opts CreateProxyOptions) error
+}
@@ -0,0 +1,48 @@
+package logger
+
+import (
+	"context"
+	"time"
+
+	"github.com/batx-dev/batproxy"
+	"golang.org/x/exp/slog"
+)
+
+type BreakerService struct {
+	logger *slog.Logger
+	next   batproxy.BreakerService
+}
+
+func NewBreakerService(next batproxy.BreakerService, logger *slog.Logger) batproxy.BreakerService {
+	return &BreakerService{
+		logger: logger,
+		next:   next,
+	}
+}
+
+func (s *BreakerService) ListBreakers(ctx context.Context) (page *batproxy.ListBreakersPage, err error) {
+	defer func(begin time.Time) {
+		logger := s.logger.With(
+			"took", time.Since(begin),
+			"num", func() int {
+				if page != nil {
+					return len(page.Breakers)
+				}
+				return 0
+			}(),
+		)
+		logErr(logger, "ListBreakers", err)
+	}(time.Now())
+	return s.next.ListBreakers(ctx)
+}
+
+func (s *BreakerService) ResetBreaker(ctx context.Context, host string) (err error) {
+	defer func(begin time.Time) {
+		logger := s.logger.With(
+			"took", time.Since(begin),
+			"host", host,
+		)
+		logErr(logger, "ResetBreaker", err)
+	}(time.Now())
+	return s.next.ResetBreaker(ctx, host)
+}
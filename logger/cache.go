@@ -0,0 +1,68 @@
+package logger
+
+import (
+	"context"
+	"time"
+
+	"github.com/batx-dev/batproxy"
+	"golang.org/x/exp/slog"
+)
+
+type CacheService struct {
+	logger *slog.Logger
+	next   batproxy.CacheService
+}
+
+func NewCacheService(next batproxy.CacheService, logger *slog.Logger) batproxy.CacheService {
+	return &CacheService{
+		logger: logger,
+		next:   next,
+	}
+}
+
+func (s *CacheService) ListCacheEntries(ctx context.Context) (page *batproxy.ListCacheEntriesPage, err error) {
+	defer func(begin time.Time) {
+		logger := s.logger.With(
+			"took", time.Since(begin),
+			"num", func() int {
+				if page != nil {
+					return len(page.Entries)
+				}
+				return 0
+			}(),
+		)
+		logErr(logger, "ListCacheEntries", err)
+	}(time.Now())
+	return s.next.ListCacheEntries(ctx)
+}
+
+func (s *CacheService) GetCacheStats(ctx context.Context) (stats *batproxy.CacheStats, err error) {
+	defer func(begin time.Time) {
+		logger := s.logger.With(
+			"took", time.Since(begin),
+		)
+		logErr(logger, "GetCacheStats", err)
+	}(time.Now())
+	return s.next.GetCacheStats(ctx)
+}
+
+func (s *CacheService) EvictCacheEntry(ctx context.Context, proxyID string) (err error) {
+	defer func(begin time.Time) {
+		logger := s.logger.With(
+			"took", time.Since(begin),
+			"proxy_id", proxyID,
+		)
+		logErr(logger, "EvictCacheEntry", err)
+	}(time.Now())
+	return s.next.EvictCacheEntry(ctx, proxyID)
+}
+
+func (s *CacheService) FlushCache(ctx context.Context) (err error) {
+	defer func(begin time.Time) {
+		logger := s.logger.With(
+			"took", time.Since(begin),
+		)
+		logErr(logger, "FlushCache", err)
+	}(time.Now())
+	return s.next.FlushCache(ctx)
+}
@@ -0,0 +1,48 @@
+package logger
+
+import (
+	"context"
+	"time"
+
+	"github.com/batx-dev/batproxy"
+	"golang.org/x/exp/slog"
+)
+
+type ConnectionService struct {
+	logger *slog.Logger
+	next   batproxy.ConnectionService
+}
+
+func NewConnectionService(next batproxy.ConnectionService, logger *slog.Logger) batproxy.ConnectionService {
+	return &ConnectionService{
+		logger: logger,
+		next:   next,
+	}
+}
+
+func (s *ConnectionService) ListConnections(ctx context.Context) (page *batproxy.ListConnectionsPage, err error) {
+	defer func(begin time.Time) {
+		logger := s.logger.With(
+			"took", time.Since(begin),
+			"num", func() int {
+				if page != nil {
+					return len(page.Connections)
+				}
+				return 0
+			}(),
+		)
+		logErr(logger, "ListConnections", err)
+	}(time.Now())
+	return s.next.ListConnections(ctx)
+}
+
+func (s *ConnectionService) CloseConnection(ctx context.Context, id string) (err error) {
+	defer func(begin time.Time) {
+		logger := s.logger.With(
+			"took", time.Since(begin),
+			"connection_id", id,
+		)
+		logErr(logger, "CloseConnection", err)
+	}(time.Now())
+	return s.next.CloseConnection(ctx, id)
+}
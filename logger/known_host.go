@@ -0,0 +1,78 @@
+package logger
+
+import (
+	"context"
+	"time"
+
+	"github.com/batx-dev/batproxy"
+	"golang.org/x/exp/slog"
+)
+
+type KnownHostService struct {
+	logger *slog.Logger
+	next   batproxy.KnownHostService
+}
+
+func NewKnownHostService(next batproxy.KnownHostService, logger *slog.Logger) batproxy.KnownHostService {
+	return &KnownHostService{
+		logger: logger,
+		next:   next,
+	}
+}
+
+func (s *KnownHostService) AddKnownHost(ctx context.Context, host *batproxy.KnownHost) (err error) {
+	defer func(begin time.Time) {
+		logger := s.logger.With(
+			"took", time.Since(begin),
+			"host", host.Host,
+			"fingerprint", host.Fingerprint,
+			"status", host.Status,
+		)
+		logErr(logger, "AddKnownHost", err)
+	}(time.Now())
+	return s.next.AddKnownHost(ctx, host)
+}
+
+func (s *KnownHostService) ListKnownHosts(ctx context.Context, opts batproxy.ListKnownHostsOptions) (page *batproxy.ListKnownHostsPage, err error) {
+	defer func(begin time.Time) {
+		logger := s.logger.With(
+			"took", time.Since(begin),
+			"host", opts.Host,
+			"status", opts.Status,
+			"page_token", opts.PageToken,
+			"page_size", opts.PageSize,
+			"num", func() int {
+				if page != nil {
+					return len(page.KnownHosts)
+				}
+				return 0
+			}(),
+		)
+		logErr(logger, "ListKnownHosts", err)
+	}(time.Now())
+	return s.next.ListKnownHosts(ctx, opts)
+}
+
+func (s *KnownHostService) ApproveKnownHost(ctx context.Context, host, fingerprint string) (err error) {
+	defer func(begin time.Time) {
+		logger := s.logger.With(
+			"took", time.Since(begin),
+			"host", host,
+			"fingerprint", fingerprint,
+		)
+		logErr(logger, "ApproveKnownHost", err)
+	}(time.Now())
+	return s.next.ApproveKnownHost(ctx, host, fingerprint)
+}
+
+func (s *KnownHostService) DeleteKnownHost(ctx context.Context, host, fingerprint string) (err error) {
+	defer func(begin time.Time) {
+		logger := s.logger.With(
+			"took", time.Since(begin),
+			"host", host,
+			"fingerprint", fingerprint,
+		)
+		logErr(logger, "DeleteKnownHost", err)
+	}(time.Now())
+	return s.next.DeleteKnownHost(ctx, host, fingerprint)
+}
@@ -0,0 +1,39 @@
+package logger
+
+import (
+	"context"
+	"time"
+
+	"github.com/batx-dev/batproxy"
+	"golang.org/x/exp/slog"
+)
+
+type LaunchService struct {
+	logger *slog.Logger
+	next   batproxy.LaunchService
+}
+
+func NewLaunchService(next batproxy.LaunchService, logger *slog.Logger) batproxy.LaunchService {
+	return &LaunchService{
+		logger: logger,
+		next:   next,
+	}
+}
+
+func (s *LaunchService) Launch(ctx context.Context, launch *batproxy.Launch, opts batproxy.CreateProxyOptions) (err error) {
+	defer func(begin time.Time) {
+		logger := s.logger.With(
+			"took", time.Since(begin),
+			"app", launch.App,
+			"job_id", launch.JobID,
+			"proxy_id", func() string {
+				if launch.Proxy != nil {
+					return launch.Proxy.ID
+				}
+				return ""
+			}(),
+		)
+		logErr(logger, "Launch", err)
+	}(time.Now())
+	return s.next.Launch(ctx, launch, opts)
+}
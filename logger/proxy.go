@@ -25,10 +25,17 @@ func (s *ProxyService) CreateProxy(ctx context.Context, proxy *batproxy.Proxy, o
 		logger := s.logger.With(
 			"took", time.Since(begin),
 			"proxy_id", proxy.ID,
+			"type", proxy.Type,
+			"listen_port", proxy.ListenPort,
 			"user", proxy.User,
 			"host", proxy.Host,
 			"node", proxy.Node,
 			"port", proxy.Port,
+			"socket", proxy.Socket,
+			"resolver", proxy.Resolver != nil,
+			"slurm_job", proxy.SlurmJob,
+			"target", proxy.Target != nil,
+			"access", proxy.Access.Enabled(),
 		)
 		logErr(logger, "CreateProxy", err)
 	}(time.Now())
@@ -64,3 +71,15 @@ func (s *ProxyService) DeleteProxy(ctx context.Context, proxyID string) (err err
 	}(time.Now())
 	return s.next.DeleteProxy(ctx, proxyID)
 }
+
+func (s *ProxyService) UpdateProxyAccess(ctx context.Context, proxyID string, access *batproxy.Access) (err error) {
+	defer func(begin time.Time) {
+		logger := s.logger.With(
+			"took", time.Since(begin),
+			"proxy_id", proxyID,
+			"access", access.Enabled(),
+		)
+		logErr(logger, "UpdateProxyAccess", err)
+	}(time.Now())
+	return s.next.UpdateProxyAccess(ctx, proxyID, access)
+}
@@ -2,7 +2,9 @@ package memo
 
 import (
 	"context"
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
 )
@@ -18,6 +20,12 @@ type result[V any] struct {
 type entry[V any] struct {
 	res   result[V]
 	ready chan struct{} // closed when res is ready
+
+	// guarded by Memo.mu
+	done  bool        // res is set
+	refs  int         // number of holders
+	used  time.Time   // last time the entry was acquired or released
+	timer *time.Timer // idle eviction timer, running while refs is 0
 }
 
 func New[K comparable, V any](f Func[K, V]) *Memo[K, V] {
@@ -29,38 +37,298 @@ type Memo[K comparable, V any] struct {
 	// If empty, logging is discard
 	Log logr.Logger
 
+	// ErrorExpiration is how long a failed result stays cached, so callers
+	// arriving shortly after a failure get the same error instead of calling
+	// f again. Zero forgets a failure as soon as it is broadcast.
+	ErrorExpiration time.Duration
+
+	// ErrorExpirationFunc overrides ErrorExpiration for the errors it
+	// returns a non-negative duration for.
+	ErrorExpirationFunc func(err error) time.Duration
+
+	// IdleTimeout evicts a value nobody has held for this long.
+	// Zero disables idle eviction.
+	IdleTimeout time.Duration
+
+	// MaxEntries bounds the number of memoized values. Past the bound the
+	// least recently used value nobody holds is evicted.
+	// Zero means no bound.
+	MaxEntries int
+
+	// OnEvict is called with every value evicted by IdleTimeout, MaxEntries
+	// or Evict. It is not called for values removed by cleanup.
+	OnEvict func(key K, value V)
+
 	f     Func[K, V]
 	mu    sync.Mutex // guards cache
 	cache map[K]*entry[V]
 }
 
+// Get returns the value memoized for key, calling f if there is none yet.
+// Concurrent callers for the same key share a single call of f, and each of
+// them waits only as long as its own ctx allows. f is not cancelled when the
+// caller that started it goes away, the others may still be waiting for it.
 func (memo *Memo[K, V]) Get(ctx context.Context, key K) (value V, err error) {
+	value, release, err := memo.Acquire(ctx, key)
+	if err != nil {
+		return value, err
+	}
+	release()
+	return value, nil
+}
+
+// Acquire is like Get, but also holds the value until release is called.
+// A held value is never evicted by IdleTimeout or MaxEntries. release is nil
+// if err is not.
+func (memo *Memo[K, V]) Acquire(ctx context.Context, key K) (value V, release func(), err error) {
 	memo.mu.Lock()
 	e := memo.cache[key]
 	if e == nil {
 		// This is the first request for this key.
-		// This goroutine becomes responsible for computing
+		// A new goroutine becomes responsible for computing
 		// the value and broadcasting the ready condition.
 		e = &entry[V]{ready: make(chan struct{})}
 		memo.cache[key] = e
+		memo.hold(e)
 		memo.mu.Unlock()
 
-		e.res.value, e.res.err = memo.f(ctx, key, func() {
-			memo.remove(key)
-		})
-
-		close(e.ready) // broadcast ready condition
+		go memo.call(detachedContext{ctx}, key, e)
 	} else {
 		// This is a repeat request for this key.
+		memo.hold(e)
 		memo.mu.Unlock()
+	}
 
-		<-e.ready // wait for ready condition
+	var once sync.Once
+	release = func() {
+		once.Do(func() { memo.release(key, e) })
+	}
+
+	select {
+	case <-e.ready: // wait for ready condition
+		if e.res.err != nil {
+			release()
+			return value, nil, e.res.err
+		}
+		return e.res.value, release, nil
+	case <-ctx.Done():
+		release()
+		return value, nil, ctx.Err()
 	}
-	return e.res.value, e.res.err
 }
 
-func (memo *Memo[K, V]) remove(key K) {
+// Evict removes the value memoized for key, whether it is held or not, and
+// reports whether there was one.
+func (memo *Memo[K, V]) Evict(key K) bool {
 	memo.mu.Lock()
-	delete(memo.cache, key)
+	e := memo.cache[key]
+	if e == nil || !e.done {
+		memo.mu.Unlock()
+		return false
+	}
+	memo.delete(key, e)
+	memo.mu.Unlock()
+
+	memo.evicted(key, e)
+	return true
+}
+
+// Wait returns once the call of f in progress for key, if any, is done, so
+// that its value can be evicted.
+func (memo *Memo[K, V]) Wait(key K) {
+	memo.mu.Lock()
+	e := memo.cache[key]
+	memo.mu.Unlock()
+
+	if e != nil {
+		<-e.ready
+	}
+}
+
+// EvictFunc removes the values memoized for the keys f reports true for,
+// whether they are held or not, and returns their number. f is called with
+// the memo locked, it must not call the memo.
+func (memo *Memo[K, V]) EvictFunc(f func(key K) bool) int {
+	memo.mu.Lock()
+	victims := make(map[K]*entry[V])
+	for k, e := range memo.cache {
+		if e.done && f(k) {
+			memo.delete(k, e)
+			victims[k] = e
+		}
+	}
+	memo.mu.Unlock()
+
+	for k, e := range victims {
+		memo.evicted(k, e)
+	}
+	return len(victims)
+}
+
+// call computes the value of e and broadcasts the ready condition, even if
+// f panics.
+func (memo *Memo[K, V]) call(ctx context.Context, key K, e *entry[V]) {
+	defer close(e.ready) // broadcast ready condition
+
+	defer func() {
+		if r := recover(); r != nil {
+			e.res.err = fmt.Errorf("memo: panic: %v", r)
+			memo.Log.Error(e.res.err, "call", "key", key)
+		}
+
+		memo.mu.Lock()
+		e.done = true
+		if e.res.err == nil && e.refs == 0 {
+			memo.idle(key, e)
+		}
+		victims := memo.shrink()
+		memo.mu.Unlock()
+
+		for k, v := range victims {
+			memo.evicted(k, v)
+		}
+
+		if e.res.err != nil {
+			memo.expire(key, e)
+		}
+	}()
+
+	e.res.value, e.res.err = memo.f(ctx, key, func() {
+		memo.remove(key, e)
+	})
+}
+
+// hold takes a reference on e. It must be called with memo.mu held.
+func (memo *Memo[K, V]) hold(e *entry[V]) {
+	e.refs++
+	e.used = time.Now()
+	if e.timer != nil {
+		e.timer.Stop()
+		e.timer = nil
+	}
+}
+
+// release drops a reference on e taken by hold.
+func (memo *Memo[K, V]) release(key K, e *entry[V]) {
+	memo.mu.Lock()
+	e.refs--
+	e.used = time.Now()
+	if e.done && e.res.err == nil && e.refs == 0 {
+		memo.idle(key, e)
+	}
+	victims := memo.shrink()
 	memo.mu.Unlock()
+
+	for k, v := range victims {
+		memo.evicted(k, v)
+	}
+}
+
+// idle arms the idle eviction timer of e. It must be called with memo.mu
+// held.
+func (memo *Memo[K, V]) idle(key K, e *entry[V]) {
+	if memo.IdleTimeout <= 0 {
+		return
+	}
+
+	e.timer = time.AfterFunc(memo.IdleTimeout, func() {
+		memo.mu.Lock()
+		if memo.cache[key] != e || e.refs > 0 || time.Since(e.used) < memo.IdleTimeout {
+			memo.mu.Unlock()
+			return
+		}
+		memo.delete(key, e)
+		memo.mu.Unlock()
+
+		memo.Log.V(1).Info("idle", "key", key)
+		memo.evicted(key, e)
+	})
 }
+
+// shrink removes the least recently used entries nobody holds until the cache
+// fits in MaxEntries, and returns them. It must be called with memo.mu held.
+func (memo *Memo[K, V]) shrink() map[K]*entry[V] {
+	if memo.MaxEntries <= 0 {
+		return nil
+	}
+
+	victims := make(map[K]*entry[V])
+	for len(memo.cache) > memo.MaxEntries {
+		var (
+			key    K
+			oldest *entry[V]
+		)
+		for k, e := range memo.cache {
+			if !e.done || e.res.err != nil || e.refs > 0 {
+				continue
+			}
+			if oldest == nil || e.used.Before(oldest.used) {
+				key, oldest = k, e
+			}
+		}
+		if oldest == nil {
+			break
+		}
+
+		memo.delete(key, oldest)
+		victims[key] = oldest
+	}
+
+	return victims
+}
+
+// evicted hands the value of an evicted entry to OnEvict.
+func (memo *Memo[K, V]) evicted(key K, e *entry[V]) {
+	if memo.OnEvict != nil && e.res.err == nil {
+		memo.OnEvict(key, e.res.value)
+	}
+}
+
+// expire removes a failed entry according to ErrorExpiration.
+func (memo *Memo[K, V]) expire(key K, e *entry[V]) {
+	expiration := memo.ErrorExpiration
+	if memo.ErrorExpirationFunc != nil {
+		if d := memo.ErrorExpirationFunc(e.res.err); d >= 0 {
+			expiration = d
+		}
+	}
+
+	if expiration <= 0 {
+		memo.remove(key, e)
+		return
+	}
+
+	time.AfterFunc(expiration, func() {
+		memo.remove(key, e)
+		memo.Log.V(1).Info("expire", "key", key, "err", e.res.err)
+	})
+}
+
+// remove deletes e from the cache, unless key has been memoized again since.
+func (memo *Memo[K, V]) remove(key K, e *entry[V]) {
+	memo.mu.Lock()
+	if memo.cache[key] == e {
+		memo.delete(key, e)
+	}
+	memo.mu.Unlock()
+}
+
+// delete removes e from the cache. It must be called with memo.mu held.
+func (memo *Memo[K, V]) delete(key K, e *entry[V]) {
+	delete(memo.cache, key)
+	if e.timer != nil {
+		e.timer.Stop()
+		e.timer = nil
+	}
+}
+
+// detachedContext keeps the values of its parent but not its cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (deadline time.Time, ok bool) { return }
+
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+func (detachedContext) Err() error { return nil }
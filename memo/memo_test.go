@@ -0,0 +1,412 @@
+package memo
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetSharesCall(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	m := New(func(ctx context.Context, key string, cleanup func()) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "value of " + key, nil
+	})
+
+	var wg sync.WaitGroup
+	values := make([]string, 10)
+	for i := range values {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, err := m.Get(context.Background(), "a")
+			if err != nil {
+				t.Errorf("Get: %v", err)
+			}
+			values[i] = v
+		}(i)
+	}
+	// let the callers queue up on the same entry
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+	for _, v := range values {
+		if v != "value of a" {
+			t.Errorf("value = %q, want %q", v, "value of a")
+		}
+	}
+
+	if _, err := m.Get(context.Background(), "a"); err != nil || calls != 1 {
+		t.Errorf("Get again: calls = %d, err = %v, want memoized", calls, err)
+	}
+}
+
+func TestGetCancel(t *testing.T) {
+	release := make(chan struct{})
+	callCtx := make(chan context.Context, 1)
+	m := New(func(ctx context.Context, key string, cleanup func()) (string, error) {
+		callCtx <- ctx
+		<-release
+		return "v", nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		_, err := m.Get(ctx, "a")
+		errc <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	waiter := make(chan string, 1)
+	go func() {
+		v, _ := m.Get(context.Background(), "a")
+		waiter <- v
+	}()
+
+	cancel()
+	select {
+	case err := <-errc:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("cancelled Get: err = %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cancelled Get still waiting")
+	}
+
+	if err := (<-callCtx).Err(); err != nil {
+		t.Errorf("shared call cancelled with its first caller: %v", err)
+	}
+
+	close(release)
+	select {
+	case v := <-waiter:
+		if v != "v" {
+			t.Errorf("other caller got %q, want %q", v, "v")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("other caller never got the value")
+	}
+}
+
+func TestGetPanic(t *testing.T) {
+	var calls int32
+	m := New(func(ctx context.Context, key string, cleanup func()) (string, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			panic("boom")
+		}
+		return "v", nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := m.Get(ctx, "a")
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("err = %v, want the panic", err)
+	}
+
+	// the panic is forgotten like any error without ErrorExpiration
+	time.Sleep(10 * time.Millisecond)
+	if v, err := m.Get(ctx, "a"); err != nil || v != "v" {
+		t.Errorf("Get after panic = %q, %v, want %q", v, err, "v")
+	}
+}
+
+func TestErrorExpiration(t *testing.T) {
+	errTransient := errors.New("transient")
+	errPermanent := errors.New("permanent")
+
+	tests := []struct {
+		name       string
+		expiration time.Duration
+		expireFunc func(err error) time.Duration
+		err        error
+		wantCalls  int32 // calls of f after a second Get right away
+	}{
+		{name: "forgotten", err: errTransient, wantCalls: 2},
+		{name: "retained", expiration: time.Hour, err: errTransient, wantCalls: 1},
+		{
+			name:       "func overrides",
+			expiration: time.Hour,
+			expireFunc: func(err error) time.Duration {
+				if err == errTransient {
+					return 0
+				}
+				return -1
+			},
+			err:       errTransient,
+			wantCalls: 2,
+		},
+		{
+			name:       "func defers to expiration",
+			expiration: time.Hour,
+			expireFunc: func(err error) time.Duration {
+				if err == errTransient {
+					return 0
+				}
+				return -1
+			},
+			err:       errPermanent,
+			wantCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			m := New(func(ctx context.Context, key string, cleanup func()) (string, error) {
+				atomic.AddInt32(&calls, 1)
+				return "", tt.err
+			})
+			m.ErrorExpiration = tt.expiration
+			m.ErrorExpirationFunc = tt.expireFunc
+
+			for i := 0; i < 2; i++ {
+				if _, err := m.Get(context.Background(), "a"); err != tt.err {
+					t.Fatalf("Get %d: err = %v, want %v", i, err, tt.err)
+				}
+				// leave time to the removal of the failed entry
+				time.Sleep(10 * time.Millisecond)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+
+	t.Run("expires", func(t *testing.T) {
+		var calls int32
+		m := New(func(ctx context.Context, key string, cleanup func()) (string, error) {
+			atomic.AddInt32(&calls, 1)
+			return "", errTransient
+		})
+		m.ErrorExpiration = 20 * time.Millisecond
+
+		m.Get(context.Background(), "a")
+		m.Get(context.Background(), "a")
+		time.Sleep(50 * time.Millisecond)
+		m.Get(context.Background(), "a")
+		if calls != 2 {
+			t.Errorf("calls = %d, want 2", calls)
+		}
+	})
+}
+
+func TestCleanup(t *testing.T) {
+	var (
+		calls   int32
+		cleanup func()
+	)
+	m := New(func(ctx context.Context, key string, c func()) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		cleanup = c
+		return "v", nil
+	})
+
+	m.Get(context.Background(), "a")
+	cleanup()
+	m.Get(context.Background(), "a")
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2 after cleanup", calls)
+	}
+}
+
+// evictions records the keys handed to OnEvict.
+type evictions struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (e *evictions) add(key string, _ string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.keys = append(e.keys, key)
+}
+
+func (e *evictions) get() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.keys...)
+}
+
+func identity(ctx context.Context, key string, cleanup func()) (string, error) {
+	return key, nil
+}
+
+func TestIdleTimeout(t *testing.T) {
+	var evicted evictions
+	m := New(identity)
+	m.IdleTimeout = 30 * time.Millisecond
+	m.OnEvict = evicted.add
+
+	ctx := context.Background()
+	m.Get(ctx, "idle")
+	_, release, err := m.Acquire(ctx, "held")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(80 * time.Millisecond)
+	if got := evicted.get(); len(got) != 1 || got[0] != "idle" {
+		t.Fatalf("evicted = %v, want [idle]", got)
+	}
+
+	release()
+	time.Sleep(80 * time.Millisecond)
+	if got := evicted.get(); len(got) != 2 || got[1] != "held" {
+		t.Fatalf("evicted = %v, want held once released and idle", got)
+	}
+}
+
+func TestMaxEntries(t *testing.T) {
+	tests := []struct {
+		name string
+		held []string // acquired and not released
+		gets []string // in order
+		want []string // evicted, in order
+	}{
+		{
+			name: "least recently used",
+			gets: []string{"a", "b", "a", "c"},
+			want: []string{"b"},
+		},
+		{
+			name: "held skipped",
+			held: []string{"a"},
+			gets: []string{"b", "c", "d"},
+			want: []string{"b", "c"},
+		},
+		{
+			name: "all held",
+			held: []string{"a", "b", "c"},
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var evicted evictions
+			m := New(identity)
+			m.MaxEntries = 2
+			m.OnEvict = evicted.add
+
+			ctx := context.Background()
+			for _, k := range tt.held {
+				if _, _, err := m.Acquire(ctx, k); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, k := range tt.gets {
+				if _, err := m.Get(ctx, k); err != nil {
+					t.Fatal(err)
+				}
+				// distinct use times
+				time.Sleep(time.Millisecond)
+			}
+
+			got := evicted.get()
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("evicted = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAcquireRelease(t *testing.T) {
+	var evicted evictions
+	m := New(identity)
+	m.MaxEntries = 1
+	m.OnEvict = evicted.add
+
+	ctx := context.Background()
+	_, release1, _ := m.Acquire(ctx, "a")
+	_, release2, _ := m.Acquire(ctx, "a")
+
+	m.Get(ctx, "b")
+	if got := evicted.get(); len(got) != 1 || got[0] != "b" {
+		t.Fatalf("evicted = %v, want [b] while a is held", got)
+	}
+
+	release1()
+	release1() // idempotent
+	m.Get(ctx, "c")
+	if got := evicted.get(); len(got) != 2 || got[1] != "c" {
+		t.Fatalf("evicted = %v, want c while a is still held once", got)
+	}
+
+	release2()
+	if got := evicted.get(); len(got) != 2 {
+		t.Fatalf("evicted = %v, want a kept within MaxEntries", got)
+	}
+	m.Get(ctx, "d")
+	if got := evicted.get(); len(got) != 3 || got[2] != "a" {
+		t.Fatalf("evicted = %v, want a once released", got)
+	}
+}
+
+func TestEvict(t *testing.T) {
+	var evicted evictions
+	m := New(identity)
+	m.OnEvict = evicted.add
+
+	ctx := context.Background()
+	_, release, _ := m.Acquire(ctx, "a")
+	defer release()
+	m.Get(ctx, "b")
+	m.Get(ctx, "bb")
+
+	if !m.Evict("a") {
+		t.Error("Evict(a) = false, want held values evicted too")
+	}
+	if m.Evict("missing") {
+		t.Error("Evict(missing) = true")
+	}
+	if n := m.EvictFunc(func(k string) bool { return strings.HasPrefix(k, "b") }); n != 2 {
+		t.Errorf("EvictFunc = %d, want 2", n)
+	}
+	if got := evicted.get(); len(got) != 3 {
+		t.Errorf("evicted = %v, want 3 values", got)
+	}
+}
+
+func TestWait(t *testing.T) {
+	var evicted evictions
+	release := make(chan struct{})
+	m := New(func(ctx context.Context, key string, cleanup func()) (string, error) {
+		<-release
+		return key, nil
+	})
+	m.OnEvict = evicted.add
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// the caller went away, the call goes on
+	if _, err := m.Get(ctx, "a"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Get = %v, want canceled", err)
+	}
+	if m.Evict("a") {
+		t.Error("Evict(a) = true during its call")
+	}
+
+	time.AfterFunc(20*time.Millisecond, func() { close(release) })
+	m.Wait("a")
+	if !m.Evict("a") {
+		t.Error("Evict(a) = false once waited")
+	}
+	if got := evicted.get(); len(got) != 1 {
+		t.Errorf("evicted = %v, want a", got)
+	}
+
+	m.Wait("missing")
+}
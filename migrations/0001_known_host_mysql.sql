@@ -0,0 +1,14 @@
+ALTER TABLE `t_bat_proxy` ADD COLUMN `host_key_fingerprint` varchar(128) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS `t_bat_known_host` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `host` varchar(128) NOT NULL,
+  `key_type` varchar(64) NOT NULL,
+  `fingerprint` varchar(128) NOT NULL,
+  `public_key` text NOT NULL,
+  `status` varchar(16) NOT NULL,
+  `create_time` datetime NOT NULL,
+  `update_time` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `ux_host_fingerprint` (`host`, `fingerprint`)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8 ROW_FORMAT=COMPRESSED;
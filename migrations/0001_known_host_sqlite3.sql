@@ -0,0 +1,13 @@
+ALTER TABLE `t_bat_proxy` ADD COLUMN `host_key_fingerprint` varchar(128) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS `t_bat_known_host` (
+  `id` INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  `host` varchar(128) NOT NULL,
+  `key_type` varchar(64) NOT NULL,
+  `fingerprint` varchar(128) NOT NULL,
+  `public_key` text NOT NULL,
+  `status` varchar(16) NOT NULL,
+  `create_time` datetime NOT NULL,
+  `update_time` datetime NOT NULL,
+  UNIQUE(`host`, `fingerprint`)
+);
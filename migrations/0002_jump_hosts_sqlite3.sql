@@ -0,0 +1 @@
+ALTER TABLE `t_bat_proxy` ADD COLUMN `jump_hosts` text;
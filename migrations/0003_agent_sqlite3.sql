@@ -0,0 +1,2 @@
+ALTER TABLE `t_bat_proxy` ADD COLUMN `agent` boolean NOT NULL DEFAULT 0;
+ALTER TABLE `t_bat_proxy` ADD COLUMN `agent_key_filter` varchar(128) NOT NULL DEFAULT '';
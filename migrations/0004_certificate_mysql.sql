@@ -0,0 +1,2 @@
+ALTER TABLE `t_bat_proxy` ADD COLUMN `certificate` text;
+ALTER TABLE `t_bat_proxy` ADD COLUMN `sign_certificate` tinyint(1) NOT NULL DEFAULT 0;
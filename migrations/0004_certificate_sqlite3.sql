@@ -0,0 +1,2 @@
+ALTER TABLE `t_bat_proxy` ADD COLUMN `certificate` text;
+ALTER TABLE `t_bat_proxy` ADD COLUMN `sign_certificate` boolean NOT NULL DEFAULT 0;
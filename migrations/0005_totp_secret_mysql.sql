@@ -0,0 +1 @@
+ALTER TABLE `t_bat_proxy` ADD COLUMN `totp_secret` varchar(128) NOT NULL DEFAULT '';
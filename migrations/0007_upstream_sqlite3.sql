@@ -0,0 +1 @@
+ALTER TABLE `t_bat_proxy` ADD COLUMN `upstream` varchar(255) NOT NULL DEFAULT '';
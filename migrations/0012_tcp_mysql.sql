@@ -0,0 +1,2 @@
+ALTER TABLE `t_bat_proxy` ADD COLUMN `type` varchar(16) NOT NULL DEFAULT '';
+ALTER TABLE `t_bat_proxy` ADD COLUMN `listen_port` int(5) NOT NULL DEFAULT 0;
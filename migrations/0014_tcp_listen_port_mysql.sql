@@ -0,0 +1,2 @@
+ALTER TABLE `t_bat_proxy` ADD COLUMN `tcp_listen_port` int(5) GENERATED ALWAYS AS (NULLIF(`listen_port`, 0)) VIRTUAL;
+ALTER TABLE `t_bat_proxy` ADD UNIQUE KEY `ux_listen_port` (`tcp_listen_port`);
@@ -0,0 +1 @@
+CREATE UNIQUE INDEX IF NOT EXISTS `ux_listen_port` ON `t_bat_proxy` (`listen_port`) WHERE `listen_port` > 0;
@@ -16,4 +16,22 @@ CREATE TABLE IF NOT EXISTS `t_bat_proxy` (
 
 INSERT IGNORE INTO `t_bat_proxy` (`id`, `proxy_id`, `user`, `host`, `private_key`, `passphrase`, `password`, `node`, `port`, `create_time`, `update_time`) VALUES
 ('1', 'localhost', 'user1', 'host1:22', '', '', '123456', 'j2001', '18880', '2023-04-12 09:35:39+00:00', '2023-04-12 09:35:39+00:00'),
-('2', '127.0.0.1', 'user2', 'host2:22', '', '', '123456', 'g0156', '8888', '2023-04-12 09:35:39+00:00', '2023-04-12 09:35:39+00:00');
\ No newline at end of file
+('2', '127.0.0.1', 'user2', 'host2:22', '', '', '123456', 'g0156', '8888', '2023-04-12 09:35:39+00:00', '2023-04-12 09:35:39+00:00');
+
+CREATE TABLE IF NOT EXISTS `t_bat_migration` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `name` varchar(255) NOT NULL,
+  `create_time` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `ux_name` (`name`)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8 ROW_FORMAT=COMPRESSED;
+
+CREATE TABLE IF NOT EXISTS `t_bat_cert` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `name` varchar(255) NOT NULL,
+  `data` mediumtext NOT NULL,
+  `create_time` datetime NOT NULL,
+  `update_time` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `ux_name` (`name`)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8 ROW_FORMAT=COMPRESSED;
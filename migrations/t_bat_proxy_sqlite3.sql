@@ -16,3 +16,19 @@ CREATE TABLE IF NOT EXISTS `t_bat_proxy` (
 INSERT OR IGNORE INTO "t_bat_proxy" ("id", "proxy_id", "user", "host", "private_key", "passphrase", "password", "node", "port", "create_time", "update_time") VALUES
 ('1', 'localhost', 'user1', 'host1:22', '', '', '123456', 'j2001', '18880', '2023-04-12 09:35:39+00:00', '2023-04-12 09:35:39+00:00'),
 ('2', '127.0.0.1', 'user2', 'host2:22', '', '', '123456', 'g0156', '8888', '2023-04-12 09:35:39+00:00', '2023-04-12 09:35:39+00:00');
+
+CREATE TABLE IF NOT EXISTS `t_bat_migration` (
+  `id` INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  `name` varchar(255) NOT NULL,
+  `create_time` datetime NOT NULL,
+  UNIQUE(`name`)
+);
+
+CREATE TABLE IF NOT EXISTS `t_bat_cert` (
+  `id` INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+  `name` varchar(255) NOT NULL,
+  `data` text NOT NULL,
+  `create_time` datetime NOT NULL,
+  `update_time` datetime NOT NULL,
+  UNIQUE(`name`)
+);
@@ -0,0 +1,41 @@
+package batproxy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PortRange is a range of ports, both ends included.
+type PortRange struct {
+	Min uint16
+	Max uint16
+}
+
+// ParsePortRange parses a range of the format <min>-<max>, or a single port.
+func ParsePortRange(s string) (PortRange, error) {
+	lo, hi, ok := strings.Cut(s, "-")
+	if !ok {
+		hi = lo
+	}
+
+	min, err := strconv.ParseUint(strings.TrimSpace(lo), 10, 16)
+	if err != nil || min == 0 {
+		return PortRange{}, fmt.Errorf("invalid port range %s, expect <min>-<max>", s)
+	}
+	max, err := strconv.ParseUint(strings.TrimSpace(hi), 10, 16)
+	if err != nil || max < min {
+		return PortRange{}, fmt.Errorf("invalid port range %s, expect <min>-<max>", s)
+	}
+
+	return PortRange{Min: uint16(min), Max: uint16(max)}, nil
+}
+
+// IsZero reports whether the range is empty.
+func (r PortRange) IsZero() bool {
+	return r.Min == 0
+}
+
+func (r PortRange) String() string {
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
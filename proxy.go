@@ -2,16 +2,34 @@ package batproxy
 
 import (
 	"context"
+	"encoding/base32"
 	"fmt"
+	"strings"
 	"time"
 )
 
+// Proxy types.
+const (
+	ProxyHTTP = "http"
+	ProxyTCP  = "tcp"
+)
+
 type Proxy struct {
 	// ID Unique proxy id.
 	// Format: <uuid><.suffix>
 	// Output only.
 	ID string `json:"proxy_id"`
 
+	// Type Protocol proxied, one of [http, tcp]. The tcp proxies forward the
+	// connections of a port allocated on the server to the destination.
+	// Default: http.
+	// Optional.
+	Type string `json:"type,omitempty"`
+
+	// ListenPort Port of the server allocated to a tcp proxy.
+	// Output only.
+	ListenPort uint16 `json:"listen_port,omitempty"`
+
 	// User Over SSH login name.
 	// Required.
 	User string `json:"user"`
@@ -32,14 +50,85 @@ type Proxy struct {
 	// Optional.
 	Password string `json:"password,omitempty"`
 
+	// TOTPSecret Over SSH login base32 seed of the one-time codes answering
+	// keyboard-interactive prompts.
+	// Optional.
+	TOTPSecret string `json:"totp_secret,omitempty"`
+
+	// Certificate Over SSH login OpenSSH certificate of the private key.
+	// Optional.
+	Certificate string `json:"certificate,omitempty"`
+
+	// SignCertificate Over SSH login with a short-lived certificate signed by
+	// the server's certificate authority, for the private key or a generated
+	// key.
+	// Optional.
+	SignCertificate bool `json:"sign_certificate,omitempty"`
+
+	// Agent Over SSH login with the keys of the server's ssh-agent.
+	// Optional.
+	Agent bool `json:"agent,omitempty"`
+
+	// AgentKeyFilter Comment or SHA256 fingerprint of the ssh-agent keys to
+	// login with, all of them if empty.
+	// Optional.
+	AgentKeyFilter string `json:"agent_key_filter,omitempty"`
+
+	// HostKeyFingerprint Over SSH login host key SHA256 fingerprint, pins the
+	// host key instead of the server's host key policy.
+	// Format: SHA256:<base64>
+	// Optional.
+	HostKeyFingerprint string `json:"host_key_fingerprint,omitempty"`
+
+	// JumpHosts Over SSH jump hosts dialed in order to reach host, each
+	// through the previous one.
+	// Optional.
+	JumpHosts []*JumpHost `json:"jump_hosts,omitempty"`
+
+	// Upstream Over SSH SOCKS5 or HTTP CONNECT proxy to reach the first of
+	// the jump hosts and host through, overrides the server's one.
+	// Format: <socks5|socks5h|http>://[user:password@]host:port
+	// Optional.
+	Upstream string `json:"upstream,omitempty"`
+
+	// SSHOptions Over SSH connection settings, override the server's ones.
+	// Optional.
+	SSHOptions *SSHOptions `json:"ssh_options,omitempty"`
+
 	// Node Proxy to destination.
-	// Required.
+	// Required unless socket, resolver or slurm job.
 	Node string `json:"node"`
 
 	// Port Proxy to destination.
-	// Required.
+	// Required unless socket or resolver.
 	Port uint16 `json:"port"`
 
+	// Socket Proxy to the unix domain socket of this absolute path on host,
+	// instead of node and port.
+	// Optional.
+	Socket string `json:"socket,omitempty"`
+
+	// Resolver Proxy to the destination found by running a command on host,
+	// instead of node and port or socket.
+	// Optional.
+	Resolver *Resolver `json:"resolver,omitempty"`
+
+	// SlurmJob Proxy to port of the node running this Slurm job, instead of
+	// node, or to the destination found by resolver once the job runs.
+	// Optional.
+	SlurmJob *SlurmJob `json:"slurm_job,omitempty"`
+
+	// Target Scheme, base path and TLS settings of the destination.
+	// Default: plain http.
+	// Optional.
+	Target *Target `json:"target,omitempty"`
+
+	// Access Credentials required to reach the destination through the
+	// reverse proxy, stored hashed.
+	// Default: open to anyone knowing the proxy id.
+	// Optional.
+	Access *Access `json:"access,omitempty"`
+
 	// CreateTime Create time of this address.
 	// Output only.
 	CreateTime time.Time `json:"create_time"`
@@ -54,17 +143,256 @@ func (p *Proxy) Validate() error {
 		return fmt.Errorf("invalid ssh format user@host: %s@%s", p.User, p.Host)
 	}
 
-	if p.PrivateKey == "" && p.Password == "" {
-		return fmt.Errorf("ssh auth required one of [passowrd, private_key]")
+	if p.PrivateKey == "" && p.Password == "" && p.TOTPSecret == "" && !p.Agent && !p.SignCertificate {
+		return fmt.Errorf("ssh auth required one of [passowrd, totp_secret, private_key, agent, sign_certificate]")
+	}
+
+	if err := validateTOTPSecret(p.TOTPSecret); err != nil {
+		return err
+	}
+
+	if p.Certificate != "" && p.PrivateKey == "" {
+		return fmt.Errorf("ssh certificate requires its private_key")
+	}
+
+	if p.HostKeyFingerprint != "" && !strings.HasPrefix(p.HostKeyFingerprint, "SHA256:") {
+		return fmt.Errorf("invalid host key fingerprint %s, expect SHA256:<base64>", p.HostKeyFingerprint)
+	}
+
+	for i, j := range p.JumpHosts {
+		if err := j.Validate(); err != nil {
+			return fmt.Errorf("jump host %d: %v", i, err)
+		}
+	}
+
+	if p.Upstream != "" {
+		if _, err := ParseUpstream(p.Upstream); err != nil {
+			return err
+		}
+	}
+
+	if p.SSHOptions != nil {
+		if err := p.SSHOptions.Validate(); err != nil {
+			return err
+		}
 	}
 
-	if p.Node == "" || p.Port == 0 {
+	switch p.Type {
+	case "", ProxyHTTP:
+	case ProxyTCP:
+		if p.Target != nil {
+			return fmt.Errorf("proxy target requires type %s", ProxyHTTP)
+		}
+		if p.Access.Enabled() {
+			return fmt.Errorf("proxy access requires type %s", ProxyHTTP)
+		}
+	default:
+		return fmt.Errorf("invalid proxy type %s, expect one of [%s, %s]", p.Type, ProxyHTTP, ProxyTCP)
+	}
+
+	if p.Target != nil {
+		if err := p.Target.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if p.Access != nil {
+		if err := p.Access.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if p.SlurmJob != nil {
+		if p.Node != "" || p.Socket != "" {
+			return fmt.Errorf("proxy slurm job requires one of [port, resolver] only")
+		}
+		if p.Resolver != nil {
+			if p.Port != 0 {
+				return fmt.Errorf("proxy slurm job requires one of [port, resolver] only")
+			}
+			if err := p.Resolver.Validate(); err != nil {
+				return err
+			}
+		} else if p.Port == 0 {
+			return fmt.Errorf("invalid proxy destination slurm job %s port %d", p.SlurmJob.JobID, p.Port)
+		}
+		if err := p.SlurmJob.Validate(); err != nil {
+			return err
+		}
+	} else if p.Resolver != nil {
+		if p.Node != "" || p.Port != 0 || p.Socket != "" {
+			return fmt.Errorf("proxy destination requires one of [socket, node and port, resolver]")
+		}
+		if err := p.Resolver.Validate(); err != nil {
+			return err
+		}
+	} else if p.Socket != "" {
+		if p.Node != "" || p.Port != 0 {
+			return fmt.Errorf("proxy destination requires one of [socket, node and port]")
+		}
+		if !strings.HasPrefix(p.Socket, "/") {
+			return fmt.Errorf("invalid proxy socket %s, expect an absolute path", p.Socket)
+		}
+	} else if p.Node == "" || p.Port == 0 {
 		return fmt.Errorf("invalid proxy destination %s:%d", p.Node, p.Port)
 	}
 
 	return nil
 }
 
+// JumpHost is a bastion on the way to the login host, like ssh ProxyJump.
+type JumpHost struct {
+	// User Over SSH login name.
+	// Required.
+	User string `json:"user"`
+
+	// Host Over SSH login host.
+	// Required.
+	Host string `json:"host"`
+
+	// PrivateKey Over SSH login private key.
+	// Optional.
+	PrivateKey string `json:"private_key,omitempty"`
+
+	// Passphrase Over SSH login private key passphrase.
+	// Optional.
+	Passphrase string `json:"passphrase,omitempty"`
+
+	// Password Over SSH login password.
+	// Optional.
+	Password string `json:"password,omitempty"`
+
+	// TOTPSecret Over SSH login base32 seed of the one-time codes answering
+	// keyboard-interactive prompts.
+	// Optional.
+	TOTPSecret string `json:"totp_secret,omitempty"`
+
+	// Certificate Over SSH login OpenSSH certificate of the private key.
+	// Optional.
+	Certificate string `json:"certificate,omitempty"`
+
+	// SignCertificate Over SSH login with a short-lived certificate signed by
+	// the server's certificate authority, for the private key or a generated
+	// key.
+	// Optional.
+	SignCertificate bool `json:"sign_certificate,omitempty"`
+
+	// Agent Over SSH login with the keys of the server's ssh-agent.
+	// Optional.
+	Agent bool `json:"agent,omitempty"`
+
+	// AgentKeyFilter Comment or SHA256 fingerprint of the ssh-agent keys to
+	// login with, all of them if empty.
+	// Optional.
+	AgentKeyFilter string `json:"agent_key_filter,omitempty"`
+
+	// HostKeyFingerprint Over SSH login host key SHA256 fingerprint.
+	// Optional.
+	HostKeyFingerprint string `json:"host_key_fingerprint,omitempty"`
+}
+
+func (j *JumpHost) Validate() error {
+	if j.User == "" || j.Host == "" {
+		return fmt.Errorf("invalid ssh format user@host: %s@%s", j.User, j.Host)
+	}
+
+	if j.PrivateKey == "" && j.Password == "" && j.TOTPSecret == "" && !j.Agent && !j.SignCertificate {
+		return fmt.Errorf("ssh auth required one of [passowrd, totp_secret, private_key, agent, sign_certificate]")
+	}
+
+	if err := validateTOTPSecret(j.TOTPSecret); err != nil {
+		return err
+	}
+
+	if j.Certificate != "" && j.PrivateKey == "" {
+		return fmt.Errorf("ssh certificate requires its private_key")
+	}
+
+	if j.HostKeyFingerprint != "" && !strings.HasPrefix(j.HostKeyFingerprint, "SHA256:") {
+		return fmt.Errorf("invalid host key fingerprint %s, expect SHA256:<base64>", j.HostKeyFingerprint)
+	}
+
+	return nil
+}
+
+// SSHOptions tune the ssh connection to a login host. Zero fields keep the
+// default.
+type SSHOptions struct {
+	// ConnectTimeout Seconds to establish the ssh connection, retries
+	// included.
+	ConnectTimeout int64 `json:"connect_timeout,omitempty"`
+
+	// ServerAliveInterval Seconds between keepalive requests.
+	ServerAliveInterval int64 `json:"server_alive_interval,omitempty"`
+
+	// ServerAliveCountMax Number of unanswered keepalive requests after which
+	// the ssh connection is closed.
+	ServerAliveCountMax uint32 `json:"server_alive_count_max,omitempty"`
+
+	// RetryMin Seconds before retrying a failed connection, doubled on every
+	// retry.
+	RetryMin int64 `json:"retry_min,omitempty"`
+
+	// RetryMax Maximum seconds between retries of a failed connection.
+	RetryMax int64 `json:"retry_max,omitempty"`
+
+	// Forward How streams reach the destination, one of [direct, stdio,
+	// auto]. direct forwards them over the ssh connection, stdio relays them
+	// through RelayCommand run on the login host, for servers disabling tcp
+	// forwarding, and auto relays them once forwarding was refused.
+	// Default: direct.
+	Forward string `json:"forward,omitempty"`
+
+	// RelayCommand Command relaying its stdin and stdout to the
+	// destination, %h is replaced by the host and %p by the port.
+	// Default: nc %h %p.
+	RelayCommand string `json:"relay_command,omitempty"`
+
+	// RelayUnixCommand Command relaying its stdin and stdout to the unix
+	// domain socket of the destination, %h is replaced by its path.
+	// Default: nc -U %h.
+	RelayUnixCommand string `json:"relay_unix_command,omitempty"`
+}
+
+func (o *SSHOptions) Validate() error {
+	if o.ConnectTimeout < 0 || o.ServerAliveInterval < 0 || o.RetryMin < 0 || o.RetryMax < 0 {
+		return fmt.Errorf("invalid ssh options, expect non-negative seconds")
+	}
+
+	if o.RetryMin > 0 && o.RetryMax > 0 && o.RetryMin > o.RetryMax {
+		return fmt.Errorf("invalid ssh options, retry_min %d greater than retry_max %d", o.RetryMin, o.RetryMax)
+	}
+
+	switch o.Forward {
+	case "", "direct", "stdio", "auto":
+	default:
+		return fmt.Errorf("invalid ssh options forward %q, expect one of [direct, stdio, auto]", o.Forward)
+	}
+
+	if o.RelayCommand != "" && !strings.Contains(o.RelayCommand, "%h") {
+		return fmt.Errorf("invalid ssh options relay_command %q, expect %%h and %%p", o.RelayCommand)
+	}
+
+	if o.RelayUnixCommand != "" && !strings.Contains(o.RelayUnixCommand, "%h") {
+		return fmt.Errorf("invalid ssh options relay_unix_command %q, expect %%h", o.RelayUnixCommand)
+	}
+
+	return nil
+}
+
+// validateTOTPSecret checks secret is base32, as printed by authenticator
+// setups.
+func validateTOTPSecret(secret string) error {
+	if secret == "" {
+		return nil
+	}
+	secret = strings.TrimRight(strings.ToUpper(strings.ReplaceAll(secret, " ", "")), "=")
+	if _, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret); err != nil {
+		return fmt.Errorf("invalid totp secret, expect base32: %v", err)
+	}
+	return nil
+}
+
 type CreateProxyOptions struct {
 	// Suffix will append after uuid
 	// Format: <uuid><.suffix>
@@ -95,4 +423,8 @@ type ProxyService interface {
 	CreateProxy(ctx context.Context, proxy *Proxy, opts CreateProxyOptions) error
 	ListProxies(ctx context.Context, opts ListProxiesOptions) (*ListProxiesPage, error)
 	DeleteProxy(ctx context.Context, proxyID string) error
+
+	// UpdateProxyAccess replaces the access of the proxy of proxyID, hashing
+	// its credentials. A nil access opens the proxy.
+	UpdateProxyAccess(ctx context.Context, proxyID string, access *Access) error
 }
@@ -0,0 +1,157 @@
+package batproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultResolverTTL is how long a resolved destination is used before the
+// command runs again.
+const DefaultResolverTTL = time.Minute
+
+// Resolver finds the destination of a proxy by running a command on its
+// login host, for applications listening on a new node and port on every
+// launch.
+type Resolver struct {
+	// Command Shell command run on the login host, e.g.
+	// cat ~/.batproxy/job-1234.json.
+	// Required.
+	Command string `json:"command"`
+
+	// Regexp Regular expression matching the output of command, with the
+	// named groups node and port, or socket. The output is a JSON object
+	// without it.
+	// Optional.
+	Regexp string `json:"regexp,omitempty"`
+
+	// NodeField Dot separated path of the node in the JSON output.
+	// Default: node.
+	// Optional.
+	NodeField string `json:"node_field,omitempty"`
+
+	// PortField Dot separated path of the port in the JSON output.
+	// Default: port.
+	// Optional.
+	PortField string `json:"port_field,omitempty"`
+
+	// SocketField Dot separated path of the socket in the JSON output.
+	// Default: socket.
+	// Optional.
+	SocketField string `json:"socket_field,omitempty"`
+
+	// TTL Seconds the destination is used before command runs again, it
+	// also runs again after the destination failed.
+	// Default: 60.
+	// Optional.
+	TTL int64 `json:"ttl,omitempty"`
+}
+
+func (r *Resolver) Validate() error {
+	if strings.TrimSpace(r.Command) == "" {
+		return fmt.Errorf("resolver command required")
+	}
+
+	if r.Regexp != "" {
+		re, err := regexp.Compile(r.Regexp)
+		if err != nil {
+			return fmt.Errorf("invalid resolver regexp: %v", err)
+		}
+		names := make(map[string]bool)
+		for _, name := range re.SubexpNames() {
+			names[name] = true
+		}
+		if !names["socket"] && (!names["node"] || !names["port"]) {
+			return fmt.Errorf("invalid resolver regexp, expect the named groups node and port, or socket")
+		}
+	}
+
+	if r.TTL < 0 {
+		return fmt.Errorf("invalid resolver ttl %d, expect non-negative seconds", r.TTL)
+	}
+
+	return nil
+}
+
+// Expiration returns how long a resolved destination is used.
+func (r *Resolver) Expiration() time.Duration {
+	if r.TTL > 0 {
+		return time.Duration(r.TTL) * time.Second
+	}
+	return DefaultResolverTTL
+}
+
+// Resolve sets the destination of p from output, the output of command.
+func (r *Resolver) Resolve(p *Proxy, output []byte) error {
+	var node, port, socket string
+	if r.Regexp != "" {
+		re, err := regexp.Compile(r.Regexp)
+		if err != nil {
+			return Errorf(EINVALID, "invalid resolver regexp: %v", err)
+		}
+		m := re.FindSubmatch(output)
+		if m == nil {
+			return Errorf(EBADGATEWAY, "resolve %s: output does not match %q", p.ID, r.Regexp)
+		}
+		for i, name := range re.SubexpNames() {
+			switch name {
+			case "node":
+				node = string(m[i])
+			case "port":
+				port = string(m[i])
+			case "socket":
+				socket = string(m[i])
+			}
+		}
+	} else {
+		var v interface{}
+		if err := json.Unmarshal(output, &v); err != nil {
+			return Errorf(EBADGATEWAY, "resolve %s: invalid json output: %v", p.ID, err)
+		}
+		node = jsonField(v, r.NodeField, "node")
+		port = jsonField(v, r.PortField, "port")
+		socket = jsonField(v, r.SocketField, "socket")
+	}
+
+	p.Node, p.Port, p.Socket = "", 0, ""
+	if socket != "" {
+		if !strings.HasPrefix(socket, "/") {
+			return Errorf(EBADGATEWAY, "resolve %s: invalid socket %s, expect an absolute path", p.ID, socket)
+		}
+		p.Socket = socket
+		return nil
+	}
+
+	n, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || n == 0 || node == "" {
+		return Errorf(EBADGATEWAY, "resolve %s: invalid destination %s:%s", p.ID, node, port)
+	}
+	p.Node, p.Port = node, uint16(n)
+
+	return nil
+}
+
+// jsonField returns the string or number at the dot separated path of v,
+// path defaults to def.
+func jsonField(v interface{}, path, def string) string {
+	if path == "" {
+		path = def
+	}
+	for _, name := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		v = m[name]
+	}
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
@@ -0,0 +1,119 @@
+package batproxy
+
+import (
+	"testing"
+)
+
+func TestResolverResolve(t *testing.T) {
+	tests := []struct {
+		name     string
+		resolver Resolver
+		output   string
+
+		node   string
+		port   uint16
+		socket string
+		code   string // of the error, none if empty
+	}{
+		{
+			name:   "json",
+			output: `{"node": "cn01", "port": 8888}`,
+			node:   "cn01",
+			port:   8888,
+		},
+		{
+			name:     "json fields",
+			resolver: Resolver{NodeField: "job.host", PortField: "job.port"},
+			output:   `{"job": {"host": "cn02", "port": "8889"}}`,
+			node:     "cn02",
+			port:     8889,
+		},
+		{
+			name:   "json socket",
+			output: `{"socket": "/tmp/app.sock"}`,
+			socket: "/tmp/app.sock",
+		},
+		{
+			name:   "json invalid",
+			output: `Running on cn01:8888`,
+			code:   EBADGATEWAY,
+		},
+		{
+			name:   "json missing port",
+			output: `{"node": "cn01"}`,
+			code:   EBADGATEWAY,
+		},
+		{
+			name:   "json relative socket",
+			output: `{"socket": "app.sock"}`,
+			code:   EBADGATEWAY,
+		},
+		{
+			name:     "regexp",
+			resolver: Resolver{Regexp: `Running on (?P<node>[\w.-]+):(?P<port>\d+)`},
+			output:   "starting\nRunning on cn03:8890\n",
+			node:     "cn03",
+			port:     8890,
+		},
+		{
+			name:     "regexp socket",
+			resolver: Resolver{Regexp: `listening on (?P<socket>\S+)`},
+			output:   "listening on /run/user/1000/app.sock",
+			socket:   "/run/user/1000/app.sock",
+		},
+		{
+			name:     "regexp no match",
+			resolver: Resolver{Regexp: `Running on (?P<node>[\w.-]+):(?P<port>\d+)`},
+			output:   "starting\n",
+			code:     EBADGATEWAY,
+		},
+		{
+			name:     "regexp port out of range",
+			resolver: Resolver{Regexp: `(?P<node>\w+):(?P<port>\d+)`},
+			output:   "cn01:70000",
+			code:     EBADGATEWAY,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the previous destination is replaced
+			p := &Proxy{ID: "p", Node: "old", Port: 1, Socket: "/old.sock"}
+			tt.resolver.Command = "cat app.json"
+
+			err := tt.resolver.Resolve(p, []byte(tt.output))
+			if code := ErrorCode(err); code != tt.code {
+				t.Fatalf("Resolve: code = %q, want %q (err = %v)", code, tt.code, err)
+			}
+			if tt.code != "" {
+				return
+			}
+			if p.Node != tt.node || p.Port != tt.port || p.Socket != tt.socket {
+				t.Errorf("destination = %q %d %q, want %q %d %q", p.Node, p.Port, p.Socket, tt.node, tt.port, tt.socket)
+			}
+		})
+	}
+}
+
+func TestResolverValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		resolver Resolver
+		valid    bool
+	}{
+		{name: "command", resolver: Resolver{Command: "cat app.json"}, valid: true},
+		{name: "no command", resolver: Resolver{Command: " "}},
+		{name: "invalid regexp", resolver: Resolver{Command: "cat app.log", Regexp: "("}},
+		{name: "regexp without port", resolver: Resolver{Command: "cat app.log", Regexp: "(?P<node>.*)"}},
+		{name: "regexp socket", resolver: Resolver{Command: "cat app.log", Regexp: "(?P<socket>.*)"}, valid: true},
+		{name: "negative ttl", resolver: Resolver{Command: "cat app.json", TTL: -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.resolver.Validate(); (err == nil) != tt.valid {
+				t.Errorf("Validate = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
@@ -29,6 +29,17 @@ function init_mysql() {
   >&2 echo "MySQL is up and running on port ${DB_PORT}!"
 
   MYSQL_PWD="${MYSQL_ROOT_PASSWORD}" mysql -h "${MYSQL_HOST}" -P "${MYSQL_PORT}" -u "root" -D "${MYSQL_DATABASE}" -e "source migrations/t_bat_proxy_mysql.sql"
+
+  # Apply the migrations not applied yet, in order
+  for migration in migrations/[0-9]*_mysql.sql
+  do
+      name=$(basename "${migration}" _mysql.sql)
+      applied=$(MYSQL_PWD="${MYSQL_ROOT_PASSWORD}" mysql -h "${MYSQL_HOST}" -P "${MYSQL_PORT}" -u "root" -D "${MYSQL_DATABASE}" -N -e "SELECT COUNT(*) FROM t_bat_migration WHERE name = '${name}'")
+      if [[ "${applied}" == "0" ]]
+      then
+          MYSQL_PWD="${MYSQL_ROOT_PASSWORD}" mysql -h "${MYSQL_HOST}" -P "${MYSQL_PORT}" -u "root" -D "${MYSQL_DATABASE}" -e "source ${migration}; INSERT INTO t_bat_migration (name, create_time) VALUES ('${name}', UTC_TIMESTAMP());"
+      fi
+  done
   >&2 echo "MySQL has been migrated, ready to go!"
 }
 
@@ -36,6 +47,22 @@ function init_sqlite3() {
   SQLITE_DATABASE=${SQLITE_DATABASE:=batproxy.db}
 
   sqlite3 "${SQLITE_DATABASE}" < migrations/t_bat_proxy_sqlite3.sql
+
+  # Apply the migrations not applied yet, in order
+  for migration in migrations/[0-9]*_sqlite3.sql
+  do
+      name=$(basename "${migration}" _sqlite3.sql)
+      applied=$(sqlite3 "${SQLITE_DATABASE}" "SELECT COUNT(*) FROM t_bat_migration WHERE name = '${name}'")
+      if [[ "${applied}" == "0" ]]
+      then
+          {
+              echo "BEGIN;"
+              cat "${migration}"
+              echo "INSERT INTO t_bat_migration (name, create_time) VALUES ('${name}', datetime('now'));"
+              echo "COMMIT;"
+          } | sqlite3 "${SQLITE_DATABASE}"
+      fi
+  done
 }
 
 case $1 in
@@ -0,0 +1,94 @@
+package batproxy
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// SlurmJob finds the node of a proxy from the Slurm job running its
+// application, with scontrol on the login host.
+type SlurmJob struct {
+	// JobID Slurm job id.
+	// Format: <job id>[_<array task id>]
+	// Required.
+	JobID string `json:"job_id"`
+
+	// Expire Delete the proxy once the job ended, instead of suspending it.
+	// Optional.
+	Expire bool `json:"expire,omitempty"`
+
+	// TTL Seconds the node is used before checking the job again.
+	// Default: 60.
+	// Optional.
+	TTL int64 `json:"ttl,omitempty"`
+}
+
+var (
+	slurmJobIDRegexp     = regexp.MustCompile(`^[0-9]+(_[0-9]+)?$`)
+	slurmJobStateRegexp  = regexp.MustCompile(`(?:^|\s)JobState=(\S+)`)
+	slurmBatchHostRegexp = regexp.MustCompile(`(?:^|\s)BatchHost=(\S+)`)
+)
+
+func (j *SlurmJob) Validate() error {
+	if !slurmJobIDRegexp.MatchString(j.JobID) {
+		return fmt.Errorf("invalid slurm job id %q, expect <job id>[_<array task id>]", j.JobID)
+	}
+
+	if j.TTL < 0 {
+		return fmt.Errorf("invalid slurm job ttl %d, expect non-negative seconds", j.TTL)
+	}
+
+	return nil
+}
+
+// Command returns the command printing the job on the login host. The
+// errors are printed too, a job forgotten by the controller has ended.
+func (j *SlurmJob) Command() string {
+	return "scontrol -o show job " + j.JobID + " 2>&1; true"
+}
+
+// Expiration returns how long the node of the job is used.
+func (j *SlurmJob) Expiration() time.Duration {
+	if j.TTL > 0 {
+		return time.Duration(j.TTL) * time.Second
+	}
+	return DefaultResolverTTL
+}
+
+// Resolve sets the node of p from output, the output of Command. It returns
+// an EJOBPENDING error until the job runs, and an EJOBENDED error once it
+// ended.
+func (j *SlurmJob) Resolve(p *Proxy, output []byte) error {
+	if bytes.Contains(output, []byte("Invalid job id")) {
+		return Errorf(EJOBENDED, "slurm job %s of %s has ended", j.JobID, p.ID)
+	}
+
+	// array jobs print a line per task
+	line := output
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+
+	m := slurmJobStateRegexp.FindSubmatch(line)
+	if m == nil {
+		return Errorf(EBADGATEWAY, "slurm job %s of %s: unexpected output: %s", j.JobID, p.ID, bytes.TrimSpace(output))
+	}
+
+	switch state := string(m[1]); state {
+	case "RUNNING":
+	case "PENDING", "CONFIGURING", "REQUEUED", "REQUEUE_HOLD", "REQUEUE_FED", "RESIZING", "SUSPENDED", "STOPPED":
+		return Errorf(EJOBPENDING, "slurm job %s of %s is %s", j.JobID, p.ID, state)
+	default:
+		return Errorf(EJOBENDED, "slurm job %s of %s has ended: %s", j.JobID, p.ID, state)
+	}
+
+	m = slurmBatchHostRegexp.FindSubmatch(line)
+	if m == nil || string(m[1]) == "(null)" {
+		return Errorf(EJOBPENDING, "slurm job %s of %s has no node yet", j.JobID, p.ID)
+	}
+	p.Node = string(m[1])
+
+	return nil
+}
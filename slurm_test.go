@@ -0,0 +1,91 @@
+package batproxy
+
+import (
+	"testing"
+)
+
+func TestSlurmJobResolve(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+
+		node string
+		code string // of the error, none if empty
+	}{
+		{
+			name:   "running",
+			output: "JobId=1234 JobName=jupyter JobState=RUNNING Reason=None BatchHost=cn01 NumNodes=1\n",
+			node:   "cn01",
+		},
+		{
+			name:   "pending",
+			output: "JobId=1234 JobName=jupyter JobState=PENDING Reason=Priority BatchHost=(null)\n",
+			code:   EJOBPENDING,
+		},
+		{
+			name:   "running without node",
+			output: "JobId=1234 JobName=jupyter JobState=RUNNING BatchHost=(null)\n",
+			code:   EJOBPENDING,
+		},
+		{
+			name:   "suspended",
+			output: "JobId=1234 JobState=SUSPENDED BatchHost=cn01\n",
+			code:   EJOBPENDING,
+		},
+		{
+			name:   "completed",
+			output: "JobId=1234 JobState=COMPLETED BatchHost=cn01\n",
+			code:   EJOBENDED,
+		},
+		{
+			name:   "forgotten",
+			output: "slurm_load_jobs error: Invalid job id specified\n",
+			code:   EJOBENDED,
+		},
+		{
+			name:   "array task",
+			output: "JobId=1235 ArrayJobId=1234 ArrayTaskId=1 JobState=RUNNING BatchHost=cn02\nJobId=1236 ArrayJobId=1234 ArrayTaskId=2 JobState=RUNNING BatchHost=cn03\n",
+			node:   "cn02",
+		},
+		{
+			name:   "unexpected",
+			output: "scontrol: command not found\n",
+			code:   EBADGATEWAY,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := &SlurmJob{JobID: "1234"}
+			p := &Proxy{ID: "p", Port: 8888}
+
+			err := j.Resolve(p, []byte(tt.output))
+			if code := ErrorCode(err); code != tt.code {
+				t.Fatalf("Resolve: code = %q, want %q (err = %v)", code, tt.code, err)
+			}
+			if p.Node != tt.node {
+				t.Errorf("node = %q, want %q", p.Node, tt.node)
+			}
+		})
+	}
+}
+
+func TestSlurmJobValidate(t *testing.T) {
+	tests := []struct {
+		jobID string
+		valid bool
+	}{
+		{jobID: "1234", valid: true},
+		{jobID: "1234_5", valid: true},
+		{jobID: ""},
+		{jobID: "1234; rm -rf ~"},
+		{jobID: "1234_"},
+	}
+
+	for _, tt := range tests {
+		j := &SlurmJob{JobID: tt.jobID}
+		if err := j.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate(%q) = %v, want valid %v", tt.jobID, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// CertCache stores the ACME account key and certificates in the database,
+// so all the replicas of the server share them.
+type CertCache struct {
+	db *DB
+}
+
+func NewCertCache(db *DB) *CertCache {
+	return &CertCache{db: db}
+}
+
+var _ autocert.Cache = (*CertCache)(nil)
+
+func (c *CertCache) Get(ctx context.Context, name string) ([]byte, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var data string
+	if err := tx.QueryRowContext(ctx, `
+		SELECT data FROM t_bat_cert
+		WHERE name = ?
+	`, name).Scan(&data); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, autocert.ErrCacheMiss
+		}
+		return nil, fmt.Errorf("select 't_bat_cert': %v", err)
+	}
+
+	return []byte(data), nil
+}
+
+func (c *CertCache) Put(ctx context.Context, name string, data []byte) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the replicas may put the same certificate at once
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO t_bat_cert (
+			name,
+			data,
+			create_time,
+			update_time
+		)
+		VALUES (?,?,?,?)
+		`+c.db.onConflictUpdate("name", "data", "update_time"),
+		name,
+		string(data),
+		tx.now,
+		tx.now,
+	); err != nil {
+		return fmt.Errorf("insert 't_bat_cert': %v", err)
+	}
+
+	return tx.Commit()
+}
+
+func (c *CertCache) Delete(ctx context.Context, name string) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := deleteCert(ctx, tx, name); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func deleteCert(ctx context.Context, tx *Tx, name string) error {
+	_, err := tx.ExecContext(ctx, `
+		DELETE FROM t_bat_cert
+		WHERE name = ?
+	`, name)
+	return err
+}
@@ -0,0 +1,69 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func TestCertCache(t *testing.T) {
+	ctx := context.Background()
+	c := NewCertCache(mustOpenDB(t))
+
+	if _, err := c.Get(ctx, "abc.example.com"); err != autocert.ErrCacheMiss {
+		t.Fatalf("Get missing = %v, want autocert.ErrCacheMiss", err)
+	}
+
+	for _, data := range []string{"first", "renewed"} {
+		if err := c.Put(ctx, "abc.example.com", []byte(data)); err != nil {
+			t.Fatalf("Put %s: %v", data, err)
+		}
+		got, err := c.Get(ctx, "abc.example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != data {
+			t.Errorf("Get = %q, want %q", got, data)
+		}
+	}
+
+	if err := c.Delete(ctx, "abc.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(ctx, "abc.example.com"); err != autocert.ErrCacheMiss {
+		t.Errorf("Get deleted = %v, want autocert.ErrCacheMiss", err)
+	}
+	if err := c.Delete(ctx, "abc.example.com"); err != nil {
+		t.Errorf("Delete missing = %v, want nil", err)
+	}
+}
+
+func TestCertCachePutConcurrent(t *testing.T) {
+	ctx := context.Background()
+	c := NewCertCache(mustOpenDB(t))
+
+	// the replicas renewing the same certificate at once
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- c.Put(ctx, "abc.example.com", []byte(fmt.Sprint("cert ", i)))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Put: %v", err)
+		}
+	}
+	if _, err := c.Get(ctx, "abc.example.com"); err != nil {
+		t.Errorf("Get = %v, want one of the certificates", err)
+	}
+}
@@ -0,0 +1,262 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/batx-dev/batproxy"
+)
+
+type KnownHostService struct {
+	db *DB
+}
+
+func NewKnownHostService(db *DB) *KnownHostService {
+	return &KnownHostService{db: db}
+}
+
+var _ batproxy.KnownHostService = (*KnownHostService)(nil)
+
+func (s *KnownHostService) AddKnownHost(ctx context.Context, host *batproxy.KnownHost) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	page, err := listKnownHosts(ctx, tx, batproxy.ListKnownHostsOptions{Host: host.Host})
+	if err != nil {
+		return err
+	}
+	for _, h := range page.KnownHosts {
+		if h.Fingerprint == host.Fingerprint {
+			*host = *h
+			return nil
+		}
+	}
+
+	if err := createKnownHost(ctx, tx, host); err != nil {
+		return err
+	}
+
+	// A concurrent first use of the host may have recorded the key since it
+	// was listed, return the stored one. It may also have trusted another
+	// key, which keeps the trust: this one waits for approval.
+	if page, err = listKnownHosts(ctx, tx, batproxy.ListKnownHostsOptions{Host: host.Host}); err != nil {
+		return err
+	}
+	var trusted bool
+	for _, h := range page.KnownHosts {
+		if h.Fingerprint == host.Fingerprint {
+			*host = *h
+		} else if h.Status == batproxy.KnownHostTrusted {
+			trusted = true
+		}
+	}
+	if trusted && host.Status == batproxy.KnownHostTrusted {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE t_bat_known_host
+			SET status = ?, update_time = ?
+			WHERE host = ? AND fingerprint = ?
+		`, batproxy.KnownHostPending, tx.now, host.Host, host.Fingerprint); err != nil {
+			return err
+		}
+		host.Status = batproxy.KnownHostPending
+		host.UpdateTime = tx.now
+	}
+
+	return tx.Commit()
+}
+
+// createKnownHost inserts host, unless its key is already known.
+func createKnownHost(ctx context.Context, tx *Tx, host *batproxy.KnownHost) error {
+	if host.Host == "" || host.Fingerprint == "" || host.PublicKey == "" {
+		return batproxy.Errorf(batproxy.EINVALID, "fields host, fingerprint and public key are required")
+	}
+
+	switch host.Status {
+	case batproxy.KnownHostTrusted, batproxy.KnownHostPending:
+	default:
+		return batproxy.Errorf(batproxy.EINVALID, "invalid known host status: %s", host.Status)
+	}
+
+	host.CreateTime = tx.now
+	host.UpdateTime = host.CreateTime
+
+	_, err := tx.ExecContext(ctx, tx.db.insertIgnore()+` INTO t_bat_known_host (
+			host,
+			key_type,
+			fingerprint,
+			public_key,
+			status,
+			create_time,
+			update_time
+		)
+		VALUES (?,?,?,?,?,?,?)
+		`,
+		&host.Host,
+		&host.KeyType,
+		&host.Fingerprint,
+		&host.PublicKey,
+		&host.Status,
+		&host.CreateTime,
+		&host.UpdateTime,
+	)
+	return err
+}
+
+func (s *KnownHostService) ListKnownHosts(ctx context.Context, opts batproxy.ListKnownHostsOptions) (*batproxy.ListKnownHostsPage, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	return listKnownHosts(ctx, tx, opts)
+}
+
+func listKnownHosts(ctx context.Context, tx *Tx, opts batproxy.ListKnownHostsOptions) (page *batproxy.ListKnownHostsPage, err error) {
+	var args []interface{}
+	where := []string{"1 = 1"}
+	if opts.Host != "" {
+		where, args = append(where, "host = ?"), append(args, opts.Host)
+	}
+	if opts.Status != "" {
+		where, args = append(where, "status = ?"), append(args, opts.Status)
+	}
+
+	var pageToken int
+	if len(opts.PageToken) > 0 {
+		if pageToken, err = strconv.Atoi(opts.PageToken); err != nil {
+			return nil, batproxy.Errorf(batproxy.EINVALID, "page_token is invalid")
+		}
+	}
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT
+		    host,
+		    key_type,
+		    fingerprint,
+		    public_key,
+		    status,
+		    create_time,
+		    update_time
+		FROM t_bat_known_host WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY id ASC
+		`+FormatLimitOffset(pageSize, pageToken),
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("select 't_bat_known_host': %v", err)
+	}
+	defer rows.Close()
+
+	hosts := make([]*batproxy.KnownHost, 0)
+	for rows.Next() {
+		host := &batproxy.KnownHost{}
+		if err = rows.Scan(
+			&host.Host,
+			&host.KeyType,
+			&host.Fingerprint,
+			&host.PublicKey,
+			&host.Status,
+			&host.CreateTime,
+			&host.UpdateTime,
+		); err != nil {
+			return nil, fmt.Errorf("scan 't_bat_known_host': %v", err)
+		}
+		hosts = append(hosts, host)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %v", err)
+	}
+
+	page = &batproxy.ListKnownHostsPage{
+		KnownHosts: hosts,
+	}
+
+	if len(hosts) == pageSize {
+		page.NextPageToken = strconv.Itoa(pageToken + pageSize)
+	}
+
+	return page, nil
+}
+
+func (s *KnownHostService) ApproveKnownHost(ctx context.Context, host, fingerprint string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	page, err := listKnownHosts(ctx, tx, batproxy.ListKnownHostsOptions{Host: host})
+	if err != nil {
+		return err
+	}
+
+	var approved *batproxy.KnownHost
+	for _, h := range page.KnownHosts {
+		if h.Fingerprint == fingerprint {
+			approved = h
+		}
+	}
+	if approved == nil {
+		return batproxy.Errorf(batproxy.ENOTFOUND, "host key %s of %s not found", fingerprint, host)
+	}
+
+	// The approved key replaces the keys of the same type it was
+	// presented instead of.
+	for _, h := range page.KnownHosts {
+		if h.Fingerprint != fingerprint && h.KeyType == approved.KeyType {
+			if err := deleteKnownHost(ctx, tx, h.Host, h.Fingerprint); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE t_bat_known_host
+		SET status = ?, update_time = ?
+		WHERE host = ? AND fingerprint = ?
+	`, batproxy.KnownHostTrusted, tx.now, host, fingerprint); err != nil {
+		return err
+	}
+
+	s.db.Logger.V(1).Info("approve",
+		"host", host,
+		"fingerprint", fingerprint,
+	)
+
+	return tx.Commit()
+}
+
+func (s *KnownHostService) DeleteKnownHost(ctx context.Context, host, fingerprint string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := deleteKnownHost(ctx, tx, host, fingerprint); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func deleteKnownHost(ctx context.Context, tx *Tx, host, fingerprint string) error {
+	if host == "" || fingerprint == "" {
+		return batproxy.Errorf(batproxy.EINVALID, "fields host and fingerprint are required")
+	}
+	_, err := tx.ExecContext(ctx, `
+		DELETE FROM t_bat_known_host
+		WHERE host = ? AND fingerprint = ?
+	`, host, fingerprint)
+	return err
+}
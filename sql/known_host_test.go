@@ -0,0 +1,101 @@
+package sql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/batx-dev/batproxy"
+)
+
+func TestAddKnownHost(t *testing.T) {
+	ctx := context.Background()
+	s := NewKnownHostService(mustOpenDB(t))
+
+	first := &batproxy.KnownHost{
+		Host:        "login1:22",
+		KeyType:     "ssh-ed25519",
+		Fingerprint: "SHA256:first",
+		PublicKey:   "ssh-ed25519 AAAA",
+		Status:      batproxy.KnownHostTrusted,
+	}
+	if err := s.AddKnownHost(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+
+	again := *first
+	again.Status = batproxy.KnownHostPending
+	if err := s.AddKnownHost(ctx, &again); err != nil {
+		t.Fatalf("add known key again: %v", err)
+	}
+	if again.Status != batproxy.KnownHostTrusted {
+		t.Errorf("status = %s, want the stored %s", again.Status, batproxy.KnownHostTrusted)
+	}
+}
+
+func TestCreateKnownHostConflict(t *testing.T) {
+	ctx := context.Background()
+	db := mustOpenDB(t)
+
+	// two first uses racing: both listed the host before either inserted
+	for i, status := range []string{batproxy.KnownHostTrusted, batproxy.KnownHostPending} {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := createKnownHost(ctx, tx, &batproxy.KnownHost{
+			Host:        "login1:22",
+			KeyType:     "ssh-ed25519",
+			Fingerprint: "SHA256:first",
+			PublicKey:   "ssh-ed25519 AAAA",
+			Status:      status,
+		}); err != nil {
+			t.Fatalf("create %d: %v", i, err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	page, err := NewKnownHostService(db).ListKnownHosts(ctx, batproxy.ListKnownHostsOptions{Host: "login1:22"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.KnownHosts) != 1 || page.KnownHosts[0].Status != batproxy.KnownHostTrusted {
+		t.Errorf("known hosts = %+v, want the first one only", page.KnownHosts)
+	}
+}
+
+func TestAddKnownHostTrustedRace(t *testing.T) {
+	ctx := context.Background()
+	s := NewKnownHostService(mustOpenDB(t))
+
+	// two first uses of the host presented different keys, both trusted
+	// before listing the other
+	for _, fingerprint := range []string{"SHA256:first", "SHA256:second"} {
+		host := &batproxy.KnownHost{
+			Host:        "login1:22",
+			KeyType:     "ssh-ed25519",
+			Fingerprint: fingerprint,
+			PublicKey:   "ssh-ed25519 AAAA",
+			Status:      batproxy.KnownHostTrusted,
+		}
+		if err := s.AddKnownHost(ctx, host); err != nil {
+			t.Fatal(err)
+		}
+		want := batproxy.KnownHostTrusted
+		if fingerprint == "SHA256:second" {
+			want = batproxy.KnownHostPending
+		}
+		if host.Status != want {
+			t.Errorf("status of %s = %s, want %s", fingerprint, host.Status, want)
+		}
+	}
+
+	page, err := s.ListKnownHosts(ctx, batproxy.ListKnownHostsOptions{Host: "login1:22", Status: batproxy.KnownHostTrusted})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.KnownHosts) != 1 || page.KnownHosts[0].Fingerprint != "SHA256:first" {
+		t.Errorf("trusted keys = %v, want SHA256:first only", page.KnownHosts)
+	}
+}
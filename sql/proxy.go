@@ -19,19 +19,55 @@ type ProxyService struct {
 
 	// suffix used for create proxy
 	suffix string
+
+	// tcpPorts are allocated to the tcp proxies
+	tcpPorts batproxy.PortRange
+
+	// tcpPortAvailable filters the ports to allocate
+	tcpPortAvailable func(port uint16) bool
 }
 
 type ProxyServiceOptions struct {
 	Suffix string
+
+	// TCPPorts are the ports allocated to the tcp proxies, which cannot be
+	// created without them.
+	TCPPorts batproxy.PortRange
+
+	// TCPPortAvailable reports whether a port of TCPPorts can be allocated,
+	// e.g. nothing else listens on it. If nil, all of them can.
+	TCPPortAvailable func(port uint16) bool
 }
 
 func NewProxyService(db *DB, opts ProxyServiceOptions) *ProxyService {
-	return &ProxyService{db: db, suffix: opts.Suffix}
+	return &ProxyService{
+		db:               db,
+		suffix:           opts.Suffix,
+		tcpPorts:         opts.TCPPorts,
+		tcpPortAvailable: opts.TCPPortAvailable,
+	}
 }
 
 var _ batproxy.ProxyService = (*ProxyService)(nil)
 
+// allocateRetries bounds the retries of a tcp proxy creation, after another
+// replica allocated the same port meanwhile.
+const allocateRetries = 5
+
+// errPortTaken is returned by createProxy when the listen port of the proxy
+// was allocated to another one meanwhile.
+var errPortTaken = batproxy.Errorf(batproxy.ECONFLICT, "listen port allocated to another proxy")
+
 func (s *ProxyService) CreateProxy(ctx context.Context, proxy *batproxy.Proxy, opts batproxy.CreateProxyOptions) error {
+	for i := 0; ; i++ {
+		err := s.createOnce(ctx, proxy, opts)
+		if err != errPortTaken || i == allocateRetries {
+			return err
+		}
+	}
+}
+
+func (s *ProxyService) createOnce(ctx context.Context, proxy *batproxy.Proxy, opts batproxy.CreateProxyOptions) error {
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
@@ -42,6 +78,13 @@ func (s *ProxyService) CreateProxy(ctx context.Context, proxy *batproxy.Proxy, o
 		opts.Suffix = s.suffix
 	}
 
+	proxy.ListenPort = 0
+	if proxy.Type == batproxy.ProxyTCP {
+		if proxy.ListenPort, err = allocatePort(ctx, tx, s.tcpPorts, s.tcpPortAvailable); err != nil {
+			return err
+		}
+	}
+
 	if err := createProxy(ctx, tx, proxy, opts); err != nil {
 		return err
 	}
@@ -57,6 +100,11 @@ func createProxy(ctx context.Context, tx *Tx, proxy *batproxy.Proxy, opts batpro
 	if i := strings.Index(proxy.Host, ":"); i == -1 {
 		proxy.Host += ":22"
 	}
+	for _, j := range proxy.JumpHosts {
+		if i := strings.Index(j.Host, ":"); i == -1 {
+			j.Host += ":22"
+		}
+	}
 
 	if strings.HasPrefix(proxy.ID, "http://") {
 		proxy.ID = strings.TrimPrefix(proxy.ID, "http://")
@@ -77,6 +125,12 @@ func createProxy(ctx context.Context, tx *Tx, proxy *batproxy.Proxy, opts batpro
 		}
 	}
 
+	if proxy.Access != nil {
+		if err := proxy.Access.Hash(); err != nil {
+			return err
+		}
+	}
+
 	proxy.CreateTime = tx.now
 	proxy.UpdateTime = proxy.CreateTime
 
@@ -88,12 +142,28 @@ func createProxy(ctx context.Context, tx *Tx, proxy *batproxy.Proxy, opts batpro
 		    private_key, 
 		    passphrase, 
 		    password, 
+		    totp_secret,
+		    certificate,
+		    sign_certificate,
+		    agent,
+		    agent_key_filter,
+		    host_key_fingerprint,
+		    jump_hosts,
+		    upstream,
+		    ssh_options,
 		    node,
-		    port, 
+		    port,
+		    socket, 
+		    resolver,
+		    slurm_job,
+		    target,
+		    type,
+		    listen_port,
+		    access,
 		    create_time, 
 		    update_time
 		)  
-		VALUES (?,?,?,?,?,?,?,?,?,?)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
 		`,
 		&proxy.ID,
 		&proxy.User,
@@ -101,25 +171,46 @@ func createProxy(ctx context.Context, tx *Tx, proxy *batproxy.Proxy, opts batpro
 		&proxy.PrivateKey,
 		&proxy.Passphrase,
 		&proxy.Password,
+		&proxy.TOTPSecret,
+		(*NullString)(&proxy.Certificate),
+		&proxy.SignCertificate,
+		&proxy.Agent,
+		&proxy.AgentKeyFilter,
+		&proxy.HostKeyFingerprint,
+		JSONValue{&proxy.JumpHosts},
+		&proxy.Upstream,
+		JSONValue{&proxy.SSHOptions},
 		&proxy.Node,
 		&proxy.Port,
+		&proxy.Socket,
+		JSONValue{&proxy.Resolver},
+		JSONValue{&proxy.SlurmJob},
+		JSONValue{&proxy.Target},
+		&proxy.Type,
+		&proxy.ListenPort,
+		JSONValue{&proxy.Access},
 		&proxy.CreateTime,
 		&proxy.UpdateTime,
 	)
 	if err != nil {
+		duplicate := false
 		if drvErr, ok := err.(sqlite3.Error); ok {
-			if drvErr.Code == sqlite3.ErrConstraint &&
-				// ErrConstraint means duplicate entry error.
-				drvErr.ExtendedCode == sqlite3.ErrConstraintUnique {
-				return batproxy.Errorf(batproxy.ECONFLICT, "'%s' already exists", proxy.ID)
-			}
+			// ErrConstraint means duplicate entry error.
+			duplicate = drvErr.Code == sqlite3.ErrConstraint &&
+				drvErr.ExtendedCode == sqlite3.ErrConstraintUnique
 		}
-
 		if drvErr, ok := err.(*mysql.MySQLError); ok {
 			// 1062 means duplicate entry error.
-			if drvErr.Number == 1062 {
-				return batproxy.Errorf(batproxy.ECONFLICT, "'%s' already exists", proxy.ID)
+			duplicate = drvErr.Number == 1062
+		}
+
+		if duplicate {
+			// the drivers name the duplicate key in their message only,
+			// t_bat_proxy.listen_port or ux_listen_port
+			if proxy.ListenPort != 0 && strings.Contains(err.Error(), "listen_port") {
+				return errPortTaken
 			}
+			return batproxy.Errorf(batproxy.ECONFLICT, "'%s' already exists", proxy.ID)
 		}
 
 		return err
@@ -128,6 +219,42 @@ func createProxy(ctx context.Context, tx *Tx, proxy *batproxy.Proxy, opts batpro
 	return nil
 }
 
+// allocatePort returns the first port of ports no tcp proxy listens on, and
+// available if not nil.
+func allocatePort(ctx context.Context, tx *Tx, ports batproxy.PortRange, available func(uint16) bool) (uint16, error) {
+	if ports.IsZero() {
+		return 0, batproxy.Errorf(batproxy.EINVALID, "tcp proxies require a port range")
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT listen_port FROM t_bat_proxy
+		WHERE type = ?
+	`, batproxy.ProxyTCP)
+	if err != nil {
+		return 0, fmt.Errorf("select 't_bat_proxy': %v", err)
+	}
+	defer rows.Close()
+
+	used := make(map[uint16]bool)
+	for rows.Next() {
+		var port uint16
+		if err := rows.Scan(&port); err != nil {
+			return 0, fmt.Errorf("scan 't_bat_proxy': %v", err)
+		}
+		used[port] = true
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("rows: %v", err)
+	}
+
+	for port := int(ports.Min); port <= int(ports.Max); port++ {
+		if !used[uint16(port)] && (available == nil || available(uint16(port))) {
+			return uint16(port), nil
+		}
+	}
+	return 0, batproxy.Errorf(batproxy.EUNAVAILABLE, "no free port in %s for tcp proxies", ports)
+}
+
 func (s *ProxyService) ListProxies(ctx context.Context, opts batproxy.ListProxiesOptions) (page *batproxy.ListProxiesPage, err error) {
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -168,8 +295,24 @@ func listProxies(ctx context.Context, tx *Tx, opts batproxy.ListProxiesOptions)
 		    private_key,
 		    passphrase,
 		    password,
+		    totp_secret,
+		    certificate,
+		    sign_certificate,
+		    agent,
+		    agent_key_filter,
+		    host_key_fingerprint,
+		    jump_hosts,
+		    upstream,
+		    ssh_options,
 		    node,
 		    port,
+		    socket,
+		    resolver,
+		    slurm_job,
+		    target,
+		    type,
+		    listen_port,
+		    access,
 		    create_time,
 		    update_time
 		FROM t_bat_proxy WHERE `+strings.Join(where, " AND ")+`
@@ -193,8 +336,24 @@ func listProxies(ctx context.Context, tx *Tx, opts batproxy.ListProxiesOptions)
 			&proxy.PrivateKey,
 			&proxy.Passphrase,
 			&proxy.Password,
+			&proxy.TOTPSecret,
+			(*NullString)(&proxy.Certificate),
+			&proxy.SignCertificate,
+			&proxy.Agent,
+			&proxy.AgentKeyFilter,
+			&proxy.HostKeyFingerprint,
+			JSONValue{&proxy.JumpHosts},
+			&proxy.Upstream,
+			JSONValue{&proxy.SSHOptions},
 			&proxy.Node,
 			&proxy.Port,
+			&proxy.Socket,
+			JSONValue{&proxy.Resolver},
+			JSONValue{&proxy.SlurmJob},
+			JSONValue{&proxy.Target},
+			&proxy.Type,
+			&proxy.ListenPort,
+			JSONValue{&proxy.Access},
 			&proxy.CreateTime,
 			&proxy.UpdateTime,
 		); err != nil {
@@ -245,11 +404,49 @@ func (s *ProxyService) DeleteProxy(ctx context.Context, proxyID string) error {
 		"host", proxy.Host,
 		"node", proxy.Node,
 		"port", proxy.Port,
+		"socket", proxy.Socket,
 	)
 
 	return tx.Commit()
 }
 
+func (s *ProxyService) UpdateProxyAccess(ctx context.Context, proxyID string, access *batproxy.Access) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	page, err := listProxies(ctx, tx, batproxy.ListProxiesOptions{ProxyID: proxyID})
+	if err != nil {
+		return err
+	}
+	if proxyID == "" || len(page.Proxies) == 0 {
+		return batproxy.Errorf(batproxy.ENOTFOUND, "proxy %s not found", proxyID)
+	}
+
+	proxy := page.Proxies[0]
+	proxy.Access = access
+	if err := proxy.Validate(); err != nil {
+		return batproxy.Errorf(batproxy.EINVALID, "%v", err)
+	}
+	if access != nil {
+		if err := access.Hash(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE t_bat_proxy
+		SET access = ?, update_time = ?
+		WHERE proxy_id = ?
+	`, JSONValue{&proxy.Access}, tx.now, proxyID); err != nil {
+		return fmt.Errorf("update 't_bat_proxy': %v", err)
+	}
+
+	return tx.Commit()
+}
+
 func deleteProxy(ctx context.Context, tx *Tx, proxyID string) error {
 	if proxyID == "" {
 		return batproxy.Errorf(batproxy.EINVALID, "field proxy id is required")
@@ -0,0 +1,115 @@
+package sql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/batx-dev/batproxy"
+)
+
+func TestProxyCertificate(t *testing.T) {
+	ctx := context.Background()
+	s := NewProxyService(mustOpenDB(t), ProxyServiceOptions{})
+
+	for _, p := range []*batproxy.Proxy{
+		{ID: "with-cert", User: "user1", Host: "login1", PrivateKey: "key", Certificate: "ssh-ed25519-cert-v01@openssh.com AAAA", Node: "node1", Port: 8888},
+		{ID: "without-cert", User: "user1", Host: "login1", Password: "123456", Node: "node1", Port: 8888},
+	} {
+		want := p.Certificate
+		if err := s.CreateProxy(ctx, p, batproxy.CreateProxyOptions{}); err != nil {
+			t.Fatalf("create %s: %v", p.ID, err)
+		}
+
+		page, err := s.ListProxies(ctx, batproxy.ListProxiesOptions{ProxyID: p.ID})
+		if err != nil {
+			t.Fatalf("list %s: %v", p.ID, err)
+		}
+		if len(page.Proxies) != 1 || page.Proxies[0].Certificate != want {
+			t.Errorf("list %s = %+v, want certificate %q", p.ID, page.Proxies, want)
+		}
+	}
+}
+
+// tcpProxy returns a tcp proxy to node1.
+func tcpProxy() *batproxy.Proxy {
+	return &batproxy.Proxy{Type: batproxy.ProxyTCP, User: "user1", Host: "login1", Password: "123456", Node: "node1", Port: 5432}
+}
+
+func TestCreateProxyListenPort(t *testing.T) {
+	ctx := context.Background()
+	s := NewProxyService(mustOpenDB(t), ProxyServiceOptions{
+		TCPPorts: batproxy.PortRange{Min: 20000, Max: 20001},
+	})
+
+	for _, want := range []uint16{20000, 20001} {
+		p := tcpProxy()
+		if err := s.CreateProxy(ctx, p, batproxy.CreateProxyOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if p.ListenPort != want {
+			t.Errorf("listen port = %d, want %d", p.ListenPort, want)
+		}
+	}
+	if err := s.CreateProxy(ctx, tcpProxy(), batproxy.CreateProxyOptions{}); batproxy.ErrorCode(err) != batproxy.EUNAVAILABLE {
+		t.Errorf("create past the range = %v, want %s", err, batproxy.EUNAVAILABLE)
+	}
+
+	// the http proxies listen on no port of their own
+	for i := 0; i < 2; i++ {
+		p := &batproxy.Proxy{User: "user1", Host: "login1", Password: "123456", Node: "node1", Port: 8888}
+		if err := s.CreateProxy(ctx, p, batproxy.CreateProxyOptions{}); err != nil {
+			t.Fatalf("create http proxy %d: %v", i, err)
+		}
+	}
+}
+
+func TestCreateProxyPortTaken(t *testing.T) {
+	ctx := context.Background()
+	db := mustOpenDB(t)
+
+	// another replica holds 20000 unseen by the allocation, until its
+	// listener is up
+	other := &batproxy.Proxy{ID: "other", User: "user1", Host: "login1", Password: "123456", Node: "node1", Port: 8888}
+	if err := NewProxyService(db, ProxyServiceOptions{}).CreateProxy(ctx, other, batproxy.CreateProxyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.db.Exec(`UPDATE t_bat_proxy SET listen_port = 20000 WHERE proxy_id = 'other'`); err != nil {
+		t.Fatal(err)
+	}
+
+	var tries int
+	s := NewProxyService(db, ProxyServiceOptions{
+		TCPPorts: batproxy.PortRange{Min: 20000, Max: 20001},
+		TCPPortAvailable: func(port uint16) bool {
+			if port == 20000 {
+				tries++
+				return tries == 1
+			}
+			return true
+		},
+	})
+
+	p := tcpProxy()
+	if err := s.CreateProxy(ctx, p, batproxy.CreateProxyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if p.ListenPort != 20001 || tries != 2 {
+		t.Errorf("listen port = %d after %d tries, want 20001 once 20000 conflicted", p.ListenPort, tries)
+	}
+}
+
+func TestUpdateProxyAccessTCP(t *testing.T) {
+	ctx := context.Background()
+	s := NewProxyService(mustOpenDB(t), ProxyServiceOptions{
+		TCPPorts: batproxy.PortRange{Min: 20000, Max: 20000},
+	})
+
+	p := tcpProxy()
+	if err := s.CreateProxy(ctx, p, batproxy.CreateProxyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	access := &batproxy.Access{BearerTokens: []*batproxy.AccessToken{{Token: "secret"}}}
+	if err := s.UpdateProxyAccess(ctx, p.ID, access); batproxy.ErrorCode(err) != batproxy.EINVALID {
+		t.Errorf("update access of a tcp proxy = %v, want %s", err, batproxy.EINVALID)
+	}
+}
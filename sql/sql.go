@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -16,6 +17,9 @@ import (
 type DB struct {
 	db *sql.DB
 
+	// driver is the name of the database driver, sqlite3 or mysql.
+	driver string
+
 	// Datasource name.
 	DSN string
 
@@ -55,6 +59,7 @@ func (db *DB) Open() (err error) {
 		return fmt.Errorf("invalid dsn: %s", db.DSN)
 	}
 
+	db.driver = dve
 	if db.db, err = sql.Open(dve, dsn); err != nil {
 		return err
 	}
@@ -68,6 +73,33 @@ func (db *DB) Open() (err error) {
 	return nil
 }
 
+// insertIgnore returns the INSERT statement of the driver skipping the rows
+// conflicting with a unique key.
+func (db *DB) insertIgnore() string {
+	if db.driver == "sqlite3" {
+		return "INSERT OR IGNORE"
+	}
+	return "INSERT IGNORE"
+}
+
+// onConflictUpdate returns the clause of the driver ending an INSERT
+// statement, updating columns of the row conflicting on the unique key
+// instead.
+func (db *DB) onConflictUpdate(key string, columns ...string) string {
+	sets := make([]string, len(columns))
+	for i, c := range columns {
+		if db.driver == "sqlite3" {
+			sets[i] = c + " = excluded." + c
+		} else {
+			sets[i] = c + " = VALUES(" + c + ")"
+		}
+	}
+	if db.driver == "sqlite3" {
+		return "ON CONFLICT(" + key + ") DO UPDATE SET " + strings.Join(sets, ", ")
+	}
+	return "ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+}
+
 // Close the database connection.
 func (db *DB) Close() error {
 	if db.db != nil {
@@ -109,11 +141,15 @@ func (s *NullString) Scan(value interface{}) error {
 		*s = ""
 		return nil
 	}
-	strVal, ok := value.(string)
-	if !ok {
-		return fmt.Errorf("NullString: cannot scan to string")
+	switch value := value.(type) {
+	case string:
+		*s = NullString(value)
+	case []byte:
+		// e.g. the TEXT columns of mysql
+		*s = NullString(value)
+	default:
+		return fmt.Errorf("NullString: cannot scan to string: %T", value)
 	}
-	*s = NullString(strVal)
 	return nil
 }
 
@@ -126,6 +162,44 @@ func (s *NullString) Value() (driver.Value, error) {
 	return string(*s), nil
 }
 
+// JSONValue represents a helper wrapper for a value stored as JSON text.
+// V must be a pointer. Also supports NULL and empty text for the zero value.
+type JSONValue struct {
+	V interface{}
+}
+
+// Scan implements the Scanner interface.
+func (j JSONValue) Scan(value interface{}) error {
+	var buf []byte
+	switch value := value.(type) {
+	case nil:
+		return nil
+	case string:
+		buf = []byte(value)
+	case []byte:
+		buf = value
+	default:
+		return fmt.Errorf("JSONValue: cannot scan to %T: %T", j.V, value)
+	}
+	if len(buf) == 0 {
+		return nil
+	}
+	return json.Unmarshal(buf, j.V)
+}
+
+// Value implements the driver Valuer interface.
+func (j JSONValue) Value() (driver.Value, error) {
+	buf, err := json.Marshal(j.V)
+	if err != nil {
+		return nil, err
+	}
+	switch string(buf) {
+	case "null", "[]", "{}":
+		return "", nil
+	}
+	return string(buf), nil
+}
+
 const (
 	// Datetime represents mysql DATETIME.
 	Datetime = "2006-01-02 15:04:05"
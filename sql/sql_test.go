@@ -0,0 +1,62 @@
+package sql
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// mustOpenDB returns a sqlite database migrated like scripts/init_db.sh does.
+func mustOpenDB(tb testing.TB) *DB {
+	tb.Helper()
+
+	db := NewDB("sqlite3://" + filepath.Join(tb.TempDir(), "batproxy.db"))
+	if err := db.Open(); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+
+	migrations, err := filepath.Glob("../migrations/[0-9]*_sqlite3.sql")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	sort.Strings(migrations)
+
+	for _, name := range append([]string{"../migrations/t_bat_proxy_sqlite3.sql"}, migrations...) {
+		migration, err := os.ReadFile(name)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if _, err := db.db.Exec(string(migration)); err != nil {
+			tb.Fatalf("migrate %s: %v", name, err)
+		}
+	}
+
+	return db
+}
+
+func TestNullStringScan(t *testing.T) {
+	tests := []struct {
+		value   interface{}
+		want    NullString
+		wantErr bool
+	}{
+		{value: nil, want: ""},
+		{value: "sqlite text", want: "sqlite text"},
+		{value: []byte("mysql text"), want: "mysql text"},
+		{value: int64(1), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		s := NullString("previous")
+		err := s.Scan(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Scan(%#v) err = %v, want error %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && s != tt.want {
+			t.Errorf("Scan(%#v) = %q, want %q", tt.value, s, tt.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package ssh
+
+import (
+	"bytes"
+	"io"
+	"net"
+
+	"github.com/batx-dev/batproxy"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Agent signs with the keys of an ssh-agent listening on a unix socket.
+type Agent struct {
+	// Socket Path of the agent socket, like SSH_AUTH_SOCK.
+	Socket string
+}
+
+// Signers returns the signers of the agent keys whose comment or SHA256
+// fingerprint is filter, or of all keys if filter is empty. The signers are
+// usable until closer is closed.
+func (a *Agent) Signers(filter string) (_ []ssh.Signer, closer io.Closer, err error) {
+	if a == nil || a.Socket == "" {
+		return nil, nil, batproxy.Errorf(batproxy.EINVALID, "ssh agent is not configured")
+	}
+
+	conn, err := net.Dial("unix", a.Socket)
+	if err != nil {
+		return nil, nil, batproxy.Errorf(batproxy.EINTERNAL, "dial ssh agent: %v", err)
+	}
+	defer func() {
+		if err != nil {
+			conn.Close()
+		}
+	}()
+
+	client := agent.NewClient(conn)
+
+	keys, err := client.List()
+	if err != nil {
+		return nil, nil, batproxy.Errorf(batproxy.EINTERNAL, "list ssh agent keys: %v", err)
+	}
+
+	signers, err := client.Signers()
+	if err != nil {
+		return nil, nil, batproxy.Errorf(batproxy.EINTERNAL, "ssh agent signers: %v", err)
+	}
+
+	if filter == "" {
+		return signers, conn, nil
+	}
+
+	var filtered []ssh.Signer
+	for _, key := range keys {
+		if key.Comment != filter && ssh.FingerprintSHA256(key) != filter {
+			continue
+		}
+		for _, signer := range signers {
+			if bytes.Equal(signer.PublicKey().Marshal(), key.Marshal()) {
+				filtered = append(filtered, signer)
+			}
+		}
+	}
+	if len(filtered) == 0 {
+		return nil, nil, batproxy.Errorf(batproxy.EINVALID, "no ssh agent key matches %s", filter)
+	}
+
+	return filtered, conn, nil
+}
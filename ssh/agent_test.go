@@ -0,0 +1,139 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/batx-dev/batproxy/internal/sshtest"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// newKey returns a new ed25519 signer.
+func newKey(t *testing.T) (ed25519.PrivateKey, ssh.Signer) {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv, signer
+}
+
+// marshalKey returns key PEM encoded.
+func marshalKey(t *testing.T, key ed25519.PrivateKey) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+// serveAgent serves keyring on a unix socket and returns its path.
+func serveAgent(t *testing.T, keyring agent.Agent) string {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				_ = agent.ServeAgent(keyring, c)
+			}()
+		}
+	}()
+
+	return socket
+}
+
+func TestAgent(t *testing.T) {
+	authorized, authorizedSigner := newKey(t)
+	other, _ := newKey(t)
+	unauthorized, _ := newKey(t)
+
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: other, Comment: "other"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.Add(agent.AddedKey{PrivateKey: authorized, Comment: "mine"}); err != nil {
+		t.Fatal(err)
+	}
+	socket := serveAgent(t, keyring)
+
+	srv := sshtest.NewServer(t, func(cfg *ssh.ServerConfig) {
+		cfg.PasswordCallback = nil
+		cfg.PublicKeyCallback = func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), authorizedSigner.PublicKey().Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unauthorized key")
+		}
+	})
+	echoAddr := echoServer(t)
+
+	tests := []struct {
+		name       string
+		filter     string
+		privateKey bool // also authenticate with an unauthorized key file
+		wantErr    bool
+	}{
+		{name: "all keys"},
+		{name: "comment", filter: "mine"},
+		{name: "fingerprint", filter: ssh.FingerprintSHA256(authorizedSigner.PublicKey())},
+		{name: "filtered out", filter: "other", wantErr: true},
+		{name: "no match", filter: "nope", wantErr: true},
+		{name: "after key file", privateKey: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{
+				User:           "user1",
+				Host:           srv.Addr,
+				UseAgent:       true,
+				AgentKeyFilter: tt.filter,
+				Agent:          &Agent{Socket: socket},
+				Logger:         testLogger,
+			}
+			if tt.privateKey {
+				c.PrivateKey = marshalKey(t, unauthorized)
+			}
+			s := New(testLogger, c)
+			defer s.Close()
+
+			got, err := echo(t, s, echoAddr, "hello")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("dial succeeded, want an authentication error")
+				}
+				return
+			}
+			if err != nil || got != "hello" {
+				t.Fatalf("echo = %q, %v, want %q", got, err, "hello")
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package ssh
+
+import (
+	"github.com/batx-dev/batproxy"
+	"golang.org/x/crypto/ssh"
+)
+
+// authMethods returns the methods to authenticate with, they are usable
+// until done is called. The error of a failed keyboard-interactive challenge
+// is stored in challengeErr, the handshake does not wrap it.
+func (c *Client) authMethods(challengeErr *error) (auth []ssh.AuthMethod, done func(), err error) {
+	var closers []func() error
+	closeAll := func() {
+		for _, closer := range closers {
+			_ = closer()
+		}
+	}
+	defer func() {
+		if err != nil {
+			closeAll()
+		}
+	}()
+
+	var signer ssh.Signer
+	if c.PrivateKey != "" {
+		if c.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(c.PrivateKey), []byte(c.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey([]byte(c.PrivateKey))
+		}
+		if err != nil {
+			return nil, nil, batproxy.Errorf(batproxy.EINVALID, "parse private key: %v", err)
+		}
+	}
+
+	// The certificate is offered before its plain key.
+	var signers []ssh.Signer
+	if cs, err := c.certSigner(signer); err != nil {
+		return nil, nil, err
+	} else if cs != nil {
+		signers = append(signers, cs)
+	}
+	if signer != nil {
+		signers = append(signers, signer)
+	}
+	if c.UseAgent {
+		agentSigners, closer, err := c.Agent.Signers(c.AgentKeyFilter)
+		if err != nil {
+			return nil, nil, err
+		}
+		closers = append(closers, closer.Close)
+		signers = append(signers, agentSigners...)
+	}
+	// A single method offers all the keys, the handshake does not try a
+	// second method of the same name.
+	if len(signers) > 0 {
+		auth = append(auth, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			return signers, nil
+		}))
+	}
+	if c.Password != "" {
+		auth = append(auth, ssh.Password(c.Password))
+	}
+	if c.Password != "" || c.TOTPSecret != "" {
+		auth = append(auth, ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+			answers, err := c.challenge(user, instruction, questions, echos)
+			*challengeErr = err
+			return answers, err
+		}))
+	}
+
+	return auth, closeAll, nil
+}
@@ -0,0 +1,174 @@
+package ssh
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/batx-dev/batproxy"
+	"golang.org/x/exp/slog"
+)
+
+// Breakers trip the circuit of the ssh servers which cannot be reached, so
+// that dials to them fail fast until the next retry. The delay between
+// retries grows from RetryMin to RetryMax of the failing client.
+type Breakers struct {
+	Logger *slog.Logger
+
+	mu       sync.Mutex // guards circuits
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	failures  int
+	delay     time.Duration
+	lastErr   string
+	openTime  time.Time
+	nextRetry time.Time
+	trial     bool // a dial is trying the host again
+}
+
+func NewBreakers(logger *slog.Logger) *Breakers {
+	return &Breakers{
+		Logger:   logger,
+		circuits: make(map[string]*circuit),
+	}
+}
+
+var _ batproxy.BreakerService = (*Breakers)(nil)
+
+// allow returns an ECIRCUITOPEN error if host must not be dialed yet. Once
+// the delay is over, a single dial is allowed to try host again.
+func (b *Breakers) allow(host string) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuits[host]
+	if c == nil {
+		return nil
+	}
+
+	if now := time.Now(); now.Before(c.nextRetry) {
+		return batproxy.Errorf(batproxy.ECIRCUITOPEN, "%s is unreachable after %d failures, next retry at %s",
+			host, c.failures, c.nextRetry.Format(time.RFC3339))
+	}
+	if c.trial {
+		return batproxy.Errorf(batproxy.ECIRCUITOPEN, "%s is unreachable after %d failures, retrying now",
+			host, c.failures)
+	}
+
+	c.trial = true
+	return nil
+}
+
+// success closes the circuit of host, the client reached it.
+func (b *Breakers) success(host string) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	c := b.circuits[host]
+	delete(b.circuits, host)
+	b.mu.Unlock()
+
+	if c != nil {
+		b.Logger.Info("breaker",
+			"status", "closed",
+			"host", host,
+			"failures", c.failures,
+		)
+	}
+}
+
+// abort ends the trial of host without telling whether it is reachable.
+func (b *Breakers) abort(host string) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	if c := b.circuits[host]; c != nil {
+		c.trial = false
+	}
+	b.mu.Unlock()
+}
+
+// failure opens the circuit of host, client failed to reach it with err.
+func (b *Breakers) failure(host string, client *Client, err error) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	c := b.circuits[host]
+	if c == nil {
+		c = &circuit{}
+		b.circuits[host] = c
+	}
+	c.trial = false
+	c.failures++
+	c.delay = client.getCurrentTempDelay(c.delay)
+	c.lastErr = err.Error()
+	c.openTime = time.Now()
+	c.nextRetry = c.openTime.Add(c.delay)
+	failures, nextRetry := c.failures, c.nextRetry
+	b.mu.Unlock()
+
+	b.Logger.Warn("breaker",
+		"status", "open",
+		"host", host,
+		"failures", failures,
+		"next_retry", nextRetry,
+		"err", err,
+	)
+}
+
+func (b *Breakers) ListBreakers(ctx context.Context) (*batproxy.ListBreakersPage, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	breakers := make([]*batproxy.Breaker, 0, len(b.circuits))
+	for host, c := range b.circuits {
+		state := batproxy.BreakerOpen
+		if !now.Before(c.nextRetry) {
+			state = batproxy.BreakerHalfOpen
+		}
+		breakers = append(breakers, &batproxy.Breaker{
+			Host:          host,
+			State:         state,
+			Failures:      c.failures,
+			LastError:     c.lastErr,
+			OpenTime:      c.openTime,
+			NextRetryTime: c.nextRetry,
+		})
+	}
+	sort.Slice(breakers, func(i, j int) bool { return breakers[i].Host < breakers[j].Host })
+
+	return &batproxy.ListBreakersPage{Breakers: breakers}, nil
+}
+
+// ResetBreaker closes the circuit of host, so that the next dial tries it
+// right away.
+func (b *Breakers) ResetBreaker(ctx context.Context, host string) error {
+	b.mu.Lock()
+	_, ok := b.circuits[host]
+	delete(b.circuits, host)
+	b.mu.Unlock()
+
+	if !ok {
+		return batproxy.Errorf(batproxy.ENOTFOUND, "no open circuit for %s", host)
+	}
+
+	b.Logger.Info("breaker",
+		"status", "reset",
+		"host", host,
+	)
+	return nil
+}
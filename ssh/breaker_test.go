@@ -0,0 +1,144 @@
+package ssh
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/batx-dev/batproxy"
+	"github.com/batx-dev/batproxy/internal/sshtest"
+)
+
+func newBreakerClient(host string, password string, breakers *Breakers) *Client {
+	return &Client{
+		User:           "user1",
+		Host:           host,
+		Password:       password,
+		Breakers:       breakers,
+		ConnectTimeout: 20 * time.Millisecond,
+		RetryMin:       50 * time.Millisecond,
+		RetryMax:       100 * time.Millisecond,
+		Logger:         testLogger,
+	}
+}
+
+// closedAddr returns an address nothing listens on.
+func closedAddr(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func TestBreakerUnreachable(t *testing.T) {
+	breakers := NewBreakers(testLogger)
+	host := closedAddr(t)
+	ctx := context.Background()
+
+	dial := func() error {
+		s := New(testLogger, newBreakerClient(host, sshtest.Password, breakers))
+		defer s.Close()
+		_, err := s.DialContext(ctx, "tcp", "127.0.0.1:1")
+		return err
+	}
+
+	if err := dial(); batproxy.ErrorCode(err) == batproxy.ECIRCUITOPEN {
+		t.Fatalf("first dial: err = %v, want a dial failure", err)
+	}
+	if err := dial(); batproxy.ErrorCode(err) != batproxy.ECIRCUITOPEN {
+		t.Fatalf("dial with the circuit open: err = %v, want %s", err, batproxy.ECIRCUITOPEN)
+	}
+
+	page, _ := breakers.ListBreakers(ctx)
+	if len(page.Breakers) != 1 || page.Breakers[0].State != batproxy.BreakerOpen || page.Breakers[0].Failures != 1 {
+		t.Fatalf("breakers = %+v, want %s open after 1 failure", page.Breakers, host)
+	}
+
+	// the retry fails again, and doubles the delay
+	time.Sleep(60 * time.Millisecond)
+	if err := dial(); batproxy.ErrorCode(err) == batproxy.ECIRCUITOPEN {
+		t.Fatalf("retry: err = %v, want a dial failure", err)
+	}
+	page, _ = breakers.ListBreakers(ctx)
+	if b := page.Breakers[0]; b.Failures != 2 || b.NextRetryTime.Sub(b.OpenTime) != 100*time.Millisecond {
+		t.Errorf("breaker = %+v, want 2 failures and a 100ms delay", b)
+	}
+
+	if err := breakers.ResetBreaker(ctx, host); err != nil {
+		t.Fatal(err)
+	}
+	if err := dial(); batproxy.ErrorCode(err) == batproxy.ECIRCUITOPEN {
+		t.Errorf("dial after reset: err = %v, want a dial failure", err)
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	breakers := NewBreakers(testLogger)
+	client := newBreakerClient("login1:22", "", nil)
+
+	breakers.failure("login1:22", client, net.ErrClosed)
+	if err := breakers.allow("login1:22"); batproxy.ErrorCode(err) != batproxy.ECIRCUITOPEN {
+		t.Fatalf("allow before the retry: err = %v, want %s", err, batproxy.ECIRCUITOPEN)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := breakers.allow("login1:22"); err != nil {
+		t.Fatalf("allow the trial: %v", err)
+	}
+	if err := breakers.allow("login1:22"); batproxy.ErrorCode(err) != batproxy.ECIRCUITOPEN {
+		t.Fatalf("allow during the trial: err = %v, want %s", err, batproxy.ECIRCUITOPEN)
+	}
+
+	breakers.success("login1:22")
+	if err := breakers.allow("login1:22"); err != nil {
+		t.Errorf("allow once closed: %v", err)
+	}
+}
+
+func TestBreakerAuthFailure(t *testing.T) {
+	breakers := NewBreakers(testLogger)
+	srv := sshtest.NewServer(t, nil)
+
+	s := New(testLogger, newBreakerClient(srv.Addr, "wrong", breakers))
+	defer s.Close()
+
+	_, err := s.DialContext(context.Background(), "tcp", "127.0.0.1:1")
+	if code := batproxy.ErrorCode(err); code != batproxy.ESSHAUTH {
+		t.Fatalf("err = %v, want %s", err, batproxy.ESSHAUTH)
+	}
+
+	page, _ := breakers.ListBreakers(context.Background())
+	if len(page.Breakers) != 0 {
+		t.Errorf("breakers = %+v, want none, the host answered", page.Breakers)
+	}
+}
+
+func TestBreakerPanic(t *testing.T) {
+	breakers := NewBreakers(testLogger)
+	host := closedAddr(t)
+	client := newBreakerClient(host, sshtest.Password, breakers)
+
+	breakers.failure(host, client, net.ErrClosed)
+	time.Sleep(60 * time.Millisecond)
+
+	// the trial panics logging its failure
+	client.Logger = nil
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatal("dial did not panic")
+			}
+		}()
+		_, _ = dialFunc(client)(context.Background(), key{User: client.User, Host: host}, func() {})
+	}()
+
+	if err := breakers.allow(host); err != nil {
+		t.Errorf("allow after a panicking trial: %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+
+	"github.com/batx-dev/batproxy"
+	"golang.org/x/crypto/ssh"
+)
+
+// DefaultCertificateValidity is the validity of the certificates signed by a
+// CertificateAuthority without one.
+const DefaultCertificateValidity = time.Hour
+
+// CertificateAuthority signs short-lived OpenSSH user certificates.
+type CertificateAuthority struct {
+	// Signer The CA private key.
+	Signer ssh.Signer
+
+	// Validity How long signed certificates are valid.
+	Validity time.Duration
+}
+
+// Sign returns a certificate of key for user, valid from now.
+func (ca *CertificateAuthority) Sign(user string, key ssh.PublicKey) (*ssh.Certificate, error) {
+	validity := ca.Validity
+	if validity <= 0 {
+		validity = DefaultCertificateValidity
+	}
+
+	var serial [8]byte
+	if _, err := rand.Read(serial[:]); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	cert := &ssh.Certificate{
+		Key:             key,
+		Serial:          binary.BigEndian.Uint64(serial[:]),
+		CertType:        ssh.UserCert,
+		KeyId:           "batproxy:" + user,
+		ValidPrincipals: []string{user},
+		// tolerate clock skew with the ssh server
+		ValidAfter:  uint64(now.Add(-time.Minute).Unix()),
+		ValidBefore: uint64(now.Add(validity).Unix()),
+		Permissions: ssh.Permissions{
+			Extensions: map[string]string{
+				"permit-port-forwarding": "",
+				"permit-pty":             "",
+			},
+		},
+	}
+
+	if err := cert.SignCert(rand.Reader, ca.Signer); err != nil {
+		return nil, err
+	}
+
+	return cert, nil
+}
+
+// certSigner returns the signer of the certificate to authenticate with, or
+// nil if there is none. signer is the private key of the certificate, if nil
+// a key is generated for the signed certificates.
+func (c *Client) certSigner(signer ssh.Signer) (ssh.Signer, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	if c.Certificate != "" && !c.SignCertificate {
+		pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(c.Certificate))
+		if err != nil {
+			return nil, batproxy.Errorf(batproxy.EINVALID, "parse certificate: %v", err)
+		}
+		cert, ok := pub.(*ssh.Certificate)
+		if !ok {
+			return nil, batproxy.Errorf(batproxy.EINVALID, "parse certificate: %s is not a certificate", pub.Type())
+		}
+		if signer == nil {
+			return nil, batproxy.Errorf(batproxy.EINVALID, "certificate requires its private key")
+		}
+		if cert.ValidBefore != ssh.CertTimeInfinity && now.Unix() >= int64(cert.ValidBefore) {
+			c.Logger.Error("certificate",
+				"status", "expired",
+				"client", c,
+				"serial", cert.Serial,
+			)
+		}
+		cs, err := ssh.NewCertSigner(cert, signer)
+		if err != nil {
+			return nil, batproxy.Errorf(batproxy.EINVALID, "certificate: %v", err)
+		}
+		return cs, nil
+	}
+
+	if !c.SignCertificate {
+		return nil, nil
+	}
+
+	if c.CA == nil {
+		return nil, batproxy.Errorf(batproxy.EINVALID, "ssh certificate authority is not configured")
+	}
+
+	if c.cert != nil && now.Before(c.certRenew) {
+		return ssh.NewCertSigner(c.cert, c.certKey)
+	}
+
+	if signer == nil {
+		if c.certKey == nil {
+			_, priv, err := ed25519.GenerateKey(rand.Reader)
+			if err != nil {
+				return nil, err
+			}
+			if c.certKey, err = ssh.NewSignerFromKey(priv); err != nil {
+				return nil, err
+			}
+		}
+		signer = c.certKey
+	}
+
+	cert, err := c.CA.Sign(c.User, signer.PublicKey())
+	if err != nil {
+		return nil, batproxy.Errorf(batproxy.EINTERNAL, "sign certificate: %v", err)
+	}
+	c.cert, c.certKey = cert, signer
+
+	// Re-issue the certificate once its last fifth of validity starts, so
+	// it does not expire while authenticating.
+	c.certRenew = now.Add(time.Unix(int64(cert.ValidBefore), 0).Sub(now) * 4 / 5)
+
+	c.Logger.Info("certificate",
+		"status", "signed",
+		"client", c,
+		"serial", cert.Serial,
+		"valid_before", time.Unix(int64(cert.ValidBefore), 0),
+	)
+
+	return ssh.NewCertSigner(cert, signer)
+}
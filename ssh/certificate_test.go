@@ -0,0 +1,141 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/batx-dev/batproxy/internal/sshtest"
+	"golang.org/x/crypto/ssh"
+)
+
+// newCA returns a certificate authority of a generated key.
+func newCA(t *testing.T, validity time.Duration) *CertificateAuthority {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &CertificateAuthority{Signer: signer, Validity: validity}
+}
+
+// signedCert returns the certificate of the signer of c.
+func signedCert(t *testing.T, c *Client) *ssh.Certificate {
+	t.Helper()
+
+	signer, err := c.certSigner(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, ok := signer.PublicKey().(*ssh.Certificate)
+	if !ok {
+		t.Fatalf("signer key %s is not a certificate", signer.PublicKey().Type())
+	}
+	return cert
+}
+
+func TestCertificateAuthoritySign(t *testing.T) {
+	ca := newCA(t, 0)
+	key := newHostKey(t)
+
+	cert, err := ca.Sign("user1", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.CertType != ssh.UserCert || len(cert.ValidPrincipals) != 1 || cert.ValidPrincipals[0] != "user1" {
+		t.Errorf("certificate = %d for %v, want a user certificate of user1", cert.CertType, cert.ValidPrincipals)
+	}
+	if !bytes.Equal(cert.Key.Marshal(), key.Marshal()) {
+		t.Error("certificate of another key")
+	}
+	validity := time.Unix(int64(cert.ValidBefore), 0).Sub(time.Now())
+	if validity <= DefaultCertificateValidity-time.Minute || validity > DefaultCertificateValidity {
+		t.Errorf("certificate valid for %s, want %s", validity, DefaultCertificateValidity)
+	}
+
+	checker := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return bytes.Equal(auth.Marshal(), ca.Signer.PublicKey().Marshal())
+		},
+	}
+	if err := checker.CheckCert("user1", cert); err != nil {
+		t.Errorf("check certificate: %v", err)
+	}
+}
+
+func TestCertSignerRenew(t *testing.T) {
+	c := &Client{User: "user1", SignCertificate: true, CA: newCA(t, time.Hour), Logger: testLogger}
+
+	first := signedCert(t, c)
+	if renew := time.Until(c.certRenew); renew < 47*time.Minute || renew > 48*time.Minute {
+		t.Errorf("renewal in %s, want 4/5 of the validity", renew)
+	}
+	if again := signedCert(t, c); again.Serial != first.Serial {
+		t.Errorf("certificate signed again before its renewal")
+	}
+
+	// the last fifth of validity started
+	c.certRenew = time.Now().Add(-time.Second)
+	renewed := signedCert(t, c)
+	if renewed.Serial == first.Serial {
+		t.Error("nearly expired certificate not signed again")
+	}
+	if !bytes.Equal(renewed.Key.Marshal(), first.Key.Marshal()) {
+		t.Error("generated key changed with the renewal")
+	}
+
+	// expired, e.g. after a suspend
+	c.cert.ValidBefore = uint64(time.Now().Add(-time.Minute).Unix())
+	c.certRenew = time.Now().Add(-time.Hour)
+	if expired := signedCert(t, c); expired.Serial == renewed.Serial {
+		t.Error("expired certificate not signed again")
+	}
+}
+
+func TestCertificateLogin(t *testing.T) {
+	ca := newCA(t, time.Hour)
+	checker := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			return bytes.Equal(auth.Marshal(), ca.Signer.PublicKey().Marshal())
+		},
+	}
+	srv := sshtest.NewServer(t, func(cfg *ssh.ServerConfig) {
+		cfg.PasswordCallback = nil
+		cfg.PublicKeyCallback = checker.Authenticate
+	})
+	echoAddr := echoServer(t)
+
+	s := New(testLogger, &Client{
+		User:            "user1",
+		Host:            srv.Addr,
+		SignCertificate: true,
+		CA:              ca,
+		Logger:          testLogger,
+	})
+	defer s.Close()
+
+	if got, err := echo(t, s, echoAddr, "hello"); err != nil || got != "hello" {
+		t.Errorf("echo with a signed certificate = %q, %v", got, err)
+	}
+
+	// another authority is rejected
+	other := New(testLogger, &Client{
+		User:            "user1",
+		Host:            srv.Addr,
+		SignCertificate: true,
+		CA:              newCA(t, time.Hour),
+		Logger:          testLogger,
+	})
+	defer other.Close()
+
+	if _, err := echo(t, other, echoAddr, "hello"); err == nil {
+		t.Error("certificate of another authority accepted")
+	}
+}
@@ -3,12 +3,20 @@ package ssh
 import (
 	"context"
 	"fmt"
+	"net"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/exp/slog"
 )
 
+// Defaults of the connection settings of a Client.
+const (
+	DefaultConnectTimeout      = 30 * time.Second
+	DefaultServerAliveInterval = 15 * time.Second
+)
+
 type Client struct {
 	// User Authenticate as.
 	User string `yaml:"user"`
@@ -25,12 +33,68 @@ type Client struct {
 	// Passphrase Private key passphrase.
 	Passphrase string `yaml:"passphrase,omitempty"`
 
+	// Certificate OpenSSH certificate of PrivateKey, used for SSH
+	// authentication.
+	Certificate string `yaml:"certificate,omitempty"`
+
+	// SignCertificate Used for SSH authentication with a certificate signed
+	// by CA, for PrivateKey or a generated key. It is re-issued before it
+	// expires.
+	SignCertificate bool `yaml:"sign_certificate,omitempty"`
+
+	// CA Signs the certificates of the server.
+	CA *CertificateAuthority `yaml:"-"`
+
+	// TOTPSecret Base32 seed of the one-time codes answering
+	// keyboard-interactive prompts.
+	TOTPSecret string `yaml:"totp_secret,omitempty"`
+
+	// PromptRules Answer the keyboard-interactive prompts before
+	// DefaultPromptRules.
+	PromptRules []*PromptRule `yaml:"-"`
+
+	// UseAgent Used for SSH authentication with the keys of Agent.
+	UseAgent bool `yaml:"use_agent,omitempty"`
+
+	// AgentKeyFilter Comment or SHA256 fingerprint of the agent keys to use,
+	// all of them if empty.
+	AgentKeyFilter string `yaml:"agent_key_filter,omitempty"`
+
+	// Agent The ssh-agent of the server.
+	Agent *Agent `yaml:"-"`
+
+	// HostKeyFingerprint Pinned SHA256 fingerprint of the server's host key.
+	HostKeyFingerprint string `yaml:"host_key_fingerprint,omitempty"`
+
+	// HostKeys Verifies the server's host key when no fingerprint is pinned.
+	// If nil, any host key is accepted.
+	HostKeys *HostKeys `yaml:"-"`
+
+	// Breakers Fail the dials fast while Host cannot be reached.
+	// If nil, every dial tries Host.
+	Breakers *Breakers `yaml:"-"`
+
+	// Connections Tracks the live ssh connections.
+	// If nil, they are not tracked.
+	Connections *Connections `yaml:"-"`
+
+	// Upstream URL of the SOCKS5 or HTTP CONNECT proxy to reach Host
+	// through, see batproxy.ParseUpstream. Unused with Jump.
+	Upstream string `yaml:"upstream,omitempty"`
+
+	// Jump Dials Host through this ssh connection instead of directly.
+	Jump *Ssh `yaml:"-"`
+
 	// LogLevel Level of logging print.
 	LogLevel int8 `yaml:"log_level,omitempty"`
 
 	// LogEncoding Log output format.
 	LogEncoding string `yaml:"log_encoding"`
 
+	// ConnectTimeout Maximum time to connect to the ssh server, retries
+	// included.
+	ConnectTimeout time.Duration `yaml:"connect_timeout,omitempty"`
+
 	// RetryMin Minimum time to retry connecting to the ssh server
 	RetryMin time.Duration `yaml:"retry_min,omitempty"`
 
@@ -41,10 +105,30 @@ type Client struct {
 	ServerAliveInterval time.Duration `yaml:"server_alive_interval"`
 
 	// ServerAliveCountMax Maximum number of keepalive packets to send
+	// without answer before closing the connection
 	ServerAliveCountMax uint32 `yaml:"server_alive_count_max"`
 
+	// Forward How streams reach their destination, one of ForwardDirect,
+	// ForwardStdio or ForwardAuto. Empty means ForwardDirect.
+	Forward string `yaml:"forward,omitempty"`
+
+	// RelayCommand Command relaying the streams of ForwardStdio, %h is
+	// replaced by the host and %p by the port. Empty means
+	// DefaultRelayCommand.
+	RelayCommand string `yaml:"relay_command,omitempty"`
+
+	// RelayUnixCommand Command relaying the unix domain socket streams of
+	// ForwardStdio, %h is replaced by the path of the socket. Empty means
+	// DefaultRelayUnixCommand.
+	RelayUnixCommand string `yaml:"relay_unix_command,omitempty"`
+
 	// Logger Used for logging
 	Logger *slog.Logger
+
+	mu        sync.Mutex       // guards cert, certKey and certRenew
+	cert      *ssh.Certificate // last signed certificate
+	certKey   ssh.Signer       // private key of cert
+	certRenew time.Time        // time to sign the next certificate
 }
 
 func (c *Client) String() string {
@@ -52,8 +136,12 @@ func (c *Client) String() string {
 }
 
 func (c *Client) Validate() error {
-	if c.PrivateKey == "" && c.Password == "" {
-		return fmt.Errorf("one of [password, private_key] required")
+	if c.PrivateKey == "" && c.Password == "" && c.TOTPSecret == "" && !c.UseAgent && !c.SignCertificate {
+		return fmt.Errorf("one of [password, totp_secret, private_key, agent, sign_certificate] required")
+	}
+
+	if c.ConnectTimeout <= 0 {
+		c.ConnectTimeout = DefaultConnectTimeout
 	}
 
 	if c.RetryMin <= 0 {
@@ -64,28 +152,82 @@ func (c *Client) Validate() error {
 		c.RetryMax = time.Minute
 	}
 
+	if c.RetryMin > c.RetryMax {
+		c.RetryMin = c.RetryMax
+	}
+
 	if c.ServerAliveInterval <= 0 {
-		c.ServerAliveInterval = 0
+		c.ServerAliveInterval = DefaultServerAliveInterval
 	}
 
-	if c.ServerAliveCountMax <= 1 {
+	if c.ServerAliveCountMax < 1 {
 		c.ServerAliveCountMax = 3
 	}
 
 	return nil
 }
 
-func (c *Client) keepAlive(ctx context.Context, conn ssh.Conn, interval time.Duration) {
-	t := time.NewTicker(interval)
+func (c *Client) hostKeyCallback(ctx context.Context) ssh.HostKeyCallback {
+	h := c.HostKeys
+	if h == nil {
+		// only the pinned fingerprint is checked
+		h = &HostKeys{Logger: c.Logger}
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		return h.Verify(ctx, hostname, remote, key, c.HostKeyFingerprint)
+	}
+}
+
+// via returns the jump hosts of the client, the closest first.
+func (c *Client) via() string {
+	if c.Jump == nil {
+		return ""
+	}
+	if via := c.Jump.Client.via(); via != "" {
+		return c.Jump.Client.String() + " via " + via
+	}
+	return c.Jump.Client.String()
+}
+
+// keepAlive sends a keepalive request every ServerAliveInterval, and closes
+// conn once ServerAliveCountMax of them are left without answer.
+func (c *Client) keepAlive(ctx context.Context, conn *clientConn) {
+	t := time.NewTicker(c.ServerAliveInterval)
 	defer t.Stop()
+
+	replies := make(chan error, 1)
+	pending := false
+	var missed uint32
 	for {
 		select {
 		case <-t.C:
-			_, _, err := conn.SendRequest("keepalive@batproxy.dev", true, nil)
+			if pending {
+				missed++
+				c.Logger.Warn("keepalive",
+					"status", "missed",
+					"client", c,
+					"missed", missed,
+				)
+				if missed >= c.ServerAliveCountMax {
+					c.Logger.Error("keepalive", "status", "timeout", "client", c)
+					_ = conn.Close()
+					return
+				}
+				continue
+			}
+			pending = true
+			go func() {
+				_, _, err := conn.SendRequest("keepalive@batproxy.dev", true, nil)
+				replies <- err
+			}()
+		case err := <-replies:
 			if err != nil {
-				c.Logger.Error("keepalive", "err", err)
+				c.Logger.Error("keepalive", "client", c, "err", err)
 				return
 			}
+			pending, missed = false, 0
+			conn.lastKeepalive.Store(time.Now().UnixNano())
 			c.Logger.Debug("keepalive",
 				"client", c,
 			)
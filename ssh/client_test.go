@@ -0,0 +1,176 @@
+package ssh
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/batx-dev/batproxy"
+	"github.com/batx-dev/batproxy/internal/sshtest"
+	"golang.org/x/crypto/ssh"
+)
+
+// rawConn returns an ssh connection to srv without read deadlines, so that
+// only the keepalives close it.
+func rawConn(t *testing.T, srv *sshtest.Server) *clientConn {
+	t.Helper()
+
+	sc, err := ssh.Dial("tcp", srv.Addr, &ssh.ClientConfig{
+		User:            "user1",
+		Auth:            []ssh.AuthMethod{ssh.Password(sshtest.Password)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sc.Close() })
+	return &clientConn{Client: sc}
+}
+
+func TestKeepAlive(t *testing.T) {
+	srv := sshtest.NewServer(t, nil)
+	conn := rawConn(t, srv)
+	c := &Client{ServerAliveInterval: 10 * time.Millisecond, ServerAliveCountMax: 3, Logger: testLogger}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	exited := make(chan struct{})
+	go func() {
+		c.keepAlive(ctx, conn)
+		close(exited)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	if conn.lastKeepalive.Load() == 0 {
+		t.Error("no keepalive answered")
+	}
+	cancel()
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Fatal("keepalive running after its context is done")
+	}
+	if _, _, err := conn.SendRequest("ping", true, nil); err != nil {
+		t.Errorf("connection closed by answered keepalives: %v", err)
+	}
+}
+
+func TestKeepAliveMissed(t *testing.T) {
+	srv := sshtest.NewServer(t, nil)
+	srv.SetReplies(false)
+	conn := rawConn(t, srv)
+	c := &Client{ServerAliveInterval: 10 * time.Millisecond, ServerAliveCountMax: 3, Logger: testLogger}
+
+	start := time.Now()
+	exited := make(chan struct{})
+	go func() {
+		c.keepAlive(context.Background(), conn)
+		close(exited)
+	}()
+
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Fatal("connection of a hung server kept open")
+	}
+	// one interval to send, then one per missed answer
+	if d := time.Since(start); d < 4*c.ServerAliveInterval {
+		t.Errorf("closed after %s, want %d missed keepalives", d, c.ServerAliveCountMax)
+	}
+	if err := conn.Wait(); err == nil {
+		t.Error("connection not closed")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	c := &Client{RetryMin: time.Second, RetryMax: 5 * time.Second}
+
+	var delay time.Duration
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if delay = c.getCurrentTempDelay(delay); delay != want {
+			t.Errorf("delay = %s, want %s", delay, want)
+		}
+	}
+}
+
+func TestDialRetry(t *testing.T) {
+	srv := sshtest.NewServer(t, nil)
+	echoAddr := echoServer(t)
+
+	// a port refusing connections until the server comes up on it
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	time.AfterFunc(150*time.Millisecond, func() {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Errorf("listen again: %v", err)
+			return
+		}
+		t.Cleanup(func() { l.Close() })
+		go func() {
+			for {
+				c, err := l.Accept()
+				if err != nil {
+					return
+				}
+				up, err := net.Dial("tcp", srv.Addr)
+				if err != nil {
+					c.Close()
+					continue
+				}
+				go func() { io.Copy(up, c); up.Close() }()
+				go func() { io.Copy(c, up); c.Close() }()
+			}
+		}()
+	})
+
+	s := New(testLogger, &Client{
+		User:           "user1",
+		Host:           addr,
+		Password:       sshtest.Password,
+		ConnectTimeout: 5 * time.Second,
+		RetryMin:       20 * time.Millisecond,
+		RetryMax:       40 * time.Millisecond,
+		Logger:         testLogger,
+	})
+	defer s.Close()
+
+	if got, err := echo(t, s, echoAddr, "hello"); err != nil || got != "hello" {
+		t.Errorf("echo once the server is up = %q, %v", got, err)
+	}
+}
+
+func TestDialRetryTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	s := New(testLogger, &Client{
+		User:           "user1",
+		Host:           addr,
+		Password:       sshtest.Password,
+		ConnectTimeout: 200 * time.Millisecond,
+		RetryMin:       20 * time.Millisecond,
+		RetryMax:       40 * time.Millisecond,
+		Logger:         testLogger,
+	})
+	defer s.Close()
+
+	start := time.Now()
+	_, err = s.DialContext(context.Background(), "tcp", "127.0.0.1:80")
+	if batproxy.ErrorCode(err) != batproxy.EINTERNAL {
+		t.Errorf("dial = %v, want %s", err, batproxy.EINTERNAL)
+	}
+	if d := time.Since(start); d < 150*time.Millisecond || d > time.Second {
+		t.Errorf("gave up after %s, want retries until the connect timeout", d)
+	}
+}
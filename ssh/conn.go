@@ -37,14 +37,10 @@ func (c *Conn) Write(b []byte) (int, error) {
 	return c.Conn.Write(b)
 }
 
-func DialTimeout(network, addr string, config *ssh.ClientConfig, timeout time.Duration) (*ssh.Client, error) {
-	conn, err := net.DialTimeout(network, addr, timeout)
-	if err != nil {
-		return nil, err
-	}
-
-	timeoutConn := &Conn{conn, timeout, timeout}
-	c, chans, reqs, err := ssh.NewClientConn(timeoutConn, addr, config)
+// NewClient establishes an ssh connection over conn, which may be a channel
+// of another ssh connection.
+func NewClient(conn net.Conn, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
 	if err != nil {
 		return nil, err
 	}
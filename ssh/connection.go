@@ -0,0 +1,146 @@
+package ssh
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/batx-dev/batproxy"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/exp/slog"
+)
+
+// clientConn is an established ssh connection with its statistics.
+type clientConn struct {
+	*ssh.Client
+
+	id         string
+	key        key
+	via        string
+	createTime time.Time
+	meter      *meteredConn
+
+	channels      atomic.Int64
+	lastKeepalive atomic.Int64 // unix nano
+}
+
+func (c *clientConn) connection(now time.Time) *batproxy.Connection {
+	conn := &batproxy.Connection{
+		ID:           c.id,
+		User:         c.key.User,
+		Host:         c.key.Host,
+		Via:          c.via,
+		Slot:         c.key.Slot,
+		Age:          int64(now.Sub(c.createTime) / time.Second),
+		Channels:     c.channels.Load(),
+		BytesRead:    c.meter.read.Load(),
+		BytesWritten: c.meter.written.Load(),
+		CreateTime:   c.createTime,
+	}
+	if t := c.lastKeepalive.Load(); t > 0 {
+		conn.LastKeepaliveTime = time.Unix(0, t)
+	}
+	return conn
+}
+
+// Connections tracks the live ssh connections of the clients sharing it.
+type Connections struct {
+	Logger *slog.Logger
+
+	mu      sync.Mutex // guards clients
+	clients map[string]*clientConn
+}
+
+func NewConnections(logger *slog.Logger) *Connections {
+	return &Connections{
+		Logger:  logger,
+		clients: make(map[string]*clientConn),
+	}
+}
+
+var _ batproxy.ConnectionService = (*Connections)(nil)
+
+func (cs *Connections) add(c *clientConn) {
+	if cs == nil {
+		return
+	}
+
+	cs.mu.Lock()
+	cs.clients[c.id] = c
+	cs.mu.Unlock()
+}
+
+func (cs *Connections) remove(c *clientConn) {
+	if cs == nil {
+		return
+	}
+
+	cs.mu.Lock()
+	delete(cs.clients, c.id)
+	cs.mu.Unlock()
+}
+
+func (cs *Connections) ListConnections(ctx context.Context) (*batproxy.ListConnectionsPage, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	now := time.Now()
+	conns := make([]*batproxy.Connection, 0, len(cs.clients))
+	for _, c := range cs.clients {
+		conns = append(conns, c.connection(now))
+	}
+	sort.Slice(conns, func(i, j int) bool { return conns[i].CreateTime.Before(conns[j].CreateTime) })
+
+	return &batproxy.ListConnectionsPage{Connections: conns}, nil
+}
+
+func (cs *Connections) CloseConnection(ctx context.Context, id string) error {
+	cs.mu.Lock()
+	c := cs.clients[id]
+	cs.mu.Unlock()
+
+	if c == nil {
+		return batproxy.Errorf(batproxy.ENOTFOUND, "connection '%s' not found", id)
+	}
+
+	cs.Logger.Info("connection",
+		"status", "close",
+		"id", id,
+		"key", c.key.String(),
+	)
+
+	// Waiting for the connection forgets it.
+	return c.Close()
+}
+
+// newConnectionID returns a random connection id.
+func newConnectionID() string {
+	var buf [8]byte
+	_, _ = rand.Read(buf[:])
+	return hex.EncodeToString(buf[:])
+}
+
+// meteredConn counts the bytes read and written through it.
+type meteredConn struct {
+	net.Conn
+
+	read    atomic.Uint64
+	written atomic.Uint64
+}
+
+func (c *meteredConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.read.Add(uint64(n))
+	return n, err
+}
+
+func (c *meteredConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.written.Add(uint64(n))
+	return n, err
+}
@@ -2,6 +2,8 @@ package ssh
 
 import (
 	"context"
+	"errors"
+	"net"
 	"time"
 
 	"github.com/batx-dev/batproxy"
@@ -9,73 +11,193 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
-func dialFunc(c *Client) memo.Func[key, *ssh.Client] {
-	return func(ctx context.Context, key key, cleanup func()) (*ssh.Client, error) {
+func dialFunc(c *Client) memo.Func[key, *clientConn] {
+	return func(ctx context.Context, key key, cleanup func()) (*clientConn, error) {
 		if err := c.Validate(); err != nil {
 			return nil, batproxy.Errorf(batproxy.EINVALID, "ssh client config: %s", err)
 		}
 
-		var auth []ssh.AuthMethod
+		// The handshake error does not wrap the host key and challenge errors,
+		// keep them aside.
+		var hostKeyErr, challengeErr error
+		// The host presented its key, the handshake reached the host.
+		var reached bool
 
-		if c.PrivateKey != "" {
-			var (
-				err    error
-				signer ssh.Signer
+		if err := c.Breakers.allow(c.Host); err != nil {
+			c.Logger.Warn("dial",
+				"status", "circuit open",
+				"key", key.String(),
+				"err", err,
 			)
-			if c.Passphrase != "" {
-				signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(c.PrivateKey), []byte(c.Passphrase))
-			} else {
-				signer, err = ssh.ParsePrivateKey([]byte(c.PrivateKey))
-			}
-			if err != nil {
-				return nil, batproxy.Errorf(batproxy.EINVALID, "parse private key: %v", err)
-			} else {
-				auth = append(auth, ssh.PublicKeys(signer))
-			}
+			return nil, err
 		}
-		if c.Password != "" {
-			auth = append(auth, ssh.Password(c.Password))
+		// a panicking dial must not keep the host on trial forever
+		defer func() {
+			if r := recover(); r != nil {
+				c.Breakers.abort(c.Host)
+				panic(r)
+			}
+		}()
+
+		auth, done, err := c.authMethods(&challengeErr)
+		if err != nil {
+			c.Breakers.abort(c.Host)
+			return nil, err
 		}
+		defer done()
+
+		hostKeyCallback := c.hostKeyCallback(ctx)
 
 		cfg := &ssh.ClientConfig{
-			User:            c.User,
-			Auth:            auth,
-			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-			Timeout:         time.Second * 30,
+			User: c.User,
+			Auth: auth,
+			HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+				reached = true
+				hostKeyErr = hostKeyCallback(hostname, remote, key)
+				return hostKeyErr
+			},
 		}
 
 		// establish connect with remote host
-		client, err := DialTimeout("tcp",
-			c.Host,
-			cfg,
-			c.ServerAliveInterval*time.Duration(c.ServerAliveCountMax),
-		)
+		meter := &meteredConn{}
+		sc, err := c.dial(ctx, cfg, meter)
 		if err != nil {
 			c.Logger.Error("dial",
 				"status", "fail",
 				"key", key.String(),
 				"err", err,
 			)
-			go func() {
-				time.Sleep(15 * time.Second)
-				cleanup()
-				c.Logger.Error("cleanup ssh cache", "key", key.String(), "err", err)
-			}()
+			// Only the failures to reach the host trip its circuit, the
+			// rejected handshakes come from a live host.
+			var e *batproxy.Error
+			switch {
+			case hostKeyErr != nil:
+				c.Breakers.success(c.Host)
+				return nil, hostKeyErr
+			case challengeErr != nil:
+				c.Breakers.success(c.Host)
+				return nil, challengeErr
+			case errors.As(err, &e):
+				// failed to reach the jump host, which has its own circuit
+				c.Breakers.abort(c.Host)
+				return nil, err
+			case reached:
+				// the host key was accepted, the host rejected the
+				// authentication
+				c.Breakers.success(c.Host)
+				return nil, batproxy.Errorf(batproxy.ESSHAUTH, "authenticate to %s: %v", key.String(), err)
+			}
+			c.Breakers.failure(c.Host, c, err)
 			return nil, batproxy.Errorf(batproxy.EINTERNAL, "dial to %s", key.String())
 		}
+		c.Breakers.success(c.Host)
 
-		c.Logger.Info("wait ssh to close", "key", key.String())
+		client := &clientConn{
+			Client:     sc,
+			id:         newConnectionID(),
+			key:        key,
+			via:        c.via(),
+			createTime: time.Now(),
+			meter:      meter,
+		}
+		c.Connections.add(client)
+
+		c.Logger.Info("wait ssh to close", "key", key.String(), "id", client.id)
 
 		kCtx, cancel := context.WithCancel(context.Background())
-		go c.keepAlive(kCtx, client, time.Second*15)
+		go c.keepAlive(kCtx, client)
 
 		go func() {
 			err := client.Wait()
 			cleanup()
 			cancel()
-			c.Logger.Error("wait ssh to close and cleanup", "key", key.String(), "err", err)
+			c.Connections.remove(client)
+			c.Logger.Error("wait ssh to close and cleanup", "key", key.String(), "id", client.id, "err", err)
 		}()
 
 		return client, nil
 	}
 }
+
+// dial establishes the ssh connection over meter, retrying the failures to
+// reach the server with growing delays until ConnectTimeout.
+func (c *Client) dial(ctx context.Context, cfg *ssh.ClientConfig, meter *meteredConn) (*ssh.Client, error) {
+	deadline := time.Now().Add(c.ConnectTimeout)
+
+	var tempDelay time.Duration
+	for {
+		cfg.Timeout = time.Until(deadline)
+
+		var (
+			conn net.Conn
+			err  error
+		)
+		switch {
+		case c.Jump != nil:
+			// through a channel of the jump host
+			conn, err = c.Jump.DialContext(ctx, "tcp", c.Host)
+		case c.Upstream != "":
+			u, perr := batproxy.ParseUpstream(c.Upstream)
+			if perr != nil {
+				return nil, batproxy.Errorf(batproxy.EINVALID, "%v", perr)
+			}
+			conn, err = dialUpstream(ctx, u, c.Host, cfg.Timeout)
+		default:
+			d := net.Dialer{Timeout: cfg.Timeout}
+			conn, err = d.DialContext(ctx, "tcp", c.Host)
+		}
+		if err == nil {
+			if c.Jump == nil {
+				timeout := c.ServerAliveInterval * time.Duration(c.ServerAliveCountMax)
+				conn = &Conn{conn, timeout, timeout}
+			}
+			meter.Conn = conn
+			return c.handshake(ctx, meter, cfg)
+		}
+
+		// only the failures to reach the server are worth retrying, not the
+		// rejected handshakes
+		var opErr *net.OpError
+		if !errors.As(err, &opErr) {
+			return nil, err
+		}
+
+		tempDelay = c.getCurrentTempDelay(tempDelay)
+		if time.Now().Add(tempDelay).After(deadline) {
+			return nil, err
+		}
+
+		c.Logger.Warn("dial",
+			"status", "retry",
+			"client", c,
+			"delay", tempDelay,
+			"err", err,
+		)
+
+		select {
+		case <-time.After(tempDelay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// handshake establishes the ssh connection over conn within cfg.Timeout,
+// unless ctx is done first.
+func (c *Client) handshake(ctx context.Context, conn net.Conn, cfg *ssh.ClientConfig) (*ssh.Client, error) {
+	// channels have no deadlines, bound the handshake instead
+	t := time.AfterFunc(cfg.Timeout, func() { conn.Close() })
+	defer t.Stop()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	return NewClient(conn, c.Host, cfg)
+}
@@ -0,0 +1,129 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/batx-dev/batproxy"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/exp/slog"
+)
+
+// HostKeys verifies the host keys of ssh servers against known_hosts files
+// and a KnownHostService.
+type HostKeys struct {
+	// Policy One of [strict, tofu], defaults to tofu.
+	Policy string
+
+	// Files known_hosts files, trusted before Service and never written.
+	Files []string
+
+	// Service Stores the host keys learnt on first use and the changed ones
+	// waiting for approval.
+	Service batproxy.KnownHostService
+
+	Logger *slog.Logger
+}
+
+// Verify checks key presented by host, with fingerprint pinned by the proxy
+// if not empty. Untrusted keys are reported as EHOSTKEY errors.
+func (h *HostKeys) Verify(ctx context.Context, host string, remote net.Addr, key ssh.PublicKey, fingerprint string) error {
+	presented := ssh.FingerprintSHA256(key)
+
+	if fingerprint != "" {
+		if presented != fingerprint {
+			return h.mismatch(host, key, "does not match pinned %s", fingerprint)
+		}
+		return nil
+	}
+
+	if len(h.Files) > 0 {
+		callback, err := knownhosts.New(h.Files...)
+		if err != nil {
+			return batproxy.Errorf(batproxy.EINTERNAL, "read known hosts: %v", err)
+		}
+
+		var keyErr *knownhosts.KeyError
+		err = callback(host, remote, key)
+		switch {
+		case err == nil:
+			return nil
+		case errors.As(err, &keyErr) && len(keyErr.Want) > 0:
+			return h.mismatch(host, key, "changed from %s", ssh.FingerprintSHA256(keyErr.Want[0].Key))
+		case errors.As(err, &keyErr):
+			// unknown to the files, try the service
+		default:
+			return batproxy.Errorf(batproxy.EINTERNAL, "check known hosts: %v", err)
+		}
+	}
+
+	if h.Service == nil {
+		if h.Policy == batproxy.HostKeyPolicyStrict {
+			return h.mismatch(host, key, "is unknown")
+		}
+		return nil
+	}
+
+	page, err := h.Service.ListKnownHosts(ctx, batproxy.ListKnownHostsOptions{
+		Host:   host,
+		Status: batproxy.KnownHostTrusted,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, known := range page.KnownHosts {
+		if known.Fingerprint == presented {
+			return nil
+		}
+	}
+
+	status := batproxy.KnownHostTrusted
+	if len(page.KnownHosts) > 0 || h.Policy == batproxy.HostKeyPolicyStrict {
+		status = batproxy.KnownHostPending
+	}
+
+	learnt := &batproxy.KnownHost{
+		Host:        host,
+		KeyType:     key.Type(),
+		Fingerprint: presented,
+		PublicKey:   strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))),
+		Status:      status,
+	}
+	if err := h.Service.AddKnownHost(ctx, learnt); err != nil {
+		return err
+	}
+	// a concurrent dial may have recorded the key first
+	status = learnt.Status
+
+	switch {
+	case status == batproxy.KnownHostTrusted:
+		h.Logger.Info("host key",
+			"status", "trust on first use",
+			"host", host,
+			"fingerprint", presented,
+		)
+		return nil
+	case len(page.KnownHosts) > 0:
+		return h.mismatch(host, key, "changed from %s, waiting for approval", page.KnownHosts[0].Fingerprint)
+	default:
+		return h.mismatch(host, key, "is unknown, waiting for approval")
+	}
+}
+
+func (h *HostKeys) mismatch(host string, key ssh.PublicKey, format string, args ...interface{}) error {
+	err := batproxy.Errorf(batproxy.EHOSTKEY, "host key %s of %s "+format,
+		append([]interface{}{ssh.FingerprintSHA256(key), host}, args...)...)
+
+	h.Logger.Error("host key",
+		"status", "mismatch",
+		"host", host,
+		"fingerprint", ssh.FingerprintSHA256(key),
+		"err", err.Message,
+	)
+
+	return err
+}
@@ -0,0 +1,194 @@
+package ssh
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/batx-dev/batproxy"
+	"github.com/batx-dev/batproxy/internal/sshtest"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// memKnownHosts is a KnownHostService keeping the host keys in memory.
+type memKnownHosts struct {
+	mu    sync.Mutex
+	hosts []*batproxy.KnownHost
+}
+
+func (s *memKnownHosts) AddKnownHost(ctx context.Context, host *batproxy.KnownHost) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, h := range s.hosts {
+		if h.Host == host.Host && h.Fingerprint == host.Fingerprint {
+			*host = *h
+			return nil
+		}
+	}
+	cp := *host
+	s.hosts = append(s.hosts, &cp)
+	return nil
+}
+
+func (s *memKnownHosts) ListKnownHosts(ctx context.Context, opts batproxy.ListKnownHostsOptions) (*batproxy.ListKnownHostsPage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	page := &batproxy.ListKnownHostsPage{}
+	for _, h := range s.hosts {
+		if (opts.Host == "" || opts.Host == h.Host) && (opts.Status == "" || opts.Status == h.Status) {
+			cp := *h
+			page.KnownHosts = append(page.KnownHosts, &cp)
+		}
+	}
+	return page, nil
+}
+
+func (s *memKnownHosts) ApproveKnownHost(ctx context.Context, host, fingerprint string) error {
+	return batproxy.Errorf(batproxy.ENOTIMPLEMENTED, "approve known host")
+}
+
+func (s *memKnownHosts) DeleteKnownHost(ctx context.Context, host, fingerprint string) error {
+	return batproxy.Errorf(batproxy.ENOTIMPLEMENTED, "delete known host")
+}
+
+// status returns the status of the key of fingerprint recorded for host.
+func (s *memKnownHosts) status(host, fingerprint string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, h := range s.hosts {
+		if h.Host == host && h.Fingerprint == fingerprint {
+			return h.Status
+		}
+	}
+	return ""
+}
+
+// newHostKey returns a public key no test server presents.
+func newHostKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// writeKnownHosts writes a known_hosts file of key for addr.
+func writeKnownHosts(t *testing.T, addr string, key ssh.PublicKey) string {
+	t.Helper()
+
+	name := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, key) + "\n"
+	if err := os.WriteFile(name, []byte(line), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestHostKeysVerify(t *testing.T) {
+	srv := sshtest.NewServer(t, nil)
+	echoAddr := echoServer(t)
+	presented := ssh.FingerprintSHA256(srv.HostKey.PublicKey())
+	other := newHostKey(t)
+
+	tests := []struct {
+		name        string
+		fingerprint string
+		policy      string
+		files       []string
+		known       []*batproxy.KnownHost
+		code        string
+		status      string // recorded status of the presented key
+	}{
+		{
+			name:        "pinned",
+			fingerprint: presented,
+			policy:      batproxy.HostKeyPolicyStrict,
+		},
+		{
+			name:        "pinned mismatch",
+			fingerprint: ssh.FingerprintSHA256(other),
+			code:        batproxy.EHOSTKEY,
+		},
+		{
+			name:   "known hosts file",
+			policy: batproxy.HostKeyPolicyStrict,
+			files:  []string{writeKnownHosts(t, srv.Addr, srv.HostKey.PublicKey())},
+		},
+		{
+			name:  "known hosts file changed",
+			files: []string{writeKnownHosts(t, srv.Addr, other)},
+			code:  batproxy.EHOSTKEY,
+		},
+		{
+			name:   "first use",
+			status: batproxy.KnownHostTrusted,
+		},
+		{
+			name:   "strict unknown",
+			policy: batproxy.HostKeyPolicyStrict,
+			code:   batproxy.EHOSTKEY,
+			status: batproxy.KnownHostPending,
+		},
+		{
+			name: "trusted",
+			known: []*batproxy.KnownHost{{
+				Host:        srv.Addr,
+				Fingerprint: presented,
+				Status:      batproxy.KnownHostTrusted,
+			}},
+			policy: batproxy.HostKeyPolicyStrict,
+			status: batproxy.KnownHostTrusted,
+		},
+		{
+			name: "changed",
+			known: []*batproxy.KnownHost{{
+				Host:        srv.Addr,
+				Fingerprint: ssh.FingerprintSHA256(other),
+				Status:      batproxy.KnownHostTrusted,
+			}},
+			code:   batproxy.EHOSTKEY,
+			status: batproxy.KnownHostPending,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &memKnownHosts{hosts: tt.known}
+			s := New(testLogger, &Client{
+				User:               "user1",
+				Host:               srv.Addr,
+				Password:           sshtest.Password,
+				HostKeyFingerprint: tt.fingerprint,
+				HostKeys: &HostKeys{
+					Policy:  tt.policy,
+					Files:   tt.files,
+					Service: service,
+					Logger:  testLogger,
+				},
+				Logger: testLogger,
+			})
+			defer s.Close()
+
+			_, err := echo(t, s, echoAddr, "hello")
+			if code := batproxy.ErrorCode(err); code != tt.code {
+				t.Fatalf("dial: err = %v, want code %q", err, tt.code)
+			}
+			if got := service.status(srv.Addr, presented); got != tt.status {
+				t.Errorf("recorded status = %q, want %q", got, tt.status)
+			}
+		})
+	}
+}
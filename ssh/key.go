@@ -5,8 +5,14 @@ import "fmt"
 type key struct {
 	User string
 	Host string
+
+	// Slot Index of the connection in the pool of User@Host.
+	Slot int
 }
 
 func (k *key) String() string {
+	if k.Slot > 0 {
+		return fmt.Sprintf("%s@%s#%d", k.User, k.Host, k.Slot)
+	}
 	return fmt.Sprintf("%s@%s", k.User, k.Host)
 }
@@ -0,0 +1,126 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/batx-dev/batproxy"
+)
+
+// Answers of keyboard-interactive prompts.
+const (
+	AnswerPassword = "password"
+	AnswerTOTP     = "totp"
+)
+
+// PromptRule answers the keyboard-interactive prompts of the hosts it
+// matches.
+type PromptRule struct {
+	// Host Glob matched against the ssh host name, without port.
+	// Empty matches every host.
+	Host string
+
+	// Prompt Matched against the prompt text.
+	Prompt *regexp.Regexp
+
+	// Answer One of [password, totp].
+	Answer string
+}
+
+// DefaultPromptRules are tried after the rules of a client. The prompts
+// starting with a code, e.g. "One-time password:", get the code, then the
+// ones mentioning a password, e.g. "Password or token:", get the password,
+// and the ones mentioning a code anywhere else get the code.
+var DefaultPromptRules = []*PromptRule{
+	{Prompt: regexp.MustCompile(`(?i)^\W*(enter\s+)?(the\s+|your\s+)?(verification|one[- ]time|otp|token|passcode|code)`), Answer: AnswerTOTP},
+	{Prompt: regexp.MustCompile(`(?i)password`), Answer: AnswerPassword},
+	{Prompt: regexp.MustCompile(`(?i)(verification|one[- ]time|otp|token|passcode|code)`), Answer: AnswerTOTP},
+}
+
+// ParsePromptRule parses a rule formatted as <host>;<prompt regexp>;<answer>.
+func ParsePromptRule(s string) (*PromptRule, error) {
+	first, last := strings.Index(s, ";"), strings.LastIndex(s, ";")
+	if first < 0 || first == last {
+		return nil, fmt.Errorf("invalid prompt rule %q, expect <host>;<prompt regexp>;<answer>", s)
+	}
+
+	r := &PromptRule{Host: s[:first], Answer: s[last+1:]}
+	if _, err := path.Match(r.Host, ""); err != nil {
+		return nil, fmt.Errorf("invalid prompt rule host %q: %v", r.Host, err)
+	}
+
+	var err error
+	if r.Prompt, err = regexp.Compile(s[first+1 : last]); err != nil {
+		return nil, fmt.Errorf("invalid prompt rule prompt: %v", err)
+	}
+
+	switch r.Answer {
+	case AnswerPassword, AnswerTOTP:
+	default:
+		return nil, fmt.Errorf("invalid prompt rule answer %q, expect one of [password, totp]", r.Answer)
+	}
+
+	return r, nil
+}
+
+// Match reports whether r answers prompt of host.
+func (r *PromptRule) Match(host, prompt string) bool {
+	if r.Host != "" {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if ok, _ := path.Match(r.Host, host); !ok {
+			return false
+		}
+	}
+	return r.Prompt.MatchString(prompt)
+}
+
+// challenge answers the keyboard-interactive questions with the password and
+// the one-time code of the client, according to its prompt rules.
+func (c *Client) challenge(user, instruction string, questions []string, echos []bool) ([]string, error) {
+	rules := append(c.PromptRules[:len(c.PromptRules):len(c.PromptRules)], DefaultPromptRules...)
+
+	answers := make([]string, len(questions))
+	for i, question := range questions {
+		var rule *PromptRule
+		for _, r := range rules {
+			if r.Match(c.Host, question) {
+				rule = r
+				break
+			}
+		}
+		if rule == nil {
+			return nil, batproxy.Errorf(batproxy.ESSHAUTH, "%s: no answer to prompt %q", c, question)
+		}
+
+		switch rule.Answer {
+		case AnswerPassword:
+			if c.Password == "" {
+				return nil, batproxy.Errorf(batproxy.ESSHAUTH, "%s: prompt %q requires password", c, question)
+			}
+			answers[i] = c.Password
+		case AnswerTOTP:
+			if c.TOTPSecret == "" {
+				return nil, batproxy.Errorf(batproxy.ESSHAUTH, "%s: prompt %q requires totp_secret", c, question)
+			}
+			code, err := TOTP(c.TOTPSecret, time.Now())
+			if err != nil {
+				return nil, batproxy.Errorf(batproxy.EINVALID, "%s: %v", c, err)
+			}
+			answers[i] = code
+		}
+
+		c.Logger.Debug("keyboard interactive",
+			"client", c,
+			"prompt", question,
+			"answer", rule.Answer,
+		)
+	}
+
+	return answers, nil
+}
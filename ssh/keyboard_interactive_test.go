@@ -0,0 +1,139 @@
+package ssh
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/batx-dev/batproxy"
+	"github.com/batx-dev/batproxy/internal/sshtest"
+	"golang.org/x/crypto/ssh"
+)
+
+const totpSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestParsePromptRule(t *testing.T) {
+	tests := []struct {
+		rule   string
+		host   string
+		prompt string
+		match  bool
+		err    bool
+	}{
+		{rule: "login*;(?i)^pin:;totp", host: "login1:22", prompt: "PIN:", match: true},
+		{rule: "login*;(?i)^pin:;totp", host: "gpu1:22", prompt: "PIN:"},
+		{rule: ";secret;password", host: "gpu1", prompt: "Your secret:", match: true},
+		{rule: "login*;a;b;password", host: "login1", prompt: "a;b", match: true},
+		{rule: "login*;pin", err: true},
+		{rule: "login*;pin;code", err: true},
+		{rule: "login*;(;totp", err: true},
+		{rule: "[;pin;totp", err: true},
+	}
+	for _, tt := range tests {
+		r, err := ParsePromptRule(tt.rule)
+		if (err != nil) != tt.err {
+			t.Errorf("ParsePromptRule(%q) error = %v, want error %v", tt.rule, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got := r.Match(tt.host, tt.prompt); got != tt.match {
+			t.Errorf("%q matches %s %q = %v, want %v", tt.rule, tt.host, tt.prompt, got, tt.match)
+		}
+	}
+}
+
+func TestDefaultPromptRules(t *testing.T) {
+	tests := []struct {
+		prompt string
+		answer string
+	}{
+		{"Password: ", AnswerPassword},
+		{"user1@login1's password: ", AnswerPassword},
+		{"Password or token: ", AnswerPassword},
+		{"One-time password: ", AnswerTOTP},
+		{"OTP: ", AnswerTOTP},
+		{"Enter your verification code: ", AnswerTOTP},
+		{"Token: ", AnswerTOTP},
+		{"(user1@login1) Verification code: ", AnswerTOTP},
+		{"Duo passcode: ", AnswerTOTP},
+		{"PIN: ", ""},
+	}
+	for _, tt := range tests {
+		var answer string
+		for _, r := range DefaultPromptRules {
+			if r.Match("login1:22", tt.prompt) {
+				answer = r.Answer
+				break
+			}
+		}
+		if answer != tt.answer {
+			t.Errorf("answer of %q = %q, want %q", tt.prompt, answer, tt.answer)
+		}
+	}
+}
+
+// validTOTP reports whether code is the one of totpSecret now or in the
+// previous period.
+func validTOTP(code string) bool {
+	now := time.Now()
+	for _, at := range []time.Time{now, now.Add(-totpPeriod)} {
+		if want, _ := TOTP(totpSecret, at); code == want {
+			return true
+		}
+	}
+	return false
+}
+
+func TestKeyboardInteractiveLogin(t *testing.T) {
+	srv := sshtest.NewServer(t, func(cfg *ssh.ServerConfig) {
+		cfg.PasswordCallback = nil
+		cfg.KeyboardInteractiveCallback = func(c ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := client("", "", []string{"Password: ", "Verification code: "}, []bool{false, true})
+			if err != nil {
+				return nil, err
+			}
+			if len(answers) != 2 || answers[0] != sshtest.Password || !validTOTP(answers[1]) {
+				return nil, errors.New("wrong answers")
+			}
+			return nil, nil
+		}
+	})
+	echoAddr := echoServer(t)
+
+	tests := []struct {
+		name   string
+		client *Client
+		code   string
+	}{
+		{
+			name:   "password and code",
+			client: &Client{Password: sshtest.Password, TOTPSecret: totpSecret},
+		},
+		{
+			name:   "wrong password",
+			client: &Client{Password: "wrong", TOTPSecret: totpSecret},
+			code:   batproxy.ESSHAUTH,
+		},
+		{
+			name:   "missing code",
+			client: &Client{Password: sshtest.Password},
+			code:   batproxy.ESSHAUTH,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.client.User = "user1"
+			tt.client.Host = srv.Addr
+			tt.client.Logger = testLogger
+			s := New(testLogger, tt.client)
+			defer s.Close()
+
+			_, err := echo(t, s, echoAddr, "hello")
+			if code := batproxy.ErrorCode(err); code != tt.code {
+				t.Errorf("echo: err = %v, want code %q", err, tt.code)
+			}
+		})
+	}
+}
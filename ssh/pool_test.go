@@ -0,0 +1,182 @@
+package ssh
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/batx-dev/batproxy/internal/sshtest"
+)
+
+func newPool(srv *sshtest.Server, size int, idleTimeout time.Duration) *Ssh {
+	s := New(testLogger, &Client{
+		User:     "user1",
+		Host:     srv.Addr,
+		Password: sshtest.Password,
+		Logger:   testLogger,
+	})
+	s.PoolSize = size
+	s.PoolIdleTimeout = idleTimeout
+	return s
+}
+
+func (s *Ssh) poolSize() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+func TestPoolGrowShrink(t *testing.T) {
+	srv := sshtest.NewServer(t, nil)
+	srv.SetMaxChannels(1)
+	echoAddr := echoServer(t)
+
+	s := newPool(srv, 3, 50*time.Millisecond)
+	defer s.Close()
+
+	var conns []net.Conn
+	for i := 0; i < 3; i++ {
+		conn, err := s.DialContext(context.Background(), "tcp", echoAddr)
+		if err != nil {
+			t.Fatalf("stream %d: %v", i, err)
+		}
+		conns = append(conns, conn)
+	}
+	if got := srv.Conns(); got != 3 {
+		t.Errorf("ssh connections = %d, want 3 with one stream each", got)
+	}
+
+	if _, err := s.DialContext(context.Background(), "tcp", echoAddr); !prohibited(err) {
+		t.Errorf("stream past the pool size: err = %v, want prohibited", err)
+	}
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+	time.Sleep(200 * time.Millisecond)
+	if got := s.poolSize(); got != 1 {
+		t.Errorf("pool size = %d, want 1 once idle", got)
+	}
+
+	if got, err := echo(t, s, echoAddr, "hello"); err != nil || got != "hello" {
+		t.Errorf("echo after shrink = %q, %v", got, err)
+	}
+}
+
+func TestPoolForwardingDisabled(t *testing.T) {
+	srv := sshtest.NewServer(t, nil)
+	srv.SetForwarding(false)
+	echoAddr := echoServer(t)
+
+	s := newPool(srv, 4, time.Minute)
+	defer s.Close()
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.DialContext(context.Background(), "tcp", echoAddr); !prohibited(err) {
+			t.Fatalf("stream %d: err = %v, want prohibited", i, err)
+		}
+	}
+	if got := srv.Conns(); got != 1 {
+		t.Errorf("ssh connections = %d, want 1, refusing forwarding is no stream limit", got)
+	}
+	if got := s.poolSize(); got != 1 {
+		t.Errorf("pool size = %d, want 1", got)
+	}
+}
+
+func TestPoolPickRefused(t *testing.T) {
+	s := New(testLogger, &Client{User: "user1", Host: "login1:22", Logger: testLogger})
+
+	// the pool shrank back to the refused connection
+	if slot, _, ok := s.pick(map[int]bool{0: true}); ok {
+		t.Errorf("pick = %d, want no connection", slot)
+	}
+
+	slot, streams, ok := s.pick(nil)
+	if !ok || slot != 0 || streams != 1 {
+		t.Errorf("pick = %d, %d, %v, want the first connection", slot, streams, ok)
+	}
+	s.done(slot)
+}
+
+func TestPoolShrinkGrow(t *testing.T) {
+	srv := sshtest.NewServer(t, nil)
+	srv.SetMaxChannels(1)
+	echoAddr := echoServer(t)
+
+	s := newPool(srv, 2, time.Millisecond)
+	defer s.Close()
+
+	// the second connection is closed and opened again, the shrinking
+	// never closes the one grown after it
+	for i := 0; i < 20; i++ {
+		var conns []net.Conn
+		for j := 0; j < 2; j++ {
+			conn, err := s.DialContext(context.Background(), "tcp", echoAddr)
+			if err != nil {
+				t.Fatalf("round %d stream %d: %v", i, j, err)
+			}
+			conns = append(conns, conn)
+		}
+		for _, conn := range conns {
+			if _, err := conn.Write([]byte("x")); err != nil {
+				t.Fatalf("round %d: write: %v", i, err)
+			}
+			buf := make([]byte, 1)
+			if _, err := conn.Read(buf); err != nil {
+				t.Fatalf("round %d: read: %v", i, err)
+			}
+			conn.Close()
+		}
+	}
+}
+
+func TestPoolClosePendingDial(t *testing.T) {
+	// a host accepting connections but never answering the handshake
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if c, err := l.Accept(); err == nil {
+			accepted <- c
+		}
+	}()
+
+	s := New(testLogger, &Client{
+		User:     "user1",
+		Host:     l.Addr().String(),
+		Password: sshtest.Password,
+		Logger:   testLogger,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := s.DialContext(ctx, "tcp", "127.0.0.1:80"); err == nil {
+		t.Fatal("dial through a stalled host succeeded")
+	}
+
+	c := <-accepted
+	defer c.Close()
+
+	start := time.Now()
+	s.Close()
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Close took %s, want the pending dial cancelled", d)
+	}
+
+	// the client gave up its side of the connection
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 512)
+	for {
+		if _, err := c.Read(buf); err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				t.Error("connection of the pending dial left open")
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/batx-dev/batproxy"
+	"golang.org/x/crypto/ssh"
+)
+
+// Forwarding modes of the streams.
+const (
+	// ForwardDirect forwards the streams over the ssh connection, like
+	// ssh -L.
+	ForwardDirect = "direct"
+
+	// ForwardStdio relays the streams through the stdin and stdout of a
+	// command run on the host, like ssh -W, for servers disabling tcp
+	// forwarding.
+	ForwardStdio = "stdio"
+
+	// ForwardAuto forwards the streams directly until the server refuses
+	// it, and relays them after that.
+	ForwardAuto = "auto"
+)
+
+// DefaultRelayCommand relays a tcp stream with netcat.
+const DefaultRelayCommand = "nc %h %p"
+
+// DefaultRelayUnixCommand relays a unix domain socket stream with netcat.
+const DefaultRelayUnixCommand = "nc -U %h"
+
+// relayCommand returns the command relaying a stream to address.
+func (c *Client) relayCommand(network string, address string) (string, error) {
+	var command, host, port string
+	switch network {
+	case "unix":
+		command, host = c.RelayUnixCommand, address
+		if command == "" {
+			command = DefaultRelayUnixCommand
+		}
+	default:
+		command = c.RelayCommand
+		if command == "" {
+			command = DefaultRelayCommand
+		}
+		var err error
+		if host, port, err = net.SplitHostPort(address); err != nil {
+			return "", err
+		}
+	}
+	return strings.NewReplacer("%h", shellQuote(host), "%p", shellQuote(port), "%%", "%").Replace(command), nil
+}
+
+// shellQuote quotes s as a single word of a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// relay opens a stream relayed by a command on the connection of slot.
+func (s *Ssh) relay(ctx context.Context, slot int, network string, address string) (net.Conn, error) {
+	command, err := s.Client.relayCommand(network, address)
+	if err != nil {
+		s.done(slot)
+		return nil, err
+	}
+
+	sc, release, err := s.memo.Acquire(ctx, s.key(slot))
+	if err != nil {
+		s.done(slot)
+		return nil, err
+	}
+
+	conn, err := newStdioConn(sc, command, network, address)
+	if err != nil {
+		release()
+		s.done(slot)
+		return nil, err
+	}
+
+	// The ssh client is held until the stream is closed.
+	sc.channels.Add(1)
+	return &releaseConn{Conn: conn, release: func() {
+		sc.channels.Add(-1)
+		release()
+		s.done(slot)
+	}}, nil
+}
+
+// relaying reports whether the streams are relayed.
+func (s *Ssh) relaying() bool {
+	switch s.Client.Forward {
+	case ForwardStdio:
+		return true
+	case ForwardAuto:
+		return s.fallback.Load()
+	}
+	return false
+}
+
+// prohibited reports whether err is the server refusing a stream for
+// administrative reasons.
+func prohibited(err error) bool {
+	var openErr *ssh.OpenChannelError
+	return errors.As(err, &openErr) && openErr.Reason == ssh.Prohibited
+}
+
+// stdioConn is a stream relayed through the stdin and stdout of a command.
+type stdioConn struct {
+	session *ssh.Session
+	stdin   io.WriteCloser
+	stdout  io.Reader
+	stderr  *headBuffer
+
+	local  net.Addr
+	remote net.Addr
+
+	read      bool // some output was read
+	closeOnce sync.Once
+}
+
+func newStdioConn(sc *clientConn, command string, network string, address string) (*stdioConn, error) {
+	session, err := sc.NewSession()
+	if err != nil {
+		return nil, err
+	}
+
+	c := &stdioConn{
+		session: session,
+		stderr:  &headBuffer{max: 4 << 10},
+		local:   sc.LocalAddr(),
+		remote:  relayAddr{network: network, address: address},
+	}
+	session.Stderr = c.stderr
+	if c.stdin, err = session.StdinPipe(); err != nil {
+		session.Close()
+		return nil, err
+	}
+	if c.stdout, err = session.StdoutPipe(); err != nil {
+		session.Close()
+		return nil, err
+	}
+	if err := session.Start(command); err != nil {
+		session.Close()
+		return nil, batproxy.Errorf(batproxy.EBADGATEWAY, "relay %q: %v", command, err)
+	}
+
+	return c, nil
+}
+
+func (c *stdioConn) Read(b []byte) (int, error) {
+	n, err := c.stdout.Read(b)
+	if n > 0 {
+		c.read = true
+	}
+	if err == io.EOF && !c.read {
+		// the relay failed to reach the destination
+		if msg := strings.TrimSpace(c.stderr.String()); msg != "" {
+			return n, fmt.Errorf("relay to %s: %s", c.remote, msg)
+		}
+	}
+	return n, err
+}
+
+func (c *stdioConn) Write(b []byte) (int, error) {
+	return c.stdin.Write(b)
+}
+
+// CloseWrite closes the stdin of the command, so the relay sees the end of
+// the stream.
+func (c *stdioConn) CloseWrite() error {
+	return c.stdin.Close()
+}
+
+func (c *stdioConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		_ = c.stdin.Close()
+		err = c.session.Close()
+		if err == io.EOF {
+			err = nil
+		}
+	})
+	return err
+}
+
+func (c *stdioConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *stdioConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// The deadlines are ignored, so the callers setting them, e.g. the tls
+// handshakes of the transports, keep working over a relay.
+
+func (c *stdioConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *stdioConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *stdioConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// headBuffer keeps the first max bytes written to it, and discards the
+// others without failing the writer.
+type headBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	max int
+}
+
+func (b *headBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n := b.max - b.buf.Len(); n > 0 {
+		if n > len(p) {
+			n = len(p)
+		}
+		b.buf.Write(p[:n])
+	}
+	return len(p), nil
+}
+
+func (b *headBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// relayAddr is the destination of a relayed stream.
+type relayAddr struct {
+	network string
+	address string
+}
+
+func (a relayAddr) Network() string { return a.network }
+
+func (a relayAddr) String() string { return a.address }
@@ -0,0 +1,179 @@
+package ssh
+
+import (
+	"context"
+	"io"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/batx-dev/batproxy/internal/sshtest"
+)
+
+// relayScript relays its stdin and stdout to the tcp address $2:$3, or to
+// the unix domain socket $2 with $1 unix, like nc.
+const relayScript = `#!/usr/bin/env python3
+import socket, sys, threading
+
+if sys.argv[1] == "unix":
+    s = socket.socket(socket.AF_UNIX)
+    s.connect(sys.argv[2])
+else:
+    s = socket.create_connection((sys.argv[2], int(sys.argv[3])))
+
+def upload():
+    while True:
+        b = sys.stdin.buffer.read1(4096)
+        if not b:
+            break
+        s.sendall(b)
+    s.shutdown(socket.SHUT_WR)
+
+threading.Thread(target=upload, daemon=True).start()
+while True:
+    b = s.recv(4096)
+    if not b:
+        break
+    sys.stdout.buffer.write(b)
+    sys.stdout.buffer.flush()
+`
+
+func TestRelayCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		client  *Client
+		network string
+		address string
+		want    string
+	}{
+		{
+			name:    "tcp default",
+			client:  &Client{},
+			network: "tcp",
+			address: "cn01:8888",
+			want:    "nc 'cn01' '8888'",
+		},
+		{
+			name:    "tcp",
+			client:  &Client{RelayCommand: "socat - TCP:%h:%p", RelayUnixCommand: "socat - UNIX-CONNECT:%h"},
+			network: "tcp",
+			address: "cn01:8888",
+			want:    "socat - TCP:'cn01':'8888'",
+		},
+		{
+			name:    "unix default",
+			client:  &Client{RelayCommand: "socat - TCP:%h:%p"},
+			network: "unix",
+			address: "/tmp/app.sock",
+			want:    "nc -U '/tmp/app.sock'",
+		},
+		{
+			name:    "unix",
+			client:  &Client{RelayCommand: "socat - TCP:%h:%p", RelayUnixCommand: "socat - UNIX-CONNECT:%h"},
+			network: "unix",
+			address: "/tmp/it's.sock",
+			want:    `socat - UNIX-CONNECT:'/tmp/it'\''s.sock'`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.client.relayCommand(tt.network, tt.address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("relayCommand = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// unixEchoServer returns the path of a unix domain socket writing back what
+// it reads.
+func unixEchoServer(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "echo.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				_, _ = io.Copy(c, c)
+			}()
+		}
+	}()
+
+	return path
+}
+
+func TestRelay(t *testing.T) {
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("relay script requires python3")
+	}
+
+	srv := sshtest.NewServer(t, nil)
+	srv.SetForwarding(false)
+	srv.WriteScript(t, "relay", relayScript)
+
+	s := New(testLogger, &Client{
+		User:             "user1",
+		Host:             srv.Addr,
+		Password:         sshtest.Password,
+		Forward:          ForwardStdio,
+		RelayCommand:     "relay tcp %h %p",
+		RelayUnixCommand: "relay unix %h",
+		Logger:           testLogger,
+	})
+	defer s.Close()
+
+	tests := []struct {
+		network string
+		address string
+	}{
+		{network: "tcp", address: echoServer(t)},
+		{network: "unix", address: unixEchoServer(t)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.network, func(t *testing.T) {
+			conn, err := s.DialContext(context.Background(), tt.network, tt.address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			// the callers setting deadlines, like tls, work over the relay
+			if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+				t.Errorf("SetDeadline: %v", err)
+			}
+
+			if _, err := io.WriteString(conn, "hello"); err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, 5)
+			if _, err := io.ReadFull(conn, buf); err != nil {
+				t.Fatal(err)
+			}
+			if string(buf) != "hello" {
+				t.Errorf("echo = %q, want %q", buf, "hello")
+			}
+		})
+	}
+
+	if n := srv.Channels(); n != 0 {
+		t.Errorf("forwarding channels = %d, want the streams relayed", n)
+	}
+}
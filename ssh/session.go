@@ -0,0 +1,87 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/batx-dev/batproxy"
+)
+
+// MaxOutputSize bounds the output of the commands run by Output.
+const MaxOutputSize = 64 << 10
+
+// Output runs command on the host and returns its standard output. The
+// session is closed when ctx is done.
+func (s *Ssh) Output(ctx context.Context, command string) ([]byte, error) {
+	// nothing is refused yet, there is a connection to pick
+	slot, _, _ := s.pick(nil)
+	defer s.done(slot)
+
+	sc, release, err := s.memo.Acquire(ctx, s.key(slot))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	session, err := sc.NewSession()
+	if err != nil {
+		return nil, batproxy.Errorf(batproxy.EBADGATEWAY, "new session on %s: %v", s.Client, err)
+	}
+	defer session.Close()
+
+	sc.channels.Add(1)
+	defer sc.channels.Add(-1)
+
+	stdout := &limitedBuffer{max: MaxOutputSize}
+	stderr := &limitedBuffer{max: MaxOutputSize}
+	session.Stdout = stdout
+	session.Stderr = stderr
+
+	ch := make(chan error, 1)
+	go func() {
+		ch <- session.Run(command)
+	}()
+
+	select {
+	case err = <-ch:
+	case <-ctx.Done():
+		_ = session.Close()
+		return nil, ctx.Err()
+	}
+
+	if errors.Is(err, errOutputTooLarge) {
+		return nil, batproxy.Errorf(batproxy.EBADGATEWAY, "run %q on %s: output exceeds %d bytes", command, s.Client, MaxOutputSize)
+	}
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return nil, batproxy.Errorf(batproxy.EBADGATEWAY, "run %q on %s: %v", command, s.Client, err)
+		}
+		return nil, batproxy.Errorf(batproxy.EBADGATEWAY, "run %q on %s: %v: %s", command, s.Client, err, msg)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+var errOutputTooLarge = fmt.Errorf("output too large")
+
+// limitedBuffer fails the writes past max bytes. The buffer is not embedded,
+// io.Copy would use its ReadFrom.
+type limitedBuffer struct {
+	buf bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.buf.Len()+len(p) > b.max {
+		return 0, errOutputTooLarge
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) Bytes() []byte { return b.buf.Bytes() }
+
+func (b *limitedBuffer) String() string { return b.buf.String() }
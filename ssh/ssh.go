@@ -3,35 +3,355 @@ package ssh
 import (
 	"context"
 	"net"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/batx-dev/batproxy"
 	"github.com/batx-dev/batproxy/memo"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/exp/slog"
 )
 
+// DialErrorExpiration is how long a failed dial is remembered before the
+// next request for the same user@host tries again.
+const DialErrorExpiration = 15 * time.Second
+
+// Defaults of the pool of ssh connections to a host.
+const (
+	DefaultPoolSize        = 4
+	DefaultPoolIdleTimeout = 5 * time.Minute
+)
+
 type Ssh struct {
-	memo *memo.Memo[key, *ssh.Client]
+	memo *memo.Memo[key, *clientConn]
 
 	Client *Client `yaml:"client"`
 
 	Logger *slog.Logger
+
+	// OnClose is called by Close, e.g. to release the jump host.
+	OnClose func()
+
+	// PoolSize The maximum number of ssh connections to the host. Streams
+	// are spread over the open connections, a new one is opened when the
+	// server refuses a stream for administrative reasons.
+	PoolSize int
+
+	// PoolIdleTimeout Closes an extra connection without streams for this
+	// long. The first connection is never closed by the pool.
+	PoolIdleTimeout time.Duration
+
+	// fallback is set once the server refused to forward a stream which a
+	// relay could open, with ForwardAuto.
+	fallback atomic.Bool
+
+	cancel context.CancelFunc // cancels the dials in progress
+
+	mu      sync.Mutex  // guards size, streams, used and idle
+	size    int         // number of connections in use, at least 1
+	streams []int       // number of open streams per connection
+	used    []time.Time // last time a stream was closed per connection
+	idle    *time.Timer // shrinking timer
 }
 
 func New(logger *slog.Logger, client *Client) *Ssh {
+	// the dials in progress are cancelled by Close
+	ctx, cancel := context.WithCancel(context.Background())
+	dial := dialFunc(client)
+	m := memo.New(func(_ context.Context, key key, cleanup func()) (*clientConn, error) {
+		if ctx.Err() != nil {
+			return nil, batproxy.Errorf(batproxy.EUNAVAILABLE, "ssh %s closed", client)
+		}
+		sc, err := dial(ctx, key, cleanup)
+		if err == nil && ctx.Err() != nil {
+			_ = sc.Close()
+			return nil, batproxy.Errorf(batproxy.EUNAVAILABLE, "ssh %s closed", client)
+		}
+		return sc, err
+	})
+	m.ErrorExpiration = DialErrorExpiration
+	if client.Breakers != nil {
+		// The circuit of the host fails the dials fast until its next
+		// retry, there is no need to remember the failure.
+		m.ErrorExpirationFunc = func(err error) time.Duration {
+			switch batproxy.ErrorCode(err) {
+			case batproxy.ECIRCUITOPEN, batproxy.EINTERNAL:
+				return 0
+			}
+			return -1
+		}
+	}
+	m.OnEvict = func(key key, sc *clientConn) {
+		if err := sc.Close(); err != nil {
+			logger.Debug("close", "key", key.String(), "err", err)
+		}
+	}
+
 	return &Ssh{
-		Client: client,
-		Logger: logger,
-		memo:   memo.New(dialFunc(client)),
+		Client:          client,
+		Logger:          logger,
+		PoolSize:        DefaultPoolSize,
+		PoolIdleTimeout: DefaultPoolIdleTimeout,
+		memo:            m,
+		cancel:          cancel,
+		size:            1,
+		streams:         make([]int, 1),
+		used:            make([]time.Time, 1),
 	}
 }
 
+// DialContext opens a stream to address on the host, forwarded or relayed
+// as configured by Client.Forward.
 func (s *Ssh) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
-	sc, err := s.memo.Get(ctx, key{
-		User: s.Client.User,
-		Host: s.Client.Host,
-	})
+	// connections which refused the stream
+	refused := make(map[int]bool)
+	var err error
+	for {
+		slot, streams, ok := s.pick(refused)
+		if !ok {
+			// the pool shrank since it grew for this stream
+			return nil, err
+		}
+
+		var conn net.Conn
+		if s.relaying() {
+			conn, err = s.relay(ctx, slot, network, address)
+		} else {
+			conn, err = s.dial(ctx, slot, network, address)
+		}
+		if err == nil {
+			return conn, nil
+		}
+		if !prohibited(err) {
+			return nil, err
+		}
+
+		if s.Client.Forward == ForwardAuto && !s.fallback.Load() {
+			// The server may disable tcp forwarding rather than limit the
+			// streams of the connection.
+			if slot, _, ok := s.pick(refused); ok {
+				conn, err := s.relay(ctx, slot, network, address)
+				if err == nil {
+					s.fallback.Store(true)
+					s.Logger.Info("forward",
+						"status", "fallback",
+						"client", s.Client,
+						"forward", ForwardStdio,
+					)
+					return conn, nil
+				} else if !prohibited(err) {
+					return nil, err
+				}
+			}
+		}
+		if streams == 1 {
+			// A connection without other streams refused it, the server
+			// disables forwarding rather than limits the streams, another
+			// connection would refuse it too.
+			return nil, err
+		}
+		refused[slot] = true
+		if !s.grow(len(refused)) {
+			return nil, err
+		}
+	}
+}
+
+// dial opens a stream on the connection of slot.
+func (s *Ssh) dial(ctx context.Context, slot int, network string, address string) (net.Conn, error) {
+	sc, release, err := s.memo.Acquire(ctx, s.key(slot))
+	if err != nil {
+		s.done(slot)
+		return nil, err
+	}
+
+	conn, err := dialContext(ctx, sc.Client, network, address)
 	if err != nil {
+		release()
+		s.done(slot)
 		return nil, err
 	}
-	return sc.Dial(network, address)
+
+	// The ssh client is held until the stream is closed.
+	sc.channels.Add(1)
+	return &releaseConn{Conn: conn, release: func() {
+		sc.channels.Add(-1)
+		release()
+		s.done(slot)
+	}}, nil
+}
+
+// dialContext opens a stream on sc, and stops waiting for the server when
+// ctx is done. A stream opened after that is closed.
+func dialContext(ctx context.Context, sc *ssh.Client, network string, address string) (net.Conn, error) {
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+
+	ch := make(chan result, 1)
+	go func() {
+		conn, err := sc.Dial(network, address)
+		ch <- result{conn, err}
+	}()
+
+	select {
+	case res := <-ch:
+		return res.conn, res.err
+	case <-ctx.Done():
+		go func() {
+			if res := <-ch; res.conn != nil {
+				res.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// pick returns the connection with the fewest open streams, except the
+// refused ones, counts a stream on it and returns its number of streams.
+// ok is false if the pool has no other connection.
+func (s *Ssh) pick(refused map[int]bool) (slot int, streams int, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.streams) < s.size {
+		s.streams = append(s.streams, 0)
+		s.used = append(s.used, time.Time{})
+	}
+
+	slot = -1
+	for i := 0; i < s.size; i++ {
+		if refused[i] {
+			continue
+		}
+		if slot < 0 || s.streams[i] < s.streams[slot] {
+			slot = i
+		}
+	}
+	if slot < 0 {
+		return 0, 0, false
+	}
+	s.streams[slot]++
+
+	return slot, s.streams[slot], true
+}
+
+// done uncounts a stream counted by pick, and arms the shrinking of the pool
+// once its last connection has none.
+func (s *Ssh) done(slot int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.streams[slot]--
+	s.used[slot] = time.Now()
+	if s.size > 1 && s.streams[s.size-1] == 0 && s.idle == nil && s.PoolIdleTimeout > 0 {
+		s.idle = time.AfterFunc(s.PoolIdleTimeout, s.shrink)
+	}
+}
+
+// grow adds a connection to the pool once refused connections refused a
+// stream, and reports whether there is another connection to try.
+func (s *Ssh) grow(refused int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// another stream may have grown the pool meanwhile
+	if refused < s.size {
+		return true
+	}
+	if s.size >= s.PoolSize {
+		return false
+	}
+
+	s.size++
+	s.Logger.Info("pool",
+		"status", "grow",
+		"client", s.Client,
+		"size", s.size,
+	)
+	return true
+}
+
+// shrink closes the extra connections idle for PoolIdleTimeout, from the
+// last one.
+func (s *Ssh) shrink() {
+	s.mu.Lock()
+	s.idle = nil
+	var closed []int
+	for s.size > 1 && s.streams[s.size-1] == 0 {
+		if wait := s.PoolIdleTimeout - time.Since(s.used[s.size-1]); wait > 0 {
+			s.idle = time.AfterFunc(wait, s.shrink)
+			break
+		}
+		s.size--
+		// evicted before grow may reuse the slot
+		s.memo.Evict(s.key(s.size))
+		closed = append(closed, s.size)
+	}
+	size := s.size
+	s.mu.Unlock()
+
+	if len(closed) > 0 {
+		s.Logger.Info("pool",
+			"status", "shrink",
+			"client", s.Client,
+			"size", size,
+		)
+	}
+}
+
+// Close closes the ssh connections, including the streams still open on
+// them, and cancels the dials in progress.
+func (s *Ssh) Close() error {
+	s.cancel()
+
+	s.mu.Lock()
+	if s.idle != nil {
+		s.idle.Stop()
+		s.idle = nil
+	}
+	size := len(s.streams)
+	s.mu.Unlock()
+
+	for slot := 0; slot < size; slot++ {
+		// a dial in progress may have succeeded before it was cancelled
+		s.memo.Wait(s.key(slot))
+		s.memo.Evict(s.key(slot))
+	}
+	if s.OnClose != nil {
+		s.OnClose()
+	}
+	return nil
+}
+
+func (s *Ssh) key(slot int) key {
+	return key{
+		User: s.Client.User,
+		Host: s.Client.Host,
+		Slot: slot,
+	}
+}
+
+// releaseConn releases its ssh client when closed.
+type releaseConn struct {
+	net.Conn
+
+	once    sync.Once
+	release func()
+}
+
+// CloseWrite half-closes the stream if it can, e.g. the ssh channels.
+func (c *releaseConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+func (c *releaseConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
 }
@@ -0,0 +1,121 @@
+package ssh
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/batx-dev/batproxy/internal/sshtest"
+	"golang.org/x/exp/slog"
+)
+
+// testLogger discards the logs of the tests.
+var testLogger = slog.New(slog.NewTextHandler(io.Discard))
+
+// echoServer returns the address of a tcp server writing back what it reads.
+func echoServer(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				_, _ = io.Copy(c, c)
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+// echo writes msg to the destination through s and returns what comes back.
+func echo(t *testing.T, s *Ssh, addr string, msg string) (string, error) {
+	t.Helper()
+
+	conn, err := s.DialContext(context.Background(), "tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if _, err := io.WriteString(conn, msg); err != nil {
+		return "", err
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func TestDialUnix(t *testing.T) {
+	srv := sshtest.NewServer(t, nil)
+
+	// unix socket paths are short, the test directory may not be
+	dir, err := os.MkdirTemp("", "batproxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "echo.sock")
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				_, _ = io.Copy(c, c)
+			}()
+		}
+	}()
+
+	s := New(testLogger, &Client{
+		User:     "user1",
+		Host:     srv.Addr,
+		Password: sshtest.Password,
+		Logger:   testLogger,
+	})
+	defer s.Close()
+
+	conn, err := s.DialContext(context.Background(), "unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := io.WriteString(conn, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "hello" {
+		t.Errorf("echo over the socket = %q, %v", buf, err)
+	}
+	if got := srv.Channels(); got != 1 {
+		t.Errorf("forwarding channels = %d, want the streamlocal one", got)
+	}
+
+	if _, err := s.DialContext(context.Background(), "unix", filepath.Join(dir, "missing.sock")); err == nil {
+		t.Error("dial to a missing socket succeeded")
+	}
+}
@@ -0,0 +1,51 @@
+package ssh
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// totpPeriod and totpDigits are the RFC 6238 defaults used by authenticator
+// apps.
+const (
+	totpPeriod = 30 * time.Second
+	totpDigits = 6
+)
+
+// TOTP returns the RFC 6238 one-time code of the base32 secret at t.
+func TOTP(secret string, t time.Time) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(t.Unix()/int64(totpPeriod/time.Second)))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// dynamic truncation, RFC 4226 section 5.3
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, code%1000000), nil
+}
+
+// decodeTOTPSecret decodes secret as printed by authenticator setups: base32,
+// case insensitive, with optional spaces and padding.
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	secret = strings.TrimRight(secret, "=")
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("decode totp secret: %v", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,48 @@
+package ssh
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 appendix B, SHA-1 seed "12345678901234567890", last 6 digits
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		code, err := TOTP(secret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != tt.code {
+			t.Errorf("TOTP at %d = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestTOTPSecret(t *testing.T) {
+	at := time.Unix(59, 0)
+	for _, secret := range []string{
+		"gezdgnbvgy3tqojqgezdgnbvgy3tqojq",
+		"GEZD GNBV GY3T QOJQ GEZD GNBV GY3T QOJQ",
+	} {
+		if code, err := TOTP(secret, at); err != nil || code != "287082" {
+			t.Errorf("TOTP of %q = %s, %v, want 287082", secret, code, err)
+		}
+	}
+
+	if _, err := TOTP("not base32!", at); err == nil {
+		t.Error("TOTP of an invalid secret succeeded")
+	}
+}
@@ -0,0 +1,130 @@
+package ssh
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// dialUpstream connects to addr through the upstream proxy u within timeout.
+// The failures are reported as *net.OpError, like the ones of a direct dial.
+func dialUpstream(ctx context.Context, u *url.URL, addr string, timeout time.Duration) (net.Conn, error) {
+	proxyAddr := u.Host
+	if u.Port() == "" {
+		port := "1080"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+		proxyAddr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	d := &net.Dialer{Timeout: timeout}
+	if u.Scheme != "http" {
+		return dialSOCKS5(ctx, d, proxyAddr, u, addr)
+	}
+
+	conn, err := d.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	tunnel, err := connectHTTP(conn, u, addr)
+	if err != nil {
+		conn.Close()
+		return nil, &net.OpError{Op: "proxyconnect", Net: "tcp", Addr: conn.RemoteAddr(), Err: err}
+	}
+
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return tunnel, nil
+}
+
+// dialSOCKS5 connects to addr through the SOCKS5 proxy at proxyAddr.
+func dialSOCKS5(ctx context.Context, d *net.Dialer, proxyAddr string, u *url.URL, addr string) (net.Conn, error) {
+	// socks5 resolves the name locally, socks5h on the proxy
+	if u.Scheme == "socks5" {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if net.ParseIP(host) == nil {
+			ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+			if err != nil {
+				return nil, err
+			}
+			addr = net.JoinHostPort(ips[0].String(), port)
+		}
+	}
+
+	var auth *proxy.Auth
+	if u.User != nil {
+		password, _ := u.User.Password()
+		auth = &proxy.Auth{User: u.User.Username(), Password: password}
+	}
+
+	dialer, err := proxy.SOCKS5("tcp", proxyAddr, auth, d)
+	if err != nil {
+		return nil, err
+	}
+	// the failures are already *net.OpError
+	return dialer.(proxy.ContextDialer).DialContext(ctx, "tcp", addr)
+}
+
+// connectHTTP asks the HTTP proxy on conn to tunnel to addr.
+func connectHTTP(conn net.Conn, u *url.URL, addr string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	// The ssh server talks first, its banner may already be buffered.
+	r := bufio.NewReader(conn)
+	res, err := http.ReadResponse(r, req)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http connect %s: %s", addr, res.Status)
+	}
+
+	return &bufferedConn{Conn: conn, r: r}, nil
+}
+
+// bufferedConn reads what was buffered while talking to the proxy first.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
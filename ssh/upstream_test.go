@@ -0,0 +1,261 @@
+package ssh
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/batx-dev/batproxy/internal/sshtest"
+)
+
+// socks5Server is a SOCKS5 proxy requiring user and password, RFC 1928 and
+// RFC 1929, recording the destinations asked for.
+type socks5Server struct {
+	addr           string
+	user, password string
+
+	mu    sync.Mutex
+	dests []string
+}
+
+func newSOCKS5Server(t *testing.T, user, password string) *socks5Server {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	s := &socks5Server{addr: l.Addr().String(), user: user, password: password}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	return s
+}
+
+func (s *socks5Server) destinations() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.dests...)
+}
+
+func (s *socks5Server) serve(c net.Conn) {
+	defer c.Close()
+
+	readString := func() string {
+		var n [1]byte
+		if _, err := io.ReadFull(c, n[:]); err != nil {
+			return ""
+		}
+		b := make([]byte, n[0])
+		_, _ = io.ReadFull(c, b)
+		return string(b)
+	}
+
+	// greeting: version, methods
+	var head [2]byte
+	if _, err := io.ReadFull(c, head[:]); err != nil || head[0] != 5 {
+		return
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(c, methods); err != nil {
+		return
+	}
+	if _, err := c.Write([]byte{5, 2}); err != nil {
+		return
+	}
+
+	// username/password
+	if _, err := io.ReadFull(c, head[:1]); err != nil {
+		return
+	}
+	user, password := readString(), readString()
+	if user != s.user || password != s.password {
+		_, _ = c.Write([]byte{1, 1})
+		return
+	}
+	if _, err := c.Write([]byte{1, 0}); err != nil {
+		return
+	}
+
+	// connect request
+	var req [4]byte
+	if _, err := io.ReadFull(c, req[:]); err != nil || req[1] != 1 {
+		return
+	}
+	var host string
+	switch req[3] {
+	case 1:
+		ip := make([]byte, net.IPv4len)
+		_, _ = io.ReadFull(c, ip)
+		host = net.IP(ip).String()
+	case 3:
+		host = readString()
+	case 4:
+		ip := make([]byte, net.IPv6len)
+		_, _ = io.ReadFull(c, ip)
+		host = net.IP(ip).String()
+	default:
+		return
+	}
+	var port [2]byte
+	if _, err := io.ReadFull(c, port[:]); err != nil {
+		return
+	}
+	dest := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:]))))
+
+	s.mu.Lock()
+	s.dests = append(s.dests, dest)
+	s.mu.Unlock()
+
+	upstream, err := net.Dial("tcp", dest)
+	if err != nil {
+		_, _ = c.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer upstream.Close()
+	if _, err := c.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0}); err != nil {
+		return
+	}
+
+	go func() { _, _ = io.Copy(upstream, c) }()
+	_, _ = io.Copy(c, upstream)
+}
+
+// newConnectServer returns the address of an HTTP CONNECT proxy requiring
+// a Proxy-Authorization.
+func newConnectServer(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				r := bufio.NewReader(c)
+				req, err := http.ReadRequest(r)
+				if err != nil {
+					return
+				}
+				if req.Method != http.MethodConnect || req.Header.Get("Proxy-Authorization") == "" {
+					_, _ = io.WriteString(c, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+					return
+				}
+				upstream, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					_, _ = io.WriteString(c, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+					return
+				}
+				defer upstream.Close()
+				_, _ = io.WriteString(c, "HTTP/1.1 200 Connection established\r\n\r\n")
+				go func() { _, _ = io.Copy(upstream, r) }()
+				_, _ = io.Copy(c, upstream)
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func TestUpstream(t *testing.T) {
+	srv := sshtest.NewServer(t, nil)
+	_, port, _ := net.SplitHostPort(srv.Addr)
+	socks := newSOCKS5Server(t, "proxyuser", "proxypass")
+	connect := newConnectServer(t)
+	echoAddr := echoServer(t)
+
+	tests := []struct {
+		name     string
+		upstream string
+		host     string // of the ssh server
+		wantDest string // asked to the SOCKS5 proxy
+		wantErr  bool
+	}{
+		{
+			name:     "socks5 resolves locally",
+			upstream: "socks5://proxyuser:proxypass@" + socks.addr,
+			host:     net.JoinHostPort("localhost", port),
+			wantDest: srv.Addr,
+		},
+		{
+			name:     "socks5h resolves on the proxy",
+			upstream: "socks5h://proxyuser:proxypass@" + socks.addr,
+			host:     net.JoinHostPort("localhost", port),
+			wantDest: net.JoinHostPort("localhost", port),
+		},
+		{
+			name:     "socks5 wrong password",
+			upstream: "socks5://proxyuser:wrong@" + socks.addr,
+			host:     srv.Addr,
+			wantErr:  true,
+		},
+		{
+			name:     "http connect",
+			upstream: "http://proxyuser:proxypass@" + connect,
+			host:     srv.Addr,
+		},
+		{
+			name:     "http connect without credentials",
+			upstream: "http://" + connect,
+			host:     srv.Addr,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(socks.destinations())
+
+			s := New(testLogger, &Client{
+				User:     "user1",
+				Host:     tt.host,
+				Password: sshtest.Password,
+				Upstream: tt.upstream,
+				Logger:   testLogger,
+				// the failures are not worth retrying here
+				ConnectTimeout: 100 * time.Millisecond,
+			})
+			defer s.Close()
+
+			got, err := echo(t, s, echoAddr, "hello")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("dial succeeded, want an upstream proxy error")
+				}
+				return
+			}
+			if err != nil || got != "hello" {
+				t.Fatalf("echo = %q, %v, want %q", got, err, "hello")
+			}
+
+			if tt.wantDest != "" {
+				dests := socks.destinations()[before:]
+				if len(dests) != 1 || dests[0] != tt.wantDest {
+					t.Errorf("socks5 destinations = %v, want [%s]", dests, tt.wantDest)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package batproxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+// Target schemes of the destination.
+const (
+	TargetHTTP  = "http"
+	TargetHTTPS = "https"
+)
+
+// Target is how the reverse proxy speaks to the destination of a proxy, for
+// applications serving https or living under a base path.
+type Target struct {
+	// Scheme Scheme of the destination, one of [http, https].
+	// Default: http.
+	// Optional.
+	Scheme string `json:"scheme,omitempty"`
+
+	// BasePath Path prepended to the paths of the requests, e.g. /lab, and
+	// stripped from the redirects and the cookie paths of the responses.
+	// Optional.
+	BasePath string `json:"base_path,omitempty"`
+
+	// TLS Settings of the https connections to the destination.
+	// Optional.
+	TLS *TargetTLS `json:"tls,omitempty"`
+}
+
+// TargetTLS are the settings of the https connections to the destination of
+// a proxy.
+type TargetTLS struct {
+	// InsecureSkipVerify Accept any certificate of the destination.
+	// Optional.
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
+
+	// CA PEM certificates verifying the destination instead of the system
+	// ones, e.g. the self-signed certificate of the application.
+	// Optional.
+	CA string `json:"ca,omitempty"`
+
+	// Certificate PEM client certificate presented to the destination.
+	// Optional.
+	Certificate string `json:"certificate,omitempty"`
+
+	// PrivateKey PEM private key of certificate.
+	// Optional.
+	PrivateKey string `json:"private_key,omitempty"`
+
+	// ServerName Name verified in the certificate of the destination and sent
+	// as SNI, instead of node.
+	// Optional.
+	ServerName string `json:"server_name,omitempty"`
+}
+
+func (t *Target) Validate() error {
+	switch t.Scheme {
+	case "", TargetHTTP, TargetHTTPS:
+	default:
+		return fmt.Errorf("invalid target scheme %s, expect one of [%s, %s]", t.Scheme, TargetHTTP, TargetHTTPS)
+	}
+
+	if t.BasePath != "" && !strings.HasPrefix(t.BasePath, "/") {
+		return fmt.Errorf("invalid target base path %s, expect an absolute path", t.BasePath)
+	}
+
+	if t.TLS != nil {
+		if t.Scheme != TargetHTTPS {
+			return fmt.Errorf("target tls requires scheme %s", TargetHTTPS)
+		}
+		if _, err := t.TLS.Config(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Config returns the client TLS configuration of the settings.
+func (t *TargetTLS) Config() (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: t.InsecureSkipVerify,
+		ServerName:         t.ServerName,
+	}
+
+	if t.CA != "" {
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM([]byte(t.CA)) {
+			return nil, fmt.Errorf("invalid target tls ca, expect PEM certificates")
+		}
+	}
+
+	if t.Certificate != "" || t.PrivateKey != "" {
+		cert, err := tls.X509KeyPair([]byte(t.Certificate), []byte(t.PrivateKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid target tls certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
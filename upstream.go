@@ -0,0 +1,28 @@
+package batproxy
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// ParseUpstream parses the URL of an upstream proxy, one of
+// socks5://[user:password@]host:port, socks5h://... resolving the ssh server
+// name on the proxy, or http://[user:password@]host:port for HTTP CONNECT.
+func ParseUpstream(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream proxy: %v", err)
+	}
+
+	switch u.Scheme {
+	case "socks5", "socks5h", "http":
+	default:
+		return nil, fmt.Errorf("invalid upstream proxy scheme %q, expect one of [socks5, socks5h, http]", u.Scheme)
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid upstream proxy %q, expect <scheme>://[user:password@]host:port", s)
+	}
+
+	return u, nil
+}